@@ -17,7 +17,10 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // BasicAuthenticatorSpec defines the desired state of BasicAuthenticator
@@ -35,6 +38,19 @@ type BasicAuthenticatorSpec struct {
 	// +kubebuilder:validation:Optional
 	Selector metav1.LabelSelector `json:"selector,omitempty"`
 
+	// +kubebuilder:validation:Optional
+	// InjectCronJobs also injects the sidecar into the job template of the CronJobs matching Selector, when Type is sidecar.
+	// The sidecar only stops once the job's containers create /var/run/basicauthenticator/done, so the CronJobs have to
+	// be changed to create it before this is turned on: a job whose containers never do keeps running forever.
+	// Standalone Jobs are never injected.
+	InjectCronJobs bool `json:"injectCronJobs,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=true
+	// ManageDeployment creates the nginx deployment and service. Once false, only the credentials secret and the nginx config
+	// are created, for an nginx run outside the operator. Only used in deployment mode
+	ManageDeployment *bool `json:"manageDeployment,omitempty"`
+
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:default=ClusterIP
 	ServiceType string `json:"serviceType"`
@@ -45,16 +61,421 @@ type BasicAuthenticatorSpec struct {
 	// +kubebuilder:validation:Optional
 	AppService string `json:"appService"`
 
+	// +kubebuilder:validation:Optional
+	// Upstreams are the host:port addresses nginx proxies to instead of AppService and AppPort. More than one is balanced
+	// with LoadBalancingMethod. Only used in deployment mode
+	Upstreams []string `json:"upstreams,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=round_robin;least_conn
+	// +kubebuilder:default=round_robin
+	// LoadBalancingMethod is how requests are balanced across Upstreams
+	LoadBalancingMethod string `json:"loadBalancingMethod,omitempty"`
+
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:default=false
 	AdaptiveScale bool `json:"adaptiveScale"`
 
+	// +kubebuilder:validation:Optional
+	// Autoscaling scales the nginx deployment on CPU with a HorizontalPodAutoscaler, which then owns its replicas. Only used in deployment mode
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// NodeSelector restricts the nginx pods to the nodes with these labels. Only used in deployment mode
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Tolerations let the nginx pods be scheduled on tainted nodes. Only used in deployment mode
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Affinity sets the node and pod affinity of the nginx pods. Only used in deployment mode
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// TopologySpreadConstraints spread the nginx pods across the cluster. If not set, the pods of a deployment which may
+	// run more than one replica are spread across zones with a maxSkew of 1. Only used in deployment mode
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
 	// +kubebuilder:validation:Required
-	// +kubebuilder:default=80
+	// +kubebuilder:default=8080
+	// AuthenticatorPort is the port nginx listens on. As nginx runs as a non-root user, it should not be a privileged port
 	AuthenticatorPort int `json:"authenticatorPort"`
 
 	// +kubebuilder:validation:Optional
 	CredentialsSecretRef string `json:"credentialsSecretRef"`
+
+	// +kubebuilder:validation:Optional
+	// CredentialsSecretKeys are the keys the credentials are read from in the CredentialsSecretRef secret
+	CredentialsSecretKeys *CredentialsSecretKeys `json:"credentialsSecretKeys,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=basic;digest
+	// +kubebuilder:default=basic
+	// AuthType is the HTTP authentication scheme nginx asks for. digest needs an nginx image built with the auth_digest module
+	AuthType string `json:"authType,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ConfigTemplateRef is the name of a ConfigMap whose "template" key holds a Go text/template rendered as the nginx config instead of the built-in one
+	ConfigTemplateRef string `json:"configTemplateRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ErrorPages replaces the nginx error pages of the listed status codes with HTML pages from a ConfigMap. The nginx defaults are used if not set
+	ErrorPages *ErrorPagesSpec `json:"errorPages,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	// StripAuthHeader removes the Authorization header before proxying, so the upstream never sees the credentials
+	StripAuthHeader bool `json:"stripAuthHeader,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ProxyTimeouts sets the timeouts of the connections to the upstream. The nginx default of 60s is used for each one not set
+	ProxyTimeouts *ProxyTimeoutsSpec `json:"proxyTimeouts,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ProxyBuffering turns the buffering of upstream responses on or off. The nginx default, on, is used if not set
+	ProxyBuffering *bool `json:"proxyBuffering,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ProxyRequestBuffering turns the buffering of request bodies on or off. The nginx default, on, is used if not set
+	ProxyRequestBuffering *bool `json:"proxyRequestBuffering,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Logging sets the nginx access log format and error log level. The nginx defaults are used if not set
+	Logging *LoggingSpec `json:"logging,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Compression gzips the responses nginx sends. Responses are sent as the upstream returns them if not set
+	Compression *CompressionSpec `json:"compression,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ProtectedPaths are the path prefixes which require basic auth. Once set, every other path is served without it
+	ProtectedPaths []string `json:"protectedPaths,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// PathCredentials protect some of the ProtectedPaths with the credentials of another secret instead of the ones of
+	// CredentialsSecretRef. The other protected paths keep using those. Only supported with basic auth
+	PathCredentials []PathCredential `json:"pathCredentials,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// PublicPaths are the path prefixes which are served without basic auth
+	PublicPaths []string `json:"publicPaths,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// CredentialPolicy controls how credentials are generated when no CredentialsSecretRef is given
+	CredentialPolicy CredentialPolicy `json:"credentialPolicy,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ConfigOverrides is shallow-merged over the operator's CustomConfig for this object only
+	ConfigOverrides *ConfigOverrides `json:"configOverrides,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ImagePullSecrets are used to pull the nginx image. In sidecar mode they are added to the injected pods
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Always;IfNotPresent;Never
+	// +kubebuilder:default=IfNotPresent
+	// ImagePullPolicy is the pull policy of the nginx container
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// RotationInterval is the interval after which the auto-generated password is regenerated
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// RotationOverlap keeps the password replaced by a rotation valid for this long, so clients can switch to the new one
+	// without failing in the meantime. Only supported with basic auth
+	RotationOverlap *metav1.Duration `json:"rotationOverlap,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// MaxCredentialAge is the age after which the credentials are reported as expired by the CredentialsExpired condition
+	MaxCredentialAge *metav1.Duration `json:"maxCredentialAge,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MaxLength=63
+	// RotationPolicyLabel is set as the rotation-policy label of the generated credentials secret, to be consumed by external rotators
+	RotationPolicyLabel string `json:"rotationPolicyLabel,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	// ZeroTrust creates a default-deny NetworkPolicy for the nginx pods, allowing only the authenticator port and the upstream
+	ZeroTrust bool `json:"zeroTrust,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// NetworkPolicy restricts which peers may connect to the nginx pods, only used in deployment mode
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// PodDisruptionBudget keeps some nginx pods available during voluntary disruptions, only used in deployment mode with more than one replica
+	PodDisruptionBudget *PodDisruptionBudgetSpec `json:"podDisruptionBudget,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Ingress exposes the nginx service through an Ingress, only used in deployment mode
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Route exposes the nginx service through an OpenShift Route, only used in deployment mode
+	Route *RouteSpec `json:"route,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	// UseConfigReloader adds a sidecar to the nginx deployment which reloads nginx when its configuration changes, only used in deployment mode
+	UseConfigReloader bool `json:"useConfigReloader,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	// ValidateUpstream verifies AppService and AppPort point to an existing upstream before the authenticator is marked available, only used in deployment mode
+	ValidateUpstream bool `json:"validateUpstream,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	// InMemoryTmp mounts a memory backed emptyDir on nginx's /tmp, so temporary files holding request data are never written to disk
+	InMemoryTmp bool `json:"inMemoryTmp,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=30
+	// TerminationGracePeriodSeconds is how long the nginx pods get to drain in-flight requests before they are killed.
+	// In sidecar mode the grace period of the injected workloads is left as is
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ExtraVolumes are added to the nginx pods, or to the injected workloads in sidecar mode, to be mounted by ExtraVolumeMounts
+	ExtraVolumes []corev1.Volume `json:"extraVolumes,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ExtraVolumeMounts are added to the nginx container, such as a GeoIP database or custom error pages
+	ExtraVolumeMounts []corev1.VolumeMount `json:"extraVolumeMounts,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// TLS terminates TLS at nginx using the referenced secret. Plain HTTP is kept on AuthenticatorPort
+	TLS *TLSSpec `json:"tls,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Tuning sets the nginx worker directives. The image defaults are used when unset
+	Tuning *TuningSpec `json:"tuning,omitempty"`
+}
+
+// TuningSpec defines the top level nginx directives which matter under high load
+type TuningSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:XIntOrString
+	// WorkerProcesses is the number of nginx worker processes, or "auto" to use one per CPU core. Defaults to "auto"
+	WorkerProcesses *intstr.IntOrString `json:"workerProcesses,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// WorkerConnections is the maximum number of simultaneous connections of each worker process. Defaults to 1024
+	WorkerConnections int `json:"workerConnections,omitempty"`
+}
+
+// PathCredential names the secret holding the credentials of a protected path
+type PathCredential struct {
+	// +kubebuilder:validation:Required
+	// Path is one of the ProtectedPaths
+	Path string `json:"path"`
+
+	// +kubebuilder:validation:Required
+	// CredentialsSecretRef is the name of a secret in the namespace of the BasicAuthenticator with either username and
+	// password fields, or only an htpasswd field
+	CredentialsSecretRef string `json:"credentialsSecretRef"`
+}
+
+// ErrorPagesSpec defines the custom error pages nginx serves
+type ErrorPagesSpec struct {
+	// +kubebuilder:validation:Required
+	// ConfigMapName is the name of the ConfigMap in the namespace of the BasicAuthenticator holding the pages
+	ConfigMapName string `json:"configMapName"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Pages []ErrorPage `json:"pages"`
+}
+
+// ErrorPage maps a status code to the key of the ConfigMap holding its HTML page
+type ErrorPage struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum=400
+	// +kubebuilder:validation:Maximum=599
+	Code int `json:"code"`
+
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+}
+
+// ProxyTimeoutsSpec defines the timeouts nginx uses when proxying to the upstream
+type ProxyTimeoutsSpec struct {
+	// +kubebuilder:validation:Optional
+	// Connect is the timeout of establishing a connection, which usually cannot exceed 75s
+	Connect *metav1.Duration `json:"connect,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Read is the timeout between two successive reads of the response
+	Read *metav1.Duration `json:"read,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Send is the timeout between two successive writes of the request
+	Send *metav1.Duration `json:"send,omitempty"`
+}
+
+// LoggingSpec defines how nginx logs requests and errors
+type LoggingSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=combined;json
+	// Format of the access log. json logs one object per request, including the basic auth user
+	Format string `json:"format,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=debug;info;notice;warn;error;crit;alert;emerg
+	ErrorLogLevel string `json:"errorLogLevel,omitempty"`
+}
+
+// CompressionSpec defines how nginx compresses responses
+type CompressionSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	Enabled bool `json:"enabled,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Types are the MIME types compressed in addition to text/html, which nginx always compresses. "*" compresses any type
+	Types []string `json:"types,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// MinLength is the Content-Length in bytes below which responses are not compressed. The nginx default of 20 is used if not set
+	MinLength *int `json:"minLength,omitempty"`
+}
+
+// TLSSpec defines the certificate nginx serves TLS with
+type TLSSpec struct {
+	// +kubebuilder:validation:Required
+	// SecretName is the name of a kubernetes.io/tls secret in the same namespace
+	SecretName string `json:"secretName"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=8443
+	// Port is the port nginx serves TLS on, exposed as 443 by the nginx service. As nginx runs as a non-root user, it should not be a privileged port
+	Port int `json:"port,omitempty"`
+}
+
+// IngressSpec defines the Ingress created in front of the nginx service
+type IngressSpec struct {
+	// +kubebuilder:validation:Required
+	Host string `json:"host"`
+
+	// +kubebuilder:validation:Optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+}
+
+// CredentialPolicy defines how the auto-generated credentials should look like
+type CredentialPolicy struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=8
+	// +kubebuilder:validation:Maximum=128
+	// +kubebuilder:default=20
+	PasswordLength int `json:"passwordLength,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	IncludeSymbols bool `json:"includeSymbols,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MaxLength=32
+	UsernamePrefix string `json:"usernamePrefix,omitempty"`
+}
+
+// CredentialsSecretKeys defines the keys of a user provided credentials secret, so secrets populated by external
+// secret operators can be used without renaming their keys
+type CredentialsSecretKeys struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	// Username is the key of the username, defaults to username
+	Username string `json:"username,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	// Password is the key of the password, defaults to password
+	Password string `json:"password,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	// Htpasswd is the key of a ready htpasswd file. Once set, the file is used as is and no htpasswd is generated
+	Htpasswd string `json:"htpasswd,omitempty"`
+}
+
+// ConfigOverrides holds the per-object overrides of the operator's CustomConfig.
+// Any field set here takes precedence over CustomConfig, which in turn takes precedence over the built-in defaults.
+type ConfigOverrides struct {
+	// +kubebuilder:validation:Optional
+	Image string `json:"image,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// SidecarResources are the resources of the injected sidecar in sidecar mode. Resources is used if they are not set
+	SidecarResources *corev1.ResourceRequirements `json:"sidecarResources,omitempty"`
+}
+
+// NetworkPolicySpec defines the NetworkPolicy restricting ingress to the nginx pods
+type NetworkPolicySpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	Enabled bool `json:"enabled,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// From are the peers allowed to reach nginx. If empty, only the ingress controller namespace of the operator config is allowed
+	From []networkingv1.NetworkPolicyPeer `json:"from,omitempty"`
+}
+
+// AutoscalingSpec defines the HorizontalPodAutoscaler created for the nginx deployment
+type AutoscalingSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	MinReplicas int `json:"minReplicas,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int `json:"maxReplicas"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=80
+	// TargetCPUUtilizationPercentage is the average CPU utilization of the nginx pods, relative to their CPU request, to scale at
+	TargetCPUUtilizationPercentage int `json:"targetCPUUtilizationPercentage,omitempty"`
+}
+
+// PodDisruptionBudgetSpec defines the PodDisruptionBudget created for the nginx pods
+type PodDisruptionBudgetSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	Enabled bool `json:"enabled,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:XIntOrString
+	// MinAvailable is the number or percentage of nginx pods which should stay available. Defaults to 1
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+}
+
+// RouteSpec defines the OpenShift Route created in front of the nginx service
+type RouteSpec struct {
+	// +kubebuilder:validation:Optional
+	// Host of the Route. If empty, OpenShift generates one
+	Host string `json:"host,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	// EdgeTLS terminates TLS at the router and redirects insecure traffic to https
+	EdgeTLS bool `json:"edgeTLS,omitempty"`
+}
+
+// ResourceRef identifies a resource managed by a BasicAuthenticator
+type ResourceRef struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
 }
 
 // BasicAuthenticatorStatus defines the observed state of BasicAuthenticator
@@ -62,10 +483,40 @@ type BasicAuthenticatorStatus struct {
 	ReadyReplicas int    `json:"readyReplicas"`
 	Reason        string `json:"reason"`
 	State         string `json:"state"`
+	// CredentialsSecretRef is the name of the secret the credentials are read from,
+	// which is either spec.credentialsSecretRef or the generated secret
+	CredentialsSecretRef string `json:"credentialsSecretRef,omitempty"`
+	// GeneratedUsername is the username of the generated credentials. It is empty when spec.credentialsSecretRef is set,
+	// and the password is only available in the secret
+	GeneratedUsername string `json:"generatedUsername,omitempty"`
+	// LastRotationTime is the last time the auto-generated credentials were rotated
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+	// LastRotationToken is the value of the authenticator.snappcloud.io/rotate annotation the credentials were last rotated for
+	LastRotationToken string `json:"lastRotationToken,omitempty"`
+	// PreviousHtpasswd is the htpasswd entry of the credentials replaced by the last rotation, which stay valid until
+	// PreviousHtpasswdExpiry when spec.rotationOverlap is set
+	PreviousHtpasswd string `json:"previousHtpasswd,omitempty"`
+	// PreviousHtpasswdExpiry is when PreviousHtpasswd stops being accepted
+	PreviousHtpasswdExpiry *metav1.Time `json:"previousHtpasswdExpiry,omitempty"`
+	// InjectedDeployments are the names of the deployments the sidecar is injected into, used to prune the ones no longer selected
+	InjectedDeployments []string `json:"injectedDeployments,omitempty"`
+	// PlannedChanges are the changes a reconcile would make, reported while the dry-run annotation is set
+	PlannedChanges []string `json:"plannedChanges,omitempty"`
+	// ManagedResources are the resources created or injected for the BasicAuthenticator in the last reconcile
+	ManagedResources []ResourceRef `json:"managedResources,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Ready Replicas",type=integer,JSONPath=`.status.readyReplicas`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // BasicAuthenticator is the Schema for the basicauthenticators API
 type BasicAuthenticator struct {
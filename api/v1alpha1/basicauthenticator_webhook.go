@@ -18,16 +18,24 @@ package v1alpha1
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	htpasswd "github.com/snapp-incubator/simple-authenticator/pkg/htpasswd"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"net"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 )
 
@@ -39,6 +47,11 @@ var (
 const (
 	INVALID_OBJECT        = "invalid object passed"
 	INVALID_TYPE_MUTATION = "invalid operation on type"
+	// ConfigTemplateKey is the key of the ConfigMap referenced by ConfigTemplateRef holding the template
+	ConfigTemplateKey = "template"
+
+	AuthTypeBasic  = "basic"
+	AuthTypeDigest = "digest"
 )
 
 // log is for logging in this package.
@@ -58,6 +71,14 @@ var _ webhook.Defaulter = &BasicAuthenticator{}
 // Default implements webhook.Defaulter so a webhook will be registered for the type
 func (r *BasicAuthenticator) Default() {
 	basicauthenticatorlog.Info("default", "name", r.Name)
+
+	if r.Spec.AuthType == "" {
+		r.Spec.AuthType = AuthTypeBasic
+	}
+	if r.Spec.ManageDeployment == nil {
+		manageDeployment := true
+		r.Spec.ManageDeployment = &manageDeployment
+	}
 }
 
 //+kubebuilder:webhook:path=/validate-authenticator-snappcloud-io-v1alpha1-basicauthenticator,mutating=false,failurePolicy=fail,sideEffects=None,groups=authenticator.snappcloud.io,resources=basicauthenticators,verbs=create;update,versions=v1alpha1,name=vbasicauthenticator.kb.io,admissionReviewVersions=v1
@@ -68,10 +89,90 @@ var _ webhook.Validator = &BasicAuthenticator{}
 func (r *BasicAuthenticator) ValidateCreate() error {
 	basicauthenticatorlog.Info("validate create", "name", r.Name)
 
+	if err := r.validateMode(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate mode")
+		return err
+	}
+	if err := r.validateAuthType(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate auth type")
+		return err
+	}
 	if err := r.validateCredentials(); err != nil {
 		basicauthenticatorlog.Error(err, "Failed to validate credentials")
 		return err
 	}
+	if err := r.validateRotationOverlap(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate rotation overlap")
+		return err
+	}
+	if err := r.validateRotationPolicyLabel(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate rotation policy label")
+		return err
+	}
+	if err := r.validateConfigOverrides(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate config overrides")
+		return err
+	}
+	if err := r.validateIngress(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate ingress")
+		return err
+	}
+	if err := r.validateRoute(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate route")
+		return err
+	}
+	if err := r.validateTLS(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate tls")
+		return err
+	}
+	if err := r.validateTuning(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate tuning")
+		return err
+	}
+	if err := r.validatePaths(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate paths")
+		return err
+	}
+	if err := r.validatePathCredentials(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate path credentials")
+		return err
+	}
+	if err := r.validateUpstreams(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate upstreams")
+		return err
+	}
+	if err := r.validateProxyTimeouts(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate proxy timeouts")
+		return err
+	}
+	if err := r.validateCompression(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate compression")
+		return err
+	}
+	if err := r.validateManageDeployment(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate manage deployment")
+		return err
+	}
+	if err := r.validatePodDisruptionBudget(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate pod disruption budget")
+		return err
+	}
+	if err := r.validateAutoscaling(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate autoscaling")
+		return err
+	}
+	if err := r.validateConfigTemplate(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate config template")
+		return err
+	}
+	if err := r.validateExtraVolumes(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate extra volumes")
+		return err
+	}
+	if err := r.validateErrorPages(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate error pages")
+		return err
+	}
 	return nil
 }
 
@@ -79,10 +180,90 @@ func (r *BasicAuthenticator) ValidateCreate() error {
 func (r *BasicAuthenticator) ValidateUpdate(old runtime.Object) error {
 	basicauthenticatorlog.Info("validate update", "name", r.Name)
 
+	if err := r.validateMode(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate mode")
+		return err
+	}
+	if err := r.validateAuthType(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate auth type")
+		return err
+	}
 	if err := r.validateCredentials(); err != nil {
 		basicauthenticatorlog.Error(err, "Failed to validate credentials")
 		return err
 	}
+	if err := r.validateRotationOverlap(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate rotation overlap")
+		return err
+	}
+	if err := r.validateRotationPolicyLabel(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate rotation policy label")
+		return err
+	}
+	if err := r.validateConfigOverrides(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate config overrides")
+		return err
+	}
+	if err := r.validateIngress(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate ingress")
+		return err
+	}
+	if err := r.validateRoute(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate route")
+		return err
+	}
+	if err := r.validateTLS(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate tls")
+		return err
+	}
+	if err := r.validateTuning(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate tuning")
+		return err
+	}
+	if err := r.validatePaths(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate paths")
+		return err
+	}
+	if err := r.validatePathCredentials(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate path credentials")
+		return err
+	}
+	if err := r.validateUpstreams(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate upstreams")
+		return err
+	}
+	if err := r.validateProxyTimeouts(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate proxy timeouts")
+		return err
+	}
+	if err := r.validateCompression(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate compression")
+		return err
+	}
+	if err := r.validateManageDeployment(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate manage deployment")
+		return err
+	}
+	if err := r.validatePodDisruptionBudget(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate pod disruption budget")
+		return err
+	}
+	if err := r.validateAutoscaling(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate autoscaling")
+		return err
+	}
+	if err := r.validateConfigTemplate(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate config template")
+		return err
+	}
+	if err := r.validateExtraVolumes(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate extra volumes")
+		return err
+	}
+	if err := r.validateErrorPages(); err != nil {
+		basicauthenticatorlog.Error(err, "Failed to validate error pages")
+		return err
+	}
 	if err := r.validateTypeNotChanged(old); err != nil {
 		basicauthenticatorlog.Error(err, "failed update basic authenticator", "basic authenticator name", r.Name)
 		return err
@@ -99,9 +280,17 @@ func (r *BasicAuthenticator) ValidateDelete() error {
 
 func (r *BasicAuthenticator) validateCredentials() error {
 	secretName := r.Spec.CredentialsSecretRef
+	keys := r.Spec.CredentialsSecretKeys
 	if secretName == "" {
+		if keys != nil {
+			return errors.New("credentialsSecretKeys can only be set along with credentialsSecretRef")
+		}
 		return nil
 	}
+	usesHtpasswdKey := keys != nil && keys.Htpasswd != ""
+	if usesHtpasswdKey && r.Spec.AuthType == AuthTypeDigest {
+		return errors.New("digest auth needs username and password keys instead of an htpasswd key")
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), ValidationTimeout)
 	defer cancel()
@@ -112,16 +301,30 @@ func (r *BasicAuthenticator) validateCredentials() error {
 		basicauthenticatorlog.Error(err, "failed to fetch secret")
 		return err
 	}
-	_, exists := credentials.Data["username"]
-	if !exists {
-		return errors.New("illegal format. data missing username field")
+	usernameKey, passwordKey, htpasswdKey := r.getCredentialsSecretKeys()
+	_, hasUsername := credentials.Data[usernameKey]
+	_, hasPassword := credentials.Data[passwordKey]
+	htpasswdByte, hasHtpasswd := credentials.Data[htpasswdKey]
+	if usesHtpasswdKey && !hasHtpasswd {
+		return fmt.Errorf("illegal format. data missing %s field", htpasswdKey)
 	}
-	_, exists = credentials.Data["password"]
-	if !exists {
-		return errors.New("illegal format. data missing password field")
+	if usesHtpasswdKey || (hasHtpasswd && !hasUsername && !hasPassword) {
+		if r.Spec.AuthType == AuthTypeDigest {
+			return errors.New("illegal format. digest auth needs username and password fields instead of an htpasswd file")
+		}
+		// a ready htpasswd file is used as is
+		if err := htpasswd.ValidateHtpasswd(string(htpasswdByte)); err != nil {
+			return fmt.Errorf("failed to validate htpasswd: %w", err)
+		}
+		return nil
 	}
-	htpasswdByte, exists := credentials.Data["htpasswd"]
-	if exists {
+	if !hasUsername {
+		return fmt.Errorf("illegal format. data missing %s field", usernameKey)
+	}
+	if !hasPassword {
+		return fmt.Errorf("illegal format. data missing %s field", passwordKey)
+	}
+	if hasHtpasswd {
 		htpasswdStr := string(htpasswdByte)
 		if !htpasswd.ValidateHtpasswdFormat(strings.TrimSpace(htpasswdStr)) {
 			return errors.New("failed to validate format of htpasswd. htpasswd should be like \"username:password\"")
@@ -130,6 +333,483 @@ func (r *BasicAuthenticator) validateCredentials() error {
 	return nil
 }
 
+// getCredentialsSecretKeys returns the username, password and htpasswd keys of the credentials secret,
+// falling back to the default keys for the ones Spec.CredentialsSecretKeys does not set
+func (r *BasicAuthenticator) getCredentialsSecretKeys() (string, string, string) {
+	usernameKey, passwordKey, htpasswdKey := "username", "password", "htpasswd"
+	if keys := r.Spec.CredentialsSecretKeys; keys != nil {
+		if keys.Username != "" {
+			usernameKey = keys.Username
+		}
+		if keys.Password != "" {
+			passwordKey = keys.Password
+		}
+		if keys.Htpasswd != "" {
+			htpasswdKey = keys.Htpasswd
+		}
+	}
+	return usernameKey, passwordKey, htpasswdKey
+}
+
+// validateMode checks the fields each mode depends on. A sidecar proxies to AppPort of the pods it is injected into,
+// which are picked by the MatchLabels of Selector, so it cannot work without either. The nginx deployment proxies to
+// AppService and AppPort, or Upstreams, and is never injected anywhere, so a selector is ignored rather than rejected, as
+// BasicAuthenticators created before this check set one. The reconciler reports it to users in a SelectorIgnored event.
+func (r *BasicAuthenticator) validateMode() error {
+	switch r.Spec.Type {
+	case "sidecar":
+		if r.Spec.AppPort < 1 || r.Spec.AppPort > 65535 {
+			return errors.New("appPort is required in sidecar mode, as it is the port of the application the sidecar proxies to")
+		}
+		if len(r.Spec.Selector.MatchLabels) == 0 {
+			return errors.New("selector.matchLabels is required in sidecar mode, as it picks the deployments and cronjobs the sidecar is injected into")
+		}
+	case "deployment":
+		if len(r.Spec.Selector.MatchLabels) > 0 || len(r.Spec.Selector.MatchExpressions) > 0 {
+			basicauthenticatorlog.Info("selector is only used in sidecar mode and is ignored in deployment mode", "name", r.Name)
+		}
+	}
+	return nil
+}
+
+func (r *BasicAuthenticator) validateAuthType() error {
+	switch r.Spec.AuthType {
+	case "", AuthTypeBasic, AuthTypeDigest:
+		return nil
+	default:
+		return fmt.Errorf("invalid authType %q, should be %s or %s", r.Spec.AuthType, AuthTypeBasic, AuthTypeDigest)
+	}
+}
+
+func (r *BasicAuthenticator) validateRotationOverlap() error {
+	overlap := r.Spec.RotationOverlap
+	if overlap == nil {
+		return nil
+	}
+	if overlap.Duration <= 0 {
+		return errors.New("rotationOverlap should be positive")
+	}
+	if r.Spec.AuthType == AuthTypeDigest {
+		return errors.New("rotationOverlap is only supported with basic auth")
+	}
+	if interval := r.Spec.RotationInterval; interval != nil && interval.Duration > 0 && overlap.Duration >= interval.Duration {
+		return fmt.Errorf("rotationOverlap %s should be shorter than rotationInterval %s", overlap.Duration, interval.Duration)
+	}
+	return nil
+}
+
+func (r *BasicAuthenticator) validateRotationPolicyLabel() error {
+	if r.Spec.RotationPolicyLabel == "" {
+		return nil
+	}
+	if errs := validation.IsValidLabelValue(r.Spec.RotationPolicyLabel); len(errs) != 0 {
+		return fmt.Errorf("invalid rotationPolicyLabel %q: %s", r.Spec.RotationPolicyLabel, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func (r *BasicAuthenticator) validateConfigOverrides() error {
+	overrides := r.Spec.ConfigOverrides
+	if overrides == nil {
+		return nil
+	}
+	if overrides.Image != "" && strings.ContainsAny(overrides.Image, " \t\n") {
+		return fmt.Errorf("invalid image %q in configOverrides", overrides.Image)
+	}
+	if err := validateResourceRequirements("resources", overrides.Resources); err != nil {
+		return err
+	}
+	return validateResourceRequirements("sidecarResources", overrides.SidecarResources)
+}
+
+func validateResourceRequirements(field string, resources *v1.ResourceRequirements) error {
+	if resources == nil {
+		return nil
+	}
+	for name, request := range resources.Requests {
+		limit, exists := resources.Limits[name]
+		if exists && request.Cmp(limit) > 0 {
+			return fmt.Errorf("configOverrides %s request of %s must be less than or equal to its limit", field, name)
+		}
+	}
+	return nil
+}
+
+func (r *BasicAuthenticator) validateIngress() error {
+	if r.Spec.Ingress == nil {
+		return nil
+	}
+	if r.Spec.Type != "deployment" {
+		return errors.New("ingress is only supported in deployment mode")
+	}
+	if errs := validation.IsDNS1123Subdomain(r.Spec.Ingress.Host); len(errs) != 0 {
+		return fmt.Errorf("invalid ingress host %q: %s", r.Spec.Ingress.Host, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func (r *BasicAuthenticator) validateRoute() error {
+	if r.Spec.Route == nil {
+		return nil
+	}
+	if r.Spec.Type != "deployment" {
+		return errors.New("route is only supported in deployment mode")
+	}
+	if r.Spec.Route.Host == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(r.Spec.Route.Host); len(errs) != 0 {
+		return fmt.Errorf("invalid route host %q: %s", r.Spec.Route.Host, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func (r *BasicAuthenticator) validateTLS() error {
+	if r.Spec.TLS == nil {
+		return nil
+	}
+	if r.Spec.TLS.Port == r.Spec.AuthenticatorPort {
+		return errors.New("tls port must differ from authenticatorPort")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ValidationTimeout)
+	defer cancel()
+	var tlsSecret v1.Secret
+
+	err := runtimeClient.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: r.Spec.TLS.SecretName}, &tlsSecret)
+	if err != nil {
+		basicauthenticatorlog.Error(err, "failed to fetch tls secret")
+		return err
+	}
+	if tlsSecret.Type != v1.SecretTypeTLS {
+		return fmt.Errorf("tls secret %s must be of type %s", r.Spec.TLS.SecretName, v1.SecretTypeTLS)
+	}
+	return nil
+}
+
+func (r *BasicAuthenticator) validateTuning() error {
+	if r.Spec.Tuning == nil {
+		return nil
+	}
+	if r.Spec.Tuning.WorkerConnections < 0 {
+		return errors.New("workerConnections must be positive")
+	}
+	workerProcesses := r.Spec.Tuning.WorkerProcesses
+	if workerProcesses == nil {
+		return nil
+	}
+	if workerProcesses.Type == intstr.String && workerProcesses.StrVal != "auto" {
+		return fmt.Errorf("invalid workerProcesses %q, should be a positive number or \"auto\"", workerProcesses.StrVal)
+	}
+	if workerProcesses.Type == intstr.Int && workerProcesses.IntVal <= 0 {
+		return errors.New("workerProcesses must be positive")
+	}
+	return nil
+}
+
+// validateUpstreams makes sure each upstream is a host:port address nginx can take as a server, and is listed once
+func (r *BasicAuthenticator) validateUpstreams() error {
+	if len(r.Spec.Upstreams) == 0 {
+		return nil
+	}
+	if r.Spec.Type != "deployment" {
+		return errors.New("upstreams can only be set in deployment mode")
+	}
+	seen := make(map[string]bool)
+	for _, upstream := range r.Spec.Upstreams {
+		host, port, err := net.SplitHostPort(upstream)
+		if err != nil {
+			return fmt.Errorf("invalid upstream %q, should be host:port: %w", upstream, err)
+		}
+		if host == "" || strings.ContainsAny(host, " \t\n;{}\"'\\/") {
+			return fmt.Errorf("invalid host of upstream %q", upstream)
+		}
+		if portNumber, err := strconv.Atoi(port); err != nil || portNumber < 1 || portNumber > 65535 {
+			return fmt.Errorf("invalid port of upstream %q, should be between 1 and 65535", upstream)
+		}
+		if seen[upstream] {
+			return fmt.Errorf("upstream %q is listed more than once", upstream)
+		}
+		seen[upstream] = true
+	}
+	return nil
+}
+
+// validateProxyTimeouts makes sure the timeouts are at least a millisecond, the smallest unit nginx takes
+func (r *BasicAuthenticator) validateProxyTimeouts() error {
+	if r.Spec.ProxyTimeouts == nil {
+		return nil
+	}
+	names := []string{"connect", "read", "send"}
+	for i, timeout := range []*metav1.Duration{r.Spec.ProxyTimeouts.Connect, r.Spec.ProxyTimeouts.Read, r.Spec.ProxyTimeouts.Send} {
+		if timeout != nil && timeout.Duration < time.Millisecond {
+			return fmt.Errorf("invalid proxyTimeouts.%s %s, should be at least 1ms", names[i], timeout.Duration)
+		}
+	}
+	return nil
+}
+
+// validateCompression makes sure the minimum length is not negative and each type is a MIME type nginx can take in gzip_types
+func (r *BasicAuthenticator) validateCompression() error {
+	compression := r.Spec.Compression
+	if compression == nil {
+		return nil
+	}
+	if compression.MinLength != nil && *compression.MinLength < 0 {
+		return fmt.Errorf("invalid compression.minLength %d, should not be negative", *compression.MinLength)
+	}
+	for _, mimeType := range compression.Types {
+		if mimeType != "*" && !strings.Contains(mimeType, "/") {
+			return fmt.Errorf("invalid compression.types entry %q, should be a MIME type like text/css or *", mimeType)
+		}
+		if strings.ContainsAny(mimeType, " \t\n;{}\"'\\") {
+			return fmt.Errorf("invalid compression.types entry %q, should not contain whitespace, quotes or any of ;{}\\", mimeType)
+		}
+	}
+	return nil
+}
+
+// validateManageDeployment makes sure a BasicAuthenticator which does not manage its deployment sets none of the features
+// built on it, as there are no nginx pods or service for them
+func (r *BasicAuthenticator) validateManageDeployment() error {
+	if r.Spec.ManageDeployment == nil || *r.Spec.ManageDeployment {
+		return nil
+	}
+	if r.Spec.Type != "deployment" {
+		return errors.New("manageDeployment can only be disabled in deployment mode")
+	}
+	features := []struct {
+		name string
+		set  bool
+	}{
+		{"ingress", r.Spec.Ingress != nil},
+		{"route", r.Spec.Route != nil},
+		{"autoscaling", r.Spec.Autoscaling != nil},
+		{"podDisruptionBudget", r.Spec.PodDisruptionBudget != nil && r.Spec.PodDisruptionBudget.Enabled},
+		{"networkPolicy", r.Spec.NetworkPolicy != nil && r.Spec.NetworkPolicy.Enabled},
+		{"zeroTrust", r.Spec.ZeroTrust},
+		{"validateUpstream", r.Spec.ValidateUpstream},
+	}
+	for _, feature := range features {
+		if feature.set {
+			return fmt.Errorf("%s cannot be set while manageDeployment is disabled", feature.name)
+		}
+	}
+	return nil
+}
+
+func (r *BasicAuthenticator) validateAutoscaling() error {
+	if r.Spec.Autoscaling == nil {
+		return nil
+	}
+	if r.Spec.Type != "deployment" {
+		return errors.New("autoscaling is only supported in deployment mode")
+	}
+	if r.Spec.AdaptiveScale {
+		return errors.New("autoscaling and adaptiveScale can not be used together")
+	}
+	if r.Spec.Autoscaling.MinReplicas > r.Spec.Autoscaling.MaxReplicas {
+		return errors.New("autoscaling minReplicas must be less than or equal to maxReplicas")
+	}
+	return nil
+}
+
+func (r *BasicAuthenticator) validatePodDisruptionBudget() error {
+	if r.Spec.PodDisruptionBudget == nil || r.Spec.PodDisruptionBudget.MinAvailable == nil {
+		return nil
+	}
+	minAvailable := r.Spec.PodDisruptionBudget.MinAvailable
+	if minAvailable.Type == intstr.Int && minAvailable.IntVal < 0 {
+		return errors.New("minAvailable must not be negative")
+	}
+	if _, err := intstr.GetScaledValueFromIntOrPercent(minAvailable, r.Spec.Replicas, true); err != nil {
+		return fmt.Errorf("invalid minAvailable %q, should be a number or a percentage", minAvailable.String())
+	}
+	return nil
+}
+
+// validatePaths makes sure each protected or public path is a prefix nginx can take as a location, and is listed once
+func (r *BasicAuthenticator) validatePaths() error {
+	seen := make(map[string]bool)
+	fields := []string{"protectedPaths", "publicPaths"}
+	for i, paths := range [][]string{r.Spec.ProtectedPaths, r.Spec.PublicPaths} {
+		field := fields[i]
+		for _, path := range paths {
+			if !strings.HasPrefix(path, "/") {
+				return fmt.Errorf("invalid %s entry %q, should start with /", field, path)
+			}
+			if strings.ContainsAny(path, " \t\n;{}\"'\\") {
+				return fmt.Errorf("invalid %s entry %q, should not contain whitespace, quotes or any of ;{}\\", field, path)
+			}
+			if seen[path] {
+				return fmt.Errorf("path %q is listed more than once in protectedPaths and publicPaths", path)
+			}
+			seen[path] = true
+		}
+	}
+	return nil
+}
+
+// validatePathCredentials makes sure each path credential refers to a protected path, at most once, and to a secret
+// holding credentials nginx can use
+func (r *BasicAuthenticator) validatePathCredentials() error {
+	if len(r.Spec.PathCredentials) == 0 {
+		return nil
+	}
+	if r.Spec.AuthType == AuthTypeDigest {
+		return errors.New("pathCredentials are only supported with basic auth")
+	}
+	protected := make(map[string]bool)
+	for _, path := range r.Spec.ProtectedPaths {
+		protected[path] = true
+	}
+	paths := make(map[string]bool)
+	for _, pathCredential := range r.Spec.PathCredentials {
+		if !protected[pathCredential.Path] {
+			return fmt.Errorf("path credential of %q should refer to one of protectedPaths", pathCredential.Path)
+		}
+		if paths[pathCredential.Path] {
+			return fmt.Errorf("path %q is listed more than once in pathCredentials", pathCredential.Path)
+		}
+		paths[pathCredential.Path] = true
+		if pathCredential.CredentialsSecretRef == "" {
+			return fmt.Errorf("path credential of %q should have a credentialsSecretRef", pathCredential.Path)
+		}
+		if err := r.validatePathCredentialsSecret(pathCredential.CredentialsSecretRef); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *BasicAuthenticator) validatePathCredentialsSecret(secretName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ValidationTimeout)
+	defer cancel()
+	var credentials v1.Secret
+
+	err := runtimeClient.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: secretName}, &credentials)
+	if err != nil {
+		basicauthenticatorlog.Error(err, "failed to fetch path credentials secret")
+		return err
+	}
+	_, hasUsername := credentials.Data["username"]
+	_, hasPassword := credentials.Data["password"]
+	htpasswdByte, hasHtpasswd := credentials.Data["htpasswd"]
+	if hasUsername && hasPassword {
+		return nil
+	}
+	if !hasHtpasswd || hasUsername || hasPassword {
+		return fmt.Errorf("illegal format. secret %s should have both username and password fields, or only an htpasswd field", secretName)
+	}
+	if err := htpasswd.ValidateHtpasswd(string(htpasswdByte)); err != nil {
+		return fmt.Errorf("failed to validate htpasswd of secret %s: %w", secretName, err)
+	}
+	return nil
+}
+
+// validateExtraVolumes makes sure the extra volumes do not replace the volumes managed by the operator, and that each extra
+// volume mount refers to an extra volume. The configmap and generated secret volumes are named after the BasicAuthenticator
+// with a hash suffix, so such names are rejected as a whole.
+func (r *BasicAuthenticator) validateExtraVolumes() error {
+	reserved := []string{r.Spec.CredentialsSecretRef, "authenticator-tmp", "authenticator-lifecycle", "authenticator-error-pages"}
+	if r.Spec.TLS != nil {
+		reserved = append(reserved, r.Spec.TLS.SecretName)
+	}
+	volumes := make(map[string]bool)
+	for _, volume := range r.Spec.ExtraVolumes {
+		if volume.Name == "" {
+			return errors.New("extraVolumes entries should have a name")
+		}
+		for _, name := range reserved {
+			if name != "" && volume.Name == name {
+				return fmt.Errorf("extra volume %q collides with a volume managed by the operator", volume.Name)
+			}
+		}
+		if strings.HasPrefix(volume.Name, "authenticator-path-credentials-") {
+			return fmt.Errorf("extra volume %q collides with the path credentials volumes managed by the operator", volume.Name)
+		}
+		if isGeneratedName(r.Name, volume.Name) {
+			return fmt.Errorf("extra volume %q collides with the names of the volumes generated for %s", volume.Name, r.Name)
+		}
+		if volumes[volume.Name] {
+			return fmt.Errorf("extra volume %q is listed more than once", volume.Name)
+		}
+		volumes[volume.Name] = true
+	}
+	for _, volumeMount := range r.Spec.ExtraVolumeMounts {
+		if !volumes[volumeMount.Name] {
+			return fmt.Errorf("extra volume mount %q should refer to one of extraVolumes", volumeMount.Name)
+		}
+		if !strings.HasPrefix(volumeMount.MountPath, "/") {
+			return fmt.Errorf("invalid mountPath %q of extra volume mount %q, should be absolute", volumeMount.MountPath, volumeMount.Name)
+		}
+	}
+	return nil
+}
+
+// validateErrorPages makes sure each status code is an error code nginx can replace the page of, and is listed once.
+// Whether the ConfigMap holds the pages is checked at reconcile, so the pages can be created after the BasicAuthenticator.
+func (r *BasicAuthenticator) validateErrorPages() error {
+	if r.Spec.ErrorPages == nil {
+		return nil
+	}
+	if r.Spec.ErrorPages.ConfigMapName == "" {
+		return errors.New("errorPages.configMapName should be set")
+	}
+	codes := make(map[int]bool)
+	for _, page := range r.Spec.ErrorPages.Pages {
+		if page.Code < 400 || page.Code > 599 {
+			return fmt.Errorf("invalid error page code %d, should be between 400 and 599", page.Code)
+		}
+		if page.Key == "" {
+			return fmt.Errorf("error page %d should have a key", page.Code)
+		}
+		if codes[page.Code] {
+			return fmt.Errorf("error page %d is listed more than once", page.Code)
+		}
+		codes[page.Code] = true
+	}
+	return nil
+}
+
+// isGeneratedName reports whether name has the form of the names random_generator.GenerateRandomName derives from baseName
+func isGeneratedName(baseName string, name string) bool {
+	if !strings.HasPrefix(name, baseName+"-") {
+		return false
+	}
+	suffix := strings.TrimPrefix(name, baseName+"-")
+	if len(suffix) != 16 {
+		return false
+	}
+	_, err := hex.DecodeString(suffix)
+	return err == nil
+}
+
+func (r *BasicAuthenticator) validateConfigTemplate() error {
+	configMapName := r.Spec.ConfigTemplateRef
+	if configMapName == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ValidationTimeout)
+	defer cancel()
+	var templateConfigMap v1.ConfigMap
+
+	err := runtimeClient.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: configMapName}, &templateConfigMap)
+	if err != nil {
+		basicauthenticatorlog.Error(err, "failed to fetch config template")
+		return err
+	}
+	configTemplate, exists := templateConfigMap.Data[ConfigTemplateKey]
+	if !exists {
+		return fmt.Errorf("illegal format. configmap %s missing %s field", configMapName, ConfigTemplateKey)
+	}
+	if _, err := template.New(configMapName).Parse(configTemplate); err != nil {
+		return fmt.Errorf("failed to parse config template: %w", err)
+	}
+	return nil
+}
+
 func (r *BasicAuthenticator) validateTypeNotChanged(old runtime.Object) error {
 	oldBasicAuth, ok := old.(*BasicAuthenticator)
 	if !ok {
@@ -17,8 +17,11 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/snapp-incubator/simple-authenticator/internal/config"
@@ -28,7 +31,9 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -56,9 +61,12 @@ func main() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var customConfigPath string
+	var customConfigMap string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.StringVar(&customConfigPath, "custom-config-path", "", "the path to custom config.")
+	flag.StringVar(&customConfigMap, "custom-config-map", "", "namespace/name of a ConfigMap holding the custom config under "+
+		"the "+config.ConfigMapKey+" key. It is reloaded on change and takes precedence over custom-config-path.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -95,21 +103,42 @@ func main() {
 		// speeds up voluntary leader transitions as the new leader don't have to wait
 		// LeaseDuration time first.
 		//
-		// In the default scaffold provided, the program ends immediately after
-		// the manager stops, so would be fine to enable this option. However,
-		// if you are doing or is intended to do any operation such as perform cleanups
-		// after the manager stops then its usage might be unsafe.
-		// LeaderElectionReleaseOnCancel: true,
+		// The program ends right after the manager stops and does no cleanup afterwards,
+		// so a rolling update of the operator hands the lease over right away.
+		LeaderElectionReleaseOnCancel: true,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	var configSource *config.Source
+	if customConfigMap != "" {
+		namespace, name, found := strings.Cut(customConfigMap, "/")
+		if !found {
+			setupLog.Error(errors.New("expected namespace/name"), "invalid custom config map", "custom-config-map", customConfigMap)
+			os.Exit(1)
+		}
+		configSource = config.NewSource(customConfig, types.NamespacedName{Namespace: namespace, Name: name})
+		// the cache is not started yet, so the initial config is read from the API server
+		var configMap corev1.ConfigMap
+		if err := mgr.GetAPIReader().Get(context.Background(), configSource.ConfigMap, &configMap); err != nil {
+			setupLog.Error(err, "failed to load custom config map")
+		} else if tmpConf, err := config.ParseConfig([]byte(configMap.Data[config.ConfigMapKey])); err != nil {
+			setupLog.Error(err, "failed to parse custom config map")
+		} else {
+			customConfig = tmpConf
+			configSource.Set(customConfig)
+			authenticatorv1alpha1.ValidationTimeout = time.Second * time.Duration(customConfig.WebhookConf.ValidationTimeoutSecond)
+		}
+	}
+
 	if err = (&basic_authenticator.BasicAuthenticatorReconciler{
 		Client:       mgr.GetClient(),
 		Scheme:       mgr.GetScheme(),
 		CustomConfig: customConfig,
+		ConfigSource: configSource,
+		Recorder:     mgr.GetEventRecorderFor("basicauthenticator-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "BasicAuthenticator")
 		os.Exit(1)
@@ -128,6 +157,10 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("cache-sync", basic_authenticator.CacheSyncCheck(mgr.GetCache())); err != nil {
+		setupLog.Error(err, "unable to set up cache sync check")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
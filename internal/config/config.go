@@ -1,23 +1,82 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"reflect"
+	"sync"
+	"time"
 )
 
 type CustomConfig struct {
-	WebserverConf WebserverConfig `mapstructure:"webserver"`
-	WebhookConf   WebhookConfig   `mapstructure:"webhook"`
+	WebserverConf     WebserverConfig     `mapstructure:"webserver"`
+	WebhookConf       WebhookConfig       `mapstructure:"webhook"`
+	ReloaderConf      ReloaderConfig      `mapstructure:"reloader"`
+	SidecarConf       SidecarConfig       `mapstructure:"sidecar"`
+	ReconcileConf     ReconcileConfig     `mapstructure:"reconcile"`
+	NetworkPolicyConf NetworkPolicyConfig `mapstructure:"network_policy"`
+	// AllowedNamespaces are the only namespaces the BasicAuthenticators are reconciled in. Every namespace is allowed if empty
+	AllowedNamespaces []string `mapstructure:"allowed_namespaces"`
+	// NamespaceConfs overrides the webserver defaults for the BasicAuthenticators of a namespace, keyed by the namespace name
+	NamespaceConfs map[string]NamespaceConfig `mapstructure:"namespaces"`
+}
+
+type NamespaceConfig struct {
+	Image     string                       `mapstructure:"image"`
+	Resources *corev1.ResourceRequirements `mapstructure:"resources"`
 }
 
 type WebserverConfig struct {
-	Image         string `mapstructure:"image"`
-	ContainerName string `mapstructure:"container_name"`
+	Image         string                      `mapstructure:"image"`
+	ContainerName string                      `mapstructure:"container_name"`
+	Resources     corev1.ResourceRequirements `mapstructure:"resources"`
+	// SecurityContext replaces the default security context of the nginx container
+	SecurityContext *corev1.SecurityContext `mapstructure:"security_context"`
+	// PodSecurityContext replaces the default security context of the nginx deployment's pods
+	PodSecurityContext *corev1.PodSecurityContext `mapstructure:"pod_security_context"`
+	// DigestImage is an nginx image built with the auth_digest module, used by the BasicAuthenticators with digest AuthType
+	DigestImage string `mapstructure:"digest_image"`
+	// DisableProxyHeaders stops nginx from passing Host, X-Real-IP, X-Forwarded-For and X-Forwarded-Proto to the upstream
+	DisableProxyHeaders bool `mapstructure:"disable_proxy_headers"`
+}
+
+type ReloaderConfig struct {
+	Image string `mapstructure:"image"`
+}
+
+type SidecarConfig struct {
+	// ExclusiveInjection rejects injecting a deployment which is already injected by another BasicAuthenticator
+	ExclusiveInjection bool `mapstructure:"exclusive_injection"`
+}
+
+type ReconcileConfig struct {
+	// OrderedApply waits for the secret, configmap and deployment to be established, in that order, before moving on
+	OrderedApply bool `mapstructure:"ordered_apply"`
+	// EstablishTimeout bounds the wait for each resource when OrderedApply is set
+	EstablishTimeout time.Duration `mapstructure:"establish_timeout"`
+	// ProgressRequeueInterval is how often the nginx deployment is checked while some of its replicas are not ready
+	ProgressRequeueInterval time.Duration `mapstructure:"progress_requeue_interval"`
+	// MaxConcurrentReconciles is how many BasicAuthenticators are reconciled at the same time
+	MaxConcurrentReconciles int `mapstructure:"max_concurrent_reconciles"`
+}
+
+type NetworkPolicyConfig struct {
+	// IngressControllerNamespace is allowed to reach nginx when a BasicAuthenticator's network policy lists no peers
+	IngressControllerNamespace string `mapstructure:"ingress_controller_namespace"`
 }
 
 type WebhookConfig struct {
 	ValidationTimeoutSecond int `mapstructure:"validation_timeout_second"`
 }
 
+// ConfigMapKey is the key of the custom config in the ConfigMap it is loaded from
+const ConfigMapKey = "config.yaml"
+
 func InitConfig(configPath string) (*CustomConfig, error) {
 	viper.SetConfigFile(configPath)
 	viper.SetConfigType("yaml")
@@ -25,10 +84,68 @@ func InitConfig(configPath string) (*CustomConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	return unmarshalConfig(viper.GetViper())
+}
+
+// ParseConfig parses the custom config from the content of a config file, such as the data of its ConfigMap
+func ParseConfig(content []byte) (*CustomConfig, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	return unmarshalConfig(v)
+}
+
+func unmarshalConfig(v *viper.Viper) (*CustomConfig, error) {
 	var customConfig CustomConfig
-	err = viper.Unmarshal(&customConfig)
+	err := v.Unmarshal(&customConfig, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		quantityDecodeHook,
+	)))
 	if err != nil {
 		return nil, err
 	}
 	return &customConfig, nil
 }
+
+// Source holds the current custom config, which is replaced whenever its ConfigMap changes.
+// Readers get a snapshot which is never modified, so they see a consistent config while it is reloaded.
+type Source struct {
+	// ConfigMap is the ConfigMap the custom config is reloaded from
+	ConfigMap types.NamespacedName
+
+	mu           sync.RWMutex
+	customConfig *CustomConfig
+}
+
+func NewSource(customConfig *CustomConfig, configMap types.NamespacedName) *Source {
+	return &Source{ConfigMap: configMap, customConfig: customConfig}
+}
+
+// Get returns the current custom config
+func (s *Source) Get() *CustomConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.customConfig
+}
+
+// Set replaces the current custom config and reports whether it changed
+func (s *Source) Set(customConfig *CustomConfig) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reflect.DeepEqual(s.customConfig, customConfig) {
+		return false
+	}
+	s.customConfig = customConfig
+	return true
+}
+
+// quantityDecodeHook lets resource quantities such as "100m" or "128Mi" be written as plain values in the config file
+func quantityDecodeHook(_ reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(resource.Quantity{}) {
+		return data, nil
+	}
+	return resource.ParseQuantity(fmt.Sprint(data))
+}
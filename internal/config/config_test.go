@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitConfigLoadsNamespaceOverrides(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `webserver:
+  image: nginxinc/nginx-unprivileged:1.25.3
+namespaces:
+  tenant-a:
+    image: registry.tenant-a.example.com/nginx-unprivileged:1.25.3
+    resources:
+      requests:
+        cpu: 5m
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	customConfig, err := InitConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespaceConfig, exists := customConfig.NamespaceConfs["tenant-a"]
+	if !exists {
+		t.Fatalf("expected the tenant-a override to be loaded, got %v", customConfig.NamespaceConfs)
+	}
+	if namespaceConfig.Image != "registry.tenant-a.example.com/nginx-unprivileged:1.25.3" {
+		t.Errorf("unexpected image %q", namespaceConfig.Image)
+	}
+	if namespaceConfig.Resources == nil || namespaceConfig.Resources.Requests.Cpu().String() != "5m" {
+		t.Errorf("expected a cpu request of 5m, got %v", namespaceConfig.Resources)
+	}
+}
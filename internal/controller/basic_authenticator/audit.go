@@ -0,0 +1,25 @@
+package basic_authenticator
+
+import (
+	"github.com/snapp-incubator/simple-authenticator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+// auditComponent is the value of the component field of the audit log entries, so they can be shipped apart from the rest
+const auditComponent = "audit"
+
+// audit logs a security relevant action of basicAuthenticator on target, which is of the given kind.
+// The fields of the entry form a stable schema, new fields may be added but the existing ones are not renamed.
+func (r *BasicAuthenticatorReconciler) audit(basicAuthenticator *v1alpha1.BasicAuthenticator, action string, kind string, target client.Object) {
+	r.logger.WithValues("component", auditComponent).Info("audit",
+		"action", action,
+		"timestamp", r.now().UTC().Format(time.RFC3339),
+		"authenticatorName", basicAuthenticator.Name,
+		"authenticatorNamespace", basicAuthenticator.Namespace,
+		"authenticatorUID", string(basicAuthenticator.UID),
+		"targetKind", kind,
+		"targetName", target.GetName(),
+		"targetNamespace", target.GetNamespace(),
+	)
+}
@@ -18,49 +18,96 @@ package basic_authenticator
 
 import (
 	"context"
+	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/opdev/subreconciler"
 	authenticatorv1alpha1 "github.com/snapp-incubator/simple-authenticator/api/v1alpha1"
 	"github.com/snapp-incubator/simple-authenticator/internal/config"
 	appv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	"net/http"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sync"
+	"time"
 )
 
 // BasicAuthenticatorReconciler reconciles a BasicAuthenticator object
 type BasicAuthenticatorReconciler struct {
 	client.Client
-	Scheme                      *runtime.Scheme
-	CustomConfig                *config.CustomConfig
+	Scheme       *runtime.Scheme
+	CustomConfig *config.CustomConfig
+	// ConfigSource reloads CustomConfig from a ConfigMap when set. Each reconcile uses the snapshot current when it starts
+	ConfigSource                *config.Source
+	Recorder                    record.EventRecorder
 	configMapName               string
+	configChecksum              string
+	plannedChanges              []string
 	credentialName              string
 	basicAuthenticatorNamespace string
 	deploymentLabel             *v1.LabelSelector
-	logger                      logr.Logger
+	requeueAfter                time.Duration
+	routeAvailable              bool
+	// requeueAttempts counts the consecutive requeues of each object, to back off while it is stuck.
+	// It is shared by the copies of the reconciler concurrent reconciles run on
+	requeueAttempts *requeueAttempts
+	clock           clock.PassiveClock
+	logger          logr.Logger
+}
+
+type requeueAttempts struct {
+	lock   sync.Mutex
+	counts map[types.NamespacedName]int
 }
 
 //+kubebuilder:rbac:groups=authenticator.snappcloud.io,resources=basicauthenticators,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=authenticator.snappcloud.io,resources=basicauthenticators/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=authenticator.snappcloud.io,resources=basicauthenticators/finalizers,verbs=update
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes/custom-host,verbs=create;update
 
 func (r *BasicAuthenticatorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	// the steps keep the state of a reconcile in the reconciler, so each reconcile runs on its own copy of it
+	// to allow MaxConcurrentReconciles above 1
+	reconciler := *r
+	return reconciler.reconcile(ctx, req)
+}
+
+func (r *BasicAuthenticatorReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	r.logger = log.FromContext(ctx)
 	r.logger.Info("reconcile triggered")
 	r.logger.Info(req.String())
 	r.initVars(req)
+	if r.ConfigSource != nil {
+		r.CustomConfig = r.ConfigSource.Get()
+	}
 
 	basicAuthenticator := &authenticatorv1alpha1.BasicAuthenticator{}
 	switch err := r.Get(ctx, req.NamespacedName, basicAuthenticator); {
@@ -68,51 +115,286 @@ func (r *BasicAuthenticatorReconciler) Reconcile(ctx context.Context, req ctrl.R
 		return r.Cleanup(ctx, req)
 	case err != nil:
 		r.logger.Error(err, "failed to fetch object")
-		return subreconciler.Evaluate(subreconciler.Requeue())
+		return subreconciler.Evaluate(r.requeueWithBackoff(req))
 	default:
+		if !isNamespaceAllowed(r.CustomConfig, basicAuthenticator.Namespace) {
+			return r.refuseNamespace(ctx, req, basicAuthenticator)
+		}
+		if err := r.removeCondition(ctx, basicAuthenticator, ConditionTypeNamespaceNotAllowed); err != nil {
+			r.logger.Error(err, "failed to update namespace condition")
+			return subreconciler.Evaluate(r.requeueWithBackoff(req))
+		}
 		if basicAuthenticator.ObjectMeta.DeletionTimestamp != nil {
 			return r.Cleanup(ctx, req)
 		}
+		if isSuspended(basicAuthenticator) {
+			return r.suspend(ctx, req, basicAuthenticator)
+		}
+		if err := r.removeCondition(ctx, basicAuthenticator, ConditionTypeSuspended); err != nil {
+			r.logger.Error(err, "failed to update suspended condition")
+			return subreconciler.Evaluate(r.requeueWithBackoff(req))
+		}
+		if isDryRun(basicAuthenticator) {
+			return r.Plan(ctx, req)
+		}
 	}
 	return r.Provision(ctx, req)
 }
 
+func isSuspended(basicAuthenticator *authenticatorv1alpha1.BasicAuthenticator) bool {
+	return basicAuthenticator.Annotations[SuspendAnnotation] == "true"
+}
+
+// suspend leaves every resource of a basicAuthenticator annotated with SuspendAnnotation as it is, only reporting it in the
+// Suspended condition. Removing the annotation triggers a new reconcile, which resumes provisioning.
+func (r *BasicAuthenticatorReconciler) suspend(ctx context.Context, req ctrl.Request, basicAuthenticator *authenticatorv1alpha1.BasicAuthenticator) (ctrl.Result, error) {
+	r.logger.Info("reconciliation is suspended", "annotation", SuspendAnnotation)
+	message := fmt.Sprintf("reconciliation is suspended by the %s annotation", SuspendAnnotation)
+	if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeSuspended, v1.ConditionTrue, ConditionReasonSuspended, message); err != nil {
+		r.logger.Error(err, "failed to update suspended condition")
+		return subreconciler.Evaluate(r.requeueWithBackoff(req))
+	}
+	r.resetBackoff(req)
+	return subreconciler.Evaluate(subreconciler.DoNotRequeue())
+}
+
+// refuseNamespace leaves a basicAuthenticator outside the allowed namespaces and the workloads of its namespace as they
+// are, only reporting it in the NamespaceNotAllowed condition. Its finalizer is dropped once it is deleted, so a
+// BasicAuthenticator created before its namespace was disallowed can still be deleted, though without any cleanup.
+// Allowing the namespace again takes effect on the next change of the BasicAuthenticator, or once the config is reloaded.
+func (r *BasicAuthenticatorReconciler) refuseNamespace(ctx context.Context, req ctrl.Request, basicAuthenticator *authenticatorv1alpha1.BasicAuthenticator) (ctrl.Result, error) {
+	r.logger.Info("namespace is not allowed", "namespace", basicAuthenticator.Namespace)
+	if basicAuthenticator.ObjectMeta.DeletionTimestamp != nil {
+		return subreconciler.Evaluate(r.removeCleanupFinalizer(ctx, req))
+	}
+	message := fmt.Sprintf("namespace %s is not one of the namespaces the operator is allowed to act in", basicAuthenticator.Namespace)
+	if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeNamespaceNotAllowed, v1.ConditionTrue, ConditionReasonNotInAllowlist, message); err != nil {
+		r.logger.Error(err, "failed to update namespace condition")
+		return subreconciler.Evaluate(r.requeueWithBackoff(req))
+	}
+	r.resetBackoff(req)
+	return subreconciler.Evaluate(subreconciler.DoNotRequeue())
+}
+
 func (r *BasicAuthenticatorReconciler) initVars(request ctrl.Request) {
 	r.basicAuthenticatorNamespace = request.Namespace
+	r.requeueAfter = 0
+	r.plannedChanges = nil
 	//configmap name and credential name's value would be set in reconcile loop
 }
 
+// scheduleRequeue makes the reconcile loop run again after the given duration, keeping the earliest requested one
+func (r *BasicAuthenticatorReconciler) scheduleRequeue(after time.Duration) {
+	if r.requeueAfter == 0 || after < r.requeueAfter {
+		r.requeueAfter = after
+	}
+}
+
+// now returns the current time of the reconciler's clock, which is replaced in tests
+func (r *BasicAuthenticatorReconciler) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+	return r.clock.Now()
+}
+
+// requeueWithBackoff requeues the object after a delay which doubles on every consecutive requeue, up to maxRequeueDelay
+func (r *BasicAuthenticatorReconciler) requeueWithBackoff(req ctrl.Request) (*ctrl.Result, error) {
+	if r.requeueAttempts == nil {
+		r.requeueAttempts = &requeueAttempts{}
+	}
+	r.requeueAttempts.lock.Lock()
+	defer r.requeueAttempts.lock.Unlock()
+	if r.requeueAttempts.counts == nil {
+		r.requeueAttempts.counts = make(map[types.NamespacedName]int)
+	}
+	attempts := r.requeueAttempts.counts[req.NamespacedName]
+	r.requeueAttempts.counts[req.NamespacedName] = attempts + 1
+	return subreconciler.RequeueWithDelay(getBackoffDelay(attempts))
+}
+
+// resetBackoff is called once the object is reconciled without requeueing
+func (r *BasicAuthenticatorReconciler) resetBackoff(req ctrl.Request) {
+	if r.requeueAttempts == nil {
+		return
+	}
+	r.requeueAttempts.lock.Lock()
+	defer r.requeueAttempts.lock.Unlock()
+	delete(r.requeueAttempts.counts, req.NamespacedName)
+}
+
+func getBackoffDelay(attempts int) time.Duration {
+	delay := baseRequeueDelay
+	for i := 0; i < attempts && delay < maxRequeueDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRequeueDelay {
+		return maxRequeueDelay
+	}
+	return delay
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *BasicAuthenticatorReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	r.routeAvailable = isRouteAPIAvailable(mgr.GetRESTMapper())
+	r.requeueAttempts = &requeueAttempts{}
+	builder := ctrl.NewControllerManagedBy(mgr).WithOptions(r.controllerOptions())
+	if r.routeAvailable {
+		builder = builder.Owns(newRoute())
+	}
+	if r.ConfigSource != nil {
+		builder = builder.Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.reloadCustomConfig),
+		)
+	}
+	return builder.
 		For(&authenticatorv1alpha1.BasicAuthenticator{}).
 		Owns(&appv1.Deployment{}).
 		Owns(&corev1.ConfigMap{}).
 		Owns(&corev1.Secret{}).
 		Owns(&corev1.Service{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&networkingv1.Ingress{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
 		Watches(
 			&source.Kind{Type: &appv1.Deployment{}},
 			handler.EnqueueRequestsFromMapFunc(r.findExternallyManagedDeployments),
 		).
+		Watches(
+			&source.Kind{Type: &batchv1.CronJob{}},
+			handler.EnqueueRequestsFromMapFunc(r.findInjectedCronJobs),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.findReferencingBasicAuthenticators),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.findConfigMapReferencingBasicAuthenticators),
+		).
 		Complete(r)
 }
 
+// CacheSyncCheck returns a health check which passes once the informer caches the controller reads from have synced.
+// The caches are started on every replica, whether it holds the leader lease or not, so standby replicas report ready
+// as well and are able to take over right away.
+func CacheSyncCheck(informers cache.Informers) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), cacheSyncCheckTimeout)
+		defer cancel()
+		if !informers.WaitForCacheSync(ctx) {
+			return fmt.Errorf("informer caches are not synced")
+		}
+		return nil
+	}
+}
+
+// controllerOptions returns the options of the controller, taken from the custom config when it is set up.
+// A change of MaxConcurrentReconciles takes effect once the operator restarts.
+func (r *BasicAuthenticatorReconciler) controllerOptions() controller.Options {
+	customConfig := r.CustomConfig
+	if r.ConfigSource != nil {
+		customConfig = r.ConfigSource.Get()
+	}
+	return controller.Options{MaxConcurrentReconciles: getMaxConcurrentReconciles(customConfig)}
+}
+
+// findReferencingBasicAuthenticators enqueues the basicAuthenticators whose credentialsSecretRef or path credentials
+// point to the given secret, as user provided secrets are not owned by them.
+func (r *BasicAuthenticatorReconciler) findReferencingBasicAuthenticators(secret client.Object) []reconcile.Request {
+	var basicAuthenticators authenticatorv1alpha1.BasicAuthenticatorList
+	if err := r.List(context.Background(), &basicAuthenticators, client.InNamespace(secret.GetNamespace())); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0)
+	for i, basicAuthenticator := range basicAuthenticators.Items {
+		if basicAuthenticator.Spec.CredentialsSecretRef == secret.GetName() || existsInList(getPathCredentialsSecretNames(&basicAuthenticators.Items[i]), secret.GetName()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// findConfigMapReferencingBasicAuthenticators enqueues the basicAuthenticators whose configTemplateRef or error pages point to the given configmap
+func (r *BasicAuthenticatorReconciler) findConfigMapReferencingBasicAuthenticators(configMap client.Object) []reconcile.Request {
+	var basicAuthenticators authenticatorv1alpha1.BasicAuthenticatorList
+	if err := r.List(context.Background(), &basicAuthenticators, client.InNamespace(configMap.GetNamespace())); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0)
+	for _, basicAuthenticator := range basicAuthenticators.Items {
+		errorPages := basicAuthenticator.Spec.ErrorPages
+		if basicAuthenticator.Spec.ConfigTemplateRef == configMap.GetName() || (errorPages != nil && errorPages.ConfigMapName == configMap.GetName()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
 func (r *BasicAuthenticatorReconciler) findExternallyManagedDeployments(deployment client.Object) []reconcile.Request {
 	deploy, ok := deployment.(*appv1.Deployment)
 	if !ok {
 		return nil
 	}
-	if deploy.ObjectMeta.Annotations == nil {
-		return nil
+	requests := make([]reconcile.Request, 0)
+	// deployments with an injected sidecar are labeled, so changes like opting out of injection are picked up
+	if basicAuthName, exists := deploy.ObjectMeta.Labels[basicAuthenticatorNameLabel]; exists {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: basicAuthName, Namespace: deploy.Namespace},
+		})
+	}
+	if basicAuthName, exists := deploy.ObjectMeta.Annotations[ExternallyManaged]; exists {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: basicAuthName, Namespace: deploy.Namespace},
+		})
 	}
-	basicAuthName, exists := deploy.ObjectMeta.Annotations[ExternallyManaged]
+	return requests
+}
+
+// findInjectedCronJobs enqueues the basicAuthenticator which injected the given cronJob, so changes like opting out are picked up
+func (r *BasicAuthenticatorReconciler) findInjectedCronJobs(cronJob client.Object) []reconcile.Request {
+	basicAuthName, exists := cronJob.GetLabels()[basicAuthenticatorNameLabel]
 	if !exists {
 		return nil
 	}
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Name: basicAuthName, Namespace: cronJob.GetNamespace()},
+	}}
+}
 
-	return []reconcile.Request{
-		{
-			NamespacedName: types.NamespacedName{Name: basicAuthName, Namespace: deploy.Namespace},
-		},
+// reloadCustomConfig replaces the custom config when its ConfigMap changes, and enqueues all basicAuthenticators so the
+// new defaults take effect. A config which fails to parse is ignored, keeping the current one.
+func (r *BasicAuthenticatorReconciler) reloadCustomConfig(obj client.Object) []reconcile.Request {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok || client.ObjectKeyFromObject(configMap) != r.ConfigSource.ConfigMap {
+		return nil
+	}
+	logger := ctrl.Log.WithName("custom-config")
+	customConfig, err := config.ParseConfig([]byte(configMap.Data[config.ConfigMapKey]))
+	if err != nil {
+		logger.Error(err, "failed to parse custom config, keeping the current one")
+		return nil
+	}
+	if !r.ConfigSource.Set(customConfig) {
+		return nil
+	}
+	logger.Info("custom config reloaded")
+	var basicAuthenticators authenticatorv1alpha1.BasicAuthenticatorList
+	if err := r.List(context.Background(), &basicAuthenticators); err != nil {
+		logger.Error(err, "failed to list basic authenticators to apply the reloaded config")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(basicAuthenticators.Items))
+	for _, basicAuthenticator := range basicAuthenticators.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace},
+		})
 	}
+	return requests
 }
@@ -0,0 +1,254 @@
+package basic_authenticator
+
+import (
+	"context"
+	"github.com/snapp-incubator/simple-authenticator/api/v1alpha1"
+	"github.com/snapp-incubator/simple-authenticator/internal/config"
+	"github.com/snapp-incubator/simple-authenticator/pkg/random_generator"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetBackoffDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 0, expected: time.Second},
+		{attempts: 1, expected: 2 * time.Second},
+		{attempts: 5, expected: 32 * time.Second},
+		{attempts: 9, expected: maxRequeueDelay},
+		{attempts: 100, expected: maxRequeueDelay},
+	}
+	for _, tt := range tests {
+		if delay := getBackoffDelay(tt.attempts); delay != tt.expected {
+			t.Errorf("expected %s after %d attempts, got %s", tt.expected, tt.attempts, delay)
+		}
+	}
+}
+
+func TestReloadCustomConfigEnqueuesAllBasicAuthenticators(t *testing.T) {
+	r, _ := newTestReconciler(t,
+		&v1alpha1.BasicAuthenticator{ObjectMeta: metav1.ObjectMeta{Name: "first", Namespace: "tenant-a"}},
+		&v1alpha1.BasicAuthenticator{ObjectMeta: metav1.ObjectMeta{Name: "second", Namespace: "tenant-b"}},
+	)
+	configMapKey := types.NamespacedName{Name: "custom-config", Namespace: "operator"}
+	initial := &config.CustomConfig{WebserverConf: config.WebserverConfig{Image: "nginxinc/nginx-unprivileged:1.25.3"}}
+	r.ConfigSource = config.NewSource(initial, configMapKey)
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: configMapKey.Name, Namespace: configMapKey.Namespace},
+		Data:       map[string]string{config.ConfigMapKey: "webserver:\n  image: nginxinc/nginx-unprivileged:1.25.4\n"},
+	}
+
+	if requests := r.reloadCustomConfig(configMap); len(requests) != 2 {
+		t.Errorf("expected all basic authenticators to be enqueued, got %v", requests)
+	}
+	if image := r.ConfigSource.Get().WebserverConf.Image; image != "nginxinc/nginx-unprivileged:1.25.4" {
+		t.Errorf("expected the config to be reloaded, got image %q", image)
+	}
+	if requests := r.reloadCustomConfig(configMap); len(requests) != 0 {
+		t.Errorf("expected an unchanged config not to enqueue anything, got %v", requests)
+	}
+
+	invalid := configMap.DeepCopy()
+	invalid.Data[config.ConfigMapKey] = "webserver: ["
+	if requests := r.reloadCustomConfig(invalid); len(requests) != 0 {
+		t.Errorf("expected an invalid config to be ignored, got %v", requests)
+	}
+	other := configMap.DeepCopy()
+	other.Name = "other"
+	other.Data[config.ConfigMapKey] = "webserver:\n  image: other\n"
+	if requests := r.reloadCustomConfig(other); len(requests) != 0 {
+		t.Errorf("expected other configmaps to be ignored, got %v", requests)
+	}
+	if image := r.ConfigSource.Get().WebserverConf.Image; image != "nginxinc/nginx-unprivileged:1.25.4" {
+		t.Errorf("expected the reloaded config to be kept, got image %q", image)
+	}
+}
+
+func TestControllerOptionsMaxConcurrentReconciles(t *testing.T) {
+	r := &BasicAuthenticatorReconciler{}
+	if options := r.controllerOptions(); options.MaxConcurrentReconciles != defaultMaxConcurrentReconciles {
+		t.Errorf("expected %d concurrent reconciles by default, got %d", defaultMaxConcurrentReconciles, options.MaxConcurrentReconciles)
+	}
+
+	r.CustomConfig = &config.CustomConfig{ReconcileConf: config.ReconcileConfig{MaxConcurrentReconciles: 8}}
+	if options := r.controllerOptions(); options.MaxConcurrentReconciles != 8 {
+		t.Errorf("expected the configured 8 concurrent reconciles, got %d", options.MaxConcurrentReconciles)
+	}
+
+	r.ConfigSource = config.NewSource(&config.CustomConfig{ReconcileConf: config.ReconcileConfig{MaxConcurrentReconciles: 16}}, types.NamespacedName{})
+	if options := r.controllerOptions(); options.MaxConcurrentReconciles != 16 {
+		t.Errorf("expected the concurrent reconciles of the config source, got %d", options.MaxConcurrentReconciles)
+	}
+}
+
+func TestSuspendAnnotationStopsReconciliation(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "basicauthenticator-suspend",
+			Namespace:   "default",
+			Annotations: map[string]string{SuspendAnnotation: "true"},
+		},
+		Spec: v1alpha1.BasicAuthenticatorSpec{Type: "deployment", Replicas: 1, AppService: "upstream", AppPort: 3000, AuthenticatorPort: 8080},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	deploymentKey := types.NamespacedName{Name: random_generator.GenerateRandomName(basicAuthenticator.Name, "deployment"), Namespace: "default"}
+
+	if result, err := r.Reconcile(ctx, req); err != nil || !result.IsZero() {
+		t.Fatalf("expected a suspended reconcile not to requeue, got %v, %v", result, err)
+	}
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(latest.Status.Conditions, ConditionTypeSuspended) {
+		t.Errorf("expected the Suspended condition, got %+v", latest.Status.Conditions)
+	}
+	var secrets corev1.SecretList
+	if err := k8sClient.List(ctx, &secrets); err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets.Items) != 0 || len(latest.Finalizers) != 0 {
+		t.Error("expected nothing to be created while suspended")
+	}
+	if err := k8sClient.Get(ctx, deploymentKey, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("expected no deployment while suspended, got %v", err)
+	}
+
+	delete(latest.Annotations, SuspendAnnotation)
+	if err := k8sClient.Update(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Get(ctx, deploymentKey, &appsv1.Deployment{}); err != nil {
+		t.Errorf("expected the deployment to be created once resumed, got %v", err)
+	}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	if meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeSuspended) != nil {
+		t.Error("expected the Suspended condition to be removed once resumed")
+	}
+}
+
+func TestDisallowedNamespaceIsIgnored(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-disallowed", Namespace: "tenant-b"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "sidecar",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			Selector:          metav1.LabelSelector{MatchLabels: map[string]string{"app": "target"}},
+		},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "target", Namespace: "tenant-b", Labels: map[string]string{"app": "target"}},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+			},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, deployment)
+	customConfig := &config.CustomConfig{AllowedNamespaces: []string{"tenant-a"}}
+	r.CustomConfig = customConfig
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	deploymentKey := types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}
+
+	if result, err := r.Reconcile(ctx, req); err != nil || !result.IsZero() {
+		t.Fatalf("expected a reconcile in a disallowed namespace not to requeue, got %v, %v", result, err)
+	}
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	condition := meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeNamespaceNotAllowed)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != ConditionReasonNotInAllowlist || !strings.Contains(condition.Message, "tenant-b") {
+		t.Errorf("expected a condition explaining the namespace is not allowed, got %+v", condition)
+	}
+	var secrets corev1.SecretList
+	if err := k8sClient.List(ctx, &secrets); err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets.Items) != 0 || len(latest.Finalizers) != 0 {
+		t.Error("expected nothing to be created in a disallowed namespace")
+	}
+	target := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, deploymentKey, target); err != nil {
+		t.Fatal(err)
+	}
+	if len(target.Spec.Template.Spec.Containers) != 1 {
+		t.Error("expected the deployment of a disallowed namespace to be left untouched")
+	}
+	if _, err := injector(ctx, latest, "configmap", "", "secret", customConfig, k8sClient); err == nil {
+		t.Error("expected the injector to refuse a disallowed namespace")
+	}
+
+	customConfig.AllowedNamespaces = append(customConfig.AllowedNamespaces, "tenant-b")
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Get(ctx, deploymentKey, target); err != nil {
+		t.Fatal(err)
+	}
+	if getContainerIndex(target.Spec.Template.Spec.Containers, nginxDefaultContainerName) == -1 {
+		t.Error("expected the sidecar to be injected once the namespace is allowed")
+	}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	if meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeNamespaceNotAllowed) != nil {
+		t.Error("expected the condition to be removed once the namespace is allowed")
+	}
+}
+
+// blockingInformers reports its caches synced once synced is closed, like the manager's cache once its informers sync
+type blockingInformers struct {
+	cache.Informers
+	synced chan struct{}
+}
+
+func (i *blockingInformers) WaitForCacheSync(ctx context.Context) bool {
+	select {
+	case <-i.synced:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func TestCacheSyncCheck(t *testing.T) {
+	informers := &blockingInformers{synced: make(chan struct{})}
+	handler := &healthz.Handler{Checks: map[string]healthz.Checker{"cache-sync": CacheSyncCheck(informers)}}
+	probe := func() int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		return recorder.Code
+	}
+
+	if code := probe(); code != http.StatusInternalServerError {
+		t.Errorf("expected the check to fail before the caches sync, got status %d", code)
+	}
+	close(informers.synced)
+	if code := probe(); code != http.StatusOK {
+		t.Errorf("expected the check to pass after the caches sync, got status %d", code)
+	}
+}
@@ -6,11 +6,14 @@ import (
 	"github.com/opdev/subreconciler"
 	"github.com/snapp-incubator/simple-authenticator/api/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"strings"
 )
 
 func (r *BasicAuthenticatorReconciler) Cleanup(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -27,6 +30,7 @@ func (r *BasicAuthenticatorReconciler) Cleanup(ctx context.Context, req ctrl.Req
 		}
 	}
 
+	r.resetBackoff(req)
 	return subreconciler.Evaluate(subreconciler.DoNotRequeue())
 }
 func (r *BasicAuthenticatorReconciler) setDeletionStatus(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
@@ -70,14 +74,38 @@ func (r *BasicAuthenticatorReconciler) removeInjectedContainers(ctx context.Cont
 		r.logger.Error(err, "failed to get target secret to clean up")
 		return subreconciler.RequeueWithError(err)
 	}
+	if basicAuthenticator.Spec.TLS != nil {
+		secrets = append(secrets, basicAuthenticator.Spec.TLS.SecretName)
+	}
+	secrets = append(secrets, getExtraVolumeNames(basicAuthenticator)...)
 	r.logger.Info("debug", "configmap", configmaps, "secret", secrets)
 
-	cleanupDeployments := removeInjectedResources(deployments, secrets, configmaps)
+	nginxContainerName := getNginxContainerName(getEffectiveConfig(r.CustomConfig, basicAuthenticator))
+	cleanupDeployments := removeInjectedResources(deployments, nginxContainerName, secrets, configmaps)
 	for _, deploy := range cleanupDeployments {
 		if err := r.Update(ctx, deploy); err != nil {
 			r.logger.Error(err, "failed to add update cleaned up deployments")
 			return subreconciler.RequeueWithError(err)
 		}
+		r.Recorder.Eventf(deploy, v1.EventTypeNormal, EventReasonSidecarRemoved, "authenticator sidecar removed by BasicAuthenticator %s", basicAuthenticator.Name)
+		r.Recorder.Eventf(basicAuthenticator, v1.EventTypeNormal, EventReasonSidecarRemoved, "authenticator sidecar removed from deployment %s", deploy.Name)
+		r.audit(basicAuthenticator, AuditActionSidecarRemoved, "Deployment", deploy)
+	}
+	var cronJobList batchv1.CronJobList
+	if err := r.List(ctx, &cronJobList, client.MatchingLabels(basicAuthLabel), client.InNamespace(basicAuthenticator.Namespace)); err != nil {
+		r.logger.Error(err, "failed to get target cronjobs to clean up")
+		return subreconciler.RequeueWithError(err)
+	}
+	for i := range cronJobList.Items {
+		cronJob := &cronJobList.Items[i]
+		removeInjectedCronJobResources([]*batchv1.CronJob{cronJob}, nginxContainerName, secrets, configmaps)
+		if err := r.Update(ctx, cronJob); err != nil {
+			r.logger.Error(err, "failed to update cleaned up cronjob")
+			return subreconciler.RequeueWithError(err)
+		}
+		r.Recorder.Eventf(cronJob, v1.EventTypeNormal, EventReasonSidecarRemoved, "authenticator sidecar removed by BasicAuthenticator %s", basicAuthenticator.Name)
+		r.Recorder.Eventf(basicAuthenticator, v1.EventTypeNormal, EventReasonSidecarRemoved, "authenticator sidecar removed from cronjob %s", cronJob.Name)
+		r.audit(basicAuthenticator, AuditActionSidecarRemoved, "CronJob", cronJob)
 	}
 	return subreconciler.ContinueReconciling()
 }
@@ -89,7 +117,7 @@ func (r *BasicAuthenticatorReconciler) removeCleanupFinalizer(ctx context.Contex
 	if controllerutil.ContainsFinalizer(basicAuthenticator, basicAuthenticatorFinalizer) {
 		if ok := controllerutil.RemoveFinalizer(basicAuthenticator, basicAuthenticatorFinalizer); !ok {
 			r.logger.Error(errors.New("finalizer not updated"), "Failed to remove finalizer for BasicAuthenticator")
-			return subreconciler.Requeue()
+			return r.requeueWithBackoff(req)
 		}
 	}
 
@@ -111,8 +139,8 @@ func getTargetDeployment(ctx context.Context, basicAuthenticator *v1alpha1.Basic
 	}
 
 	resultDeployments := make([]*appsv1.Deployment, 0)
-	for _, deploy := range deploymentList.Items {
-		resultDeployments = append(resultDeployments, &deploy)
+	for i := range deploymentList.Items {
+		resultDeployments = append(resultDeployments, &deploymentList.Items[i])
 	}
 	return resultDeployments, nil
 }
@@ -147,30 +175,77 @@ func getTargetSecretName(ctx context.Context, basicAuthenticator *v1alpha1.Basic
 	}
 	return resultSecrets, nil
 }
-func removeInjectedResources(deployments []*appsv1.Deployment, secrets []string, configmap []string) []*appsv1.Deployment {
+func removeInjectedResources(deployments []*appsv1.Deployment, containerName string, secrets []string, configmap []string) []*appsv1.Deployment {
 	for _, deploy := range deployments {
-		containers := make([]v1.Container, 0)
-		for _, container := range deploy.Spec.Template.Spec.Containers {
-			if container.Name != nginxDefaultContainerName {
-				containers = append(containers, container)
-			}
+		removeInjectedPodTemplate(&deploy.Spec.Template, containerName, secrets, configmap)
+		removeInjectedMetadata(&deploy.ObjectMeta)
+	}
+	return deployments
+}
+
+// removeInjectedCronJobResources removes the sidecar from the job template of cronJobs
+func removeInjectedCronJobResources(cronJobs []*batchv1.CronJob, containerName string, secrets []string, configmap []string) []*batchv1.CronJob {
+	for _, cronJob := range cronJobs {
+		removeInjectedPodTemplate(&cronJob.Spec.JobTemplate.Spec.Template, containerName, secrets, configmap)
+		removeInjectedMetadata(&cronJob.ObjectMeta)
+	}
+	return cronJobs
+}
+
+func removeInjectedPodTemplate(podTemplate *v1.PodTemplateSpec, containerName string, secrets []string, configmap []string) {
+	containers := make([]v1.Container, 0)
+	for _, container := range podTemplate.Spec.Containers {
+		if container.Name == containerName {
+			continue
 		}
-		deploy.Spec.Template.Spec.Containers = containers
-		volumes := make([]v1.Volume, 0)
-		for _, vol := range deploy.Spec.Template.Spec.Volumes {
-			if !existsInList(secrets, vol.Name) && !existsInList(configmap, vol.Name) {
-				volumes = append(volumes, vol)
+		volumeMounts := make([]v1.VolumeMount, 0, len(container.VolumeMounts))
+		for _, volumeMount := range container.VolumeMounts {
+			if volumeMount.Name != lifecycleVolumeName {
+				volumeMounts = append(volumeMounts, volumeMount)
 			}
 		}
-		deploy.Spec.Template.Spec.Volumes = volumes
-		if deploy.Annotations != nil {
-			delete(deploy.Annotations, ExternallyManaged)
+		if len(volumeMounts) == 0 {
+			volumeMounts = nil
 		}
-		if deploy.Labels != nil {
-			delete(deploy.Labels, basicAuthenticatorNameLabel)
+		container.VolumeMounts = volumeMounts
+		containers = append(containers, container)
+	}
+	podTemplate.Spec.Containers = containers
+	volumes := make([]v1.Volume, 0)
+	for _, vol := range podTemplate.Spec.Volumes {
+		if !existsInList(secrets, vol.Name) && !existsInList(configmap, vol.Name) && vol.Name != tmpVolumeName && vol.Name != lifecycleVolumeName && vol.Name != errorPagesVolumeName &&
+			!strings.HasPrefix(vol.Name, pathCredentialsVolumePrefix) {
+			volumes = append(volumes, vol)
 		}
 	}
-	return deployments
+	podTemplate.Spec.Volumes = volumes
+}
+
+func removeInjectedMetadata(objectMeta *metav1.ObjectMeta) {
+	if objectMeta.Annotations != nil {
+		delete(objectMeta.Annotations, ExternallyManaged)
+		delete(objectMeta.Annotations, InjectedByAnnotation)
+	}
+	if objectMeta.Labels != nil {
+		delete(objectMeta.Labels, basicAuthenticatorNameLabel)
+	}
+}
+
+// getInjectedVolumeNames returns the names of the secret and extra volumes mounted into the injected sidecar
+func getInjectedVolumeNames(basicAuthenticator *v1alpha1.BasicAuthenticator, credentialName string) []string {
+	volumes := []string{credentialName}
+	if basicAuthenticator.Spec.TLS != nil {
+		volumes = append(volumes, basicAuthenticator.Spec.TLS.SecretName)
+	}
+	return append(volumes, getExtraVolumeNames(basicAuthenticator)...)
+}
+
+func getExtraVolumeNames(basicAuthenticator *v1alpha1.BasicAuthenticator) []string {
+	names := make([]string, 0, len(basicAuthenticator.Spec.ExtraVolumes))
+	for _, volume := range basicAuthenticator.Spec.ExtraVolumes {
+		names = append(names, volume.Name)
+	}
+	return names
 }
 
 func existsInList(strList []string, targetStr string) bool {
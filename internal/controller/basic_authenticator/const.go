@@ -1,29 +1,245 @@
 package basic_authenticator
 
+import "time"
+
 const (
-	nginxDefaultImageAddress    = "nginx:1.25.3"
+	nginxDefaultImageAddress    = "nginxinc/nginx-unprivileged:1.25.3"
+	nginxDefaultUID             = 101
+	reloaderDefaultImageAddress = "busybox:1.36"
+	reloaderContainerName       = "config-reloader"
 	nginxDefaultContainerName   = "nginx"
 	basicAuthenticatorNameLabel = "basicauthenticator.snappcloud.io/name"
 	basicAuthenticatorFinalizer = "basicauthenticator.snappcloud.io/finalizer"
 	ExternallyManaged           = "basicauthenticator.snappcloud.io/externally.managed"
+	RotatedAtAnnotation         = "basicauthenticator.snappcloud.io/rotated-at"
+	GeneratedAtAnnotation       = "basicauthenticator.snappcloud.io/generated-at"
+	ConfigChecksumAnnotation    = "basicauthenticator.snappcloud.io/config-checksum"
+	InjectAnnotation            = "basicauthenticator.snappcloud.io/inject"
+	InjectedByAnnotation        = "basicauthenticator.snappcloud.io/injected-by"
+	DryRunAnnotation            = "authenticator.snappcloud.io/dry-run"
+	SuspendAnnotation           = "authenticator.snappcloud.io/suspend"
+	RotateAnnotation            = "authenticator.snappcloud.io/rotate"
+	RotationPolicyLabel         = "basicauthenticator.snappcloud.io/rotation-policy"
 	ConfigMountPath             = "/etc/nginx/conf.d"
 	SecretMountDir              = "/etc/secret"
 	SecretMountPath             = "/etc/secret/htpasswd"
+	SecretUsernameField         = "username"
+	SecretPasswordField         = "password"
 	SecretHtpasswdField         = "htpasswd"
+	SecretHtdigestField         = "htdigest"
+	DigestSecretMountPath       = "/etc/secret/htdigest"
+	TLSMountDir                 = "/etc/nginx/tls"
+	TmpMountPath                = "/tmp"
+	tmpVolumeName               = "authenticator-tmp"
+	LifecycleMountDir           = "/var/run/basicauthenticator"
+	LifecycleDoneFile           = LifecycleMountDir + "/done"
+	lifecycleVolumeName         = "authenticator-lifecycle"
+	ErrorPagesMountDir          = "/etc/nginx/error-pages"
+	errorPagesVolumeName        = "authenticator-error-pages"
+	errorPagesLocation          = "/_authenticator_errors/"
+	httpsServicePort            = 443
+	defaultPasswordLength       = 20
+	defaultWorkerProcesses      = "auto"
+	defaultWorkerConnections    = 1024
+	authRealm                   = "basic authentication area"
+	// MainConfigKey holds the main nginx configuration when Spec.Tuning is set. It does not end with .conf,
+	// so the default nginx.conf of the image, which includes conf.d/*.conf in its http block, does not pick it up
+	MainConfigKey = "nginx.main"
 	//TODO: maybe using better templating?
-	template = `server {
-	listen AUTHENTICATOR_PORT;
-	location / {
-		auth_basic	"basic authentication area";
-		auth_basic_user_file "FILE_PATH";
-		proxy_pass http://APP_SERVICE:APP_PORT;
+	template = `LOG_FORMATUPSTREAM_BLOCKserver {
+	listen AUTHENTICATOR_PORT;TLS_DIRECTIVESLOG_DIRECTIVESCOMPRESSIONERROR_PAGESLOCATIONS
+}`
+	// jsonLogFormat is placed into template when Spec.Logging.Format is json. conf.d is included in the http block,
+	// where log_format is allowed
+	jsonLogFormat = `log_format ` + jsonLogFormatName + ` escape=json '{"time":"$time_iso8601","remote_addr":"$remote_addr",'
+	'"remote_user":"$remote_user","request_method":"$request_method","request_uri":"$request_uri","status":$status,'
+	'"body_bytes_sent":$body_bytes_sent,"request_time":$request_time,"http_user_agent":"$http_user_agent",'
+	'"upstream_status":"$upstream_status"}';
+`
+	jsonLogFormatName = "authenticator_json"
+	// upstreamName names the upstream block placed into template when more than one of Spec.Upstreams is set
+	upstreamName  = "authenticator_upstream"
+	accessLogPath = "/var/log/nginx/access.log"
+	errorLogPath  = "/var/log/nginx/error.log"
+	// locationTemplate is placed into template once for each location, the root location coming first
+	locationTemplate = `
+	location LOCATION_PATH {AUTH_DIRECTIVES
+		proxy_pass http://UPSTREAM_ADDRESS;PROXY_HEADERSPROXY_TUNING
+	}`
+	authDirectives = `
+		auth_basic	"` + authRealm + `";
+		auth_basic_user_file "FILE_PATH";`
+	// publicAuthDirectives turns basic auth off in the locations of Spec.PublicPaths
+	publicAuthDirectives = `
+		auth_basic off;`
+	// digestAuthDirectives and publicDigestAuthDirectives replace the basic auth ones when Spec.AuthType is digest.
+	// The realm is part of the hashes in the htdigest file, so it has to match the one they were generated with
+	digestAuthDirectives = `
+		auth_digest	"` + authRealm + `";
+		auth_digest_user_file "FILE_PATH";`
+	publicDigestAuthDirectives = `
+		auth_digest off;`
+	// errorPagesTemplate is placed into template when Spec.ErrorPages is set, following an error_page directive for each
+	// page. The location is internal, so the pages are only served in place of an error, and carries no auth directives
+	errorPagesTemplate = `
+	location ^~ ` + errorPagesLocation + ` {
+		internal;
+		alias ` + ErrorPagesMountDir + `/;
+	}`
+	// mainTemplate mirrors the default nginx.conf of the nginx-unprivileged image, with the worker directives filled in
+	mainTemplate = `worker_processes WORKER_PROCESSES;
+error_log /var/log/nginx/error.log notice;
+pid /tmp/nginx.pid;
+
+events {
+	worker_connections WORKER_CONNECTIONS;
+}
+
+http {
+	include /etc/nginx/mime.types;
+	default_type application/octet-stream;
+	sendfile on;
+	keepalive_timeout 65;
+	include ` + ConfigMountPath + `/*.conf;
+}`
+	// proxyHeaders is placed into template unless disabled in the operator config. $scheme is https on the TLS listener,
+	// so X-Forwarded-Proto stays correct when TLS is terminated at nginx
+	proxyHeaders = `
 		proxy_set_header Host $host;
 		proxy_set_header X-Real-IP $remote_addr;
 		proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
-		proxy_set_header X-Forwarded-Proto $scheme;
-	}
-}`
+		proxy_set_header X-Forwarded-Proto $scheme;`
+	// stripAuthHeader keeps the basic auth credentials from reaching the upstream when Spec.StripAuthHeader is set
+	stripAuthHeader = `
+		proxy_set_header Authorization "";`
+	// tlsDirectives is placed into template when Spec.TLS is set
+	tlsDirectives = `
+	listen TLS_PORT ssl;
+	ssl_certificate "CERT_PATH";
+	ssl_certificate_key "KEY_PATH";`
+	// reloaderScript sends nginx a SIGHUP, which reloads its configuration gracefully, whenever a mounted file changes.
+	// It relies on the pod sharing its process namespace.
+	reloaderScript = `while true; do
+	checksum=$(cat ` + ConfigMountPath + `/* ` + SecretMountDir + `/* ` + TLSMountDir + `/* 2>/dev/null | md5sum)
+	if [ -n "$last" ] && [ "$checksum" != "$last" ]; then
+		pkill -HUP -f "nginx: master" && echo "nginx reloaded"
+	fi
+	last=$checksum
+	sleep 5
+done`
+	// batchSidecarScript runs nginx until the job's containers create LifecycleDoneFile, so the sidecar does not keep
+	// the job's pods running after they are done. The nginx command line is passed as the script's arguments.
+	batchSidecarScript = `"$@" &
+nginx_pid=$!
+while kill -0 "$nginx_pid" 2>/dev/null && [ ! -f ` + LifecycleDoneFile + ` ]; do
+	sleep 1
+done
+kill -TERM "$nginx_pid" 2>/dev/null
+wait "$nginx_pid"`
 	StatusAvailable   = "Available"
 	StatusReconciling = "Reconciling"
 	StatusDeleting    = "Deleting"
+	StatusDegraded    = "Degraded"
+	StatusPlanned     = "Planned"
+	StatusConfigOnly  = "ConfigOnly"
+
+	ConditionTypeCredentialsValid     = "CredentialsValid"
+	ConditionReasonCredentialsValid   = "Valid"
+	ConditionReasonMalformedHtpasswd  = "MalformedHtpasswd"
+	ConditionReasonSecretNameConflict = "SecretNameConflict"
+	ConditionReasonSecretMissing      = "SecretMissing"
+	ConditionReasonSecretMalformed    = "SecretMalformed"
+
+	ConditionTypeCredentialsExpired = "CredentialsExpired"
+	ConditionReasonMaxAgeExceeded   = "MaxAgeExceeded"
+	ConditionReasonWithinMaxAge     = "WithinMaxAge"
+
+	ConditionTypeUpstreamAvailable     = "UpstreamAvailable"
+	ConditionReasonUpstreamAvailable   = "Available"
+	ConditionReasonUpstreamUnavailable = "UpstreamUnavailable"
+	upstreamRetryInterval              = 30 * time.Second
+
+	baseRequeueDelay = time.Second
+	maxRequeueDelay  = 5 * time.Minute
+
+	// cacheSyncCheckTimeout bounds how long a health check waits for the caches, so a probe never hangs while they sync
+	cacheSyncCheckTimeout = time.Second
+
+	defaultEstablishTimeout = 10 * time.Second
+	establishPollInterval   = 200 * time.Millisecond
+
+	defaultProgressRequeueInterval = 15 * time.Second
+	maxSecretNameAttempts          = 3
+	defaultMaxConcurrentReconciles = 1
+
+	defaultIngressControllerNamespace = "ingress-nginx"
+	defaultTargetCPUUtilization       = 80
+
+	ConditionTypeConfigTemplateValid         = "ConfigTemplateValid"
+	ConditionReasonConfigTemplateRendered    = "Rendered"
+	ConditionReasonConfigTemplateNotFound    = "TemplateNotFound"
+	ConditionReasonConfigTemplateRenderError = "RenderError"
+
+	ConditionTypeErrorPagesValid        = "ErrorPagesValid"
+	ConditionReasonErrorPagesFound      = "Found"
+	ConditionReasonErrorPagesNotFound   = "ConfigMapNotFound"
+	ConditionReasonErrorPageKeyNotFound = "PageNotFound"
+
+	ConditionTypePathCredentialsValid = "PathCredentialsValid"
+
+	ConditionTypeAuthTypeSupported    = "AuthTypeSupported"
+	ConditionReasonDigestImageMissing = "DigestImageMissing"
+
+	ConditionTypeReady             = "Ready"
+	ConditionReasonAllTargetsReady = "AllTargetsReady"
+	ConditionReasonTargetsNotReady = "TargetsNotReady"
+	ConditionReasonNoTargets       = "NoTargets"
+	ConditionReasonConfigOnly      = "ConfigOnly"
+
+	ConditionTypeSuspended   = "Suspended"
+	ConditionReasonSuspended = "SuspendAnnotation"
+
+	ConditionTypeNamespaceNotAllowed = "NamespaceNotAllowed"
+	ConditionReasonNotInAllowlist    = "NotInAllowedNamespaces"
+
+	ConditionTypeInjectionConflict = "InjectionConflict"
+	ConditionReasonAlreadyInjected = "AlreadyInjected"
+	// ConditionReasonContainerNameCollision is set when a workload has its own container named like the sidecar,
+	// which can be avoided by setting webserver.container_name in the operator's config
+	ConditionReasonContainerNameCollision = "ContainerNameCollision"
+
+	// ConditionTypeDriftDetected is set once the sidecar of an injected deployment was found removed or altered by someone else
+	ConditionTypeDriftDetected     = "DriftDetected"
+	ConditionReasonSidecarRepaired = "SidecarRepaired"
+	ConditionReasonNoDrift         = "NoDrift"
+
+	ConditionTypeRouteReady            = "RouteReady"
+	ConditionReasonRouteCreated        = "Created"
+	ConditionReasonRouteAPIUnavailable = "RouteAPIUnavailable"
+
+	EventReasonSidecarInjected = "SidecarInjected"
+	EventReasonSidecarRemoved  = "SidecarRemoved"
+	EventReasonPlannedChange   = "PlannedChange"
+	EventReasonDriftDetected   = "DriftDetected"
+	EventReasonSelectorIgnored = "SelectorIgnored"
+
+	AuditActionCredentialsGenerated = "CredentialsGenerated"
+	AuditActionCredentialsRotated   = "CredentialsRotated"
+	AuditActionSidecarInjected      = "SidecarInjected"
+	AuditActionSidecarRemoved       = "SidecarRemoved"
+	AuditActionSidecarRepaired      = "SidecarRepaired"
+
+	// the startup probe gives nginx up to startupProbePeriodSeconds * startupProbeFailureThreshold seconds to find valid
+	// credentials and config before the pod is restarted
+	startupProbePeriodSeconds    = 2
+	startupProbeFailureThreshold = 30
+
+	defaultTerminationGracePeriodSeconds = 30
+	// preStopDelaySeconds is how long nginx keeps accepting requests once the pod is terminating, so it is removed from the
+	// endpoints before it stops listening
+	preStopDelaySeconds = 5
+
+	// the secret of each path credential is mounted in a directory of PathCredentialsMountDir named after it
+	PathCredentialsMountDir     = "/etc/secret-paths"
+	pathCredentialsVolumePrefix = "authenticator-path-credentials-"
 )
@@ -0,0 +1,262 @@
+package basic_authenticator
+
+import (
+	"context"
+	"fmt"
+	"github.com/opdev/subreconciler"
+	"github.com/snapp-incubator/simple-authenticator/api/v1alpha1"
+	"github.com/snapp-incubator/simple-authenticator/internal/config"
+	"github.com/snapp-incubator/simple-authenticator/pkg/random_generator"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"reflect"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Plan computes the changes Provision would make to the secret, configmap, deployment and injected workloads of a
+// basicAuthenticator annotated with DryRunAnnotation. They are reported in Status.PlannedChanges and as events,
+// and nothing but the basicAuthenticator's status is written.
+func (r *BasicAuthenticatorReconciler) Plan(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	subPlanners := []subreconciler.FnWithRequest{
+		r.planSecret,
+		r.planConfigmap,
+		r.planDeployment,
+		r.recordPlannedChanges,
+	}
+	for _, planner := range subPlanners {
+		result, err := planner(ctx, req)
+		if subreconciler.ShouldHaltOrRequeue(result, err) {
+			return subreconciler.Evaluate(result, err)
+		}
+	}
+
+	r.resetBackoff(req)
+	return subreconciler.Evaluate(subreconciler.DoNotRequeue())
+}
+
+func isDryRun(basicAuthenticator *v1alpha1.BasicAuthenticator) bool {
+	return basicAuthenticator.Annotations[DryRunAnnotation] == "true"
+}
+
+func (r *BasicAuthenticatorReconciler) planChange(format string, args ...interface{}) {
+	r.plannedChanges = append(r.plannedChanges, fmt.Sprintf(format, args...))
+}
+
+func (r *BasicAuthenticatorReconciler) planSecret(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	r.credentialName = basicAuthenticator.Spec.CredentialsSecretRef
+	if r.credentialName == "" {
+		ownedSecret, err := r.getOwnedCredentials(ctx, basicAuthenticator)
+		if err != nil {
+			r.logger.Error(err, "failed to fetch owned secrets")
+			return subreconciler.RequeueWithError(err)
+		}
+		if ownedSecret == nil {
+			newSecret, err := createCredentials(basicAuthenticator)
+			if err != nil {
+				r.logger.Error(err, "failed to create credentials")
+				return subreconciler.RequeueWithError(err)
+			}
+			r.credentialName = newSecret.Name
+			r.planChange("create secret %s with generated credentials", newSecret.Name)
+			return subreconciler.ContinueReconciling()
+		}
+		r.credentialName = ownedSecret.Name
+		if _, requested := getRequestedRotationToken(basicAuthenticator, ownedSecret); requested || r.isRotationDue(basicAuthenticator, ownedSecret) {
+			r.planChange("rotate the credentials of secret %s", ownedSecret.Name)
+		}
+		return subreconciler.ContinueReconciling()
+	}
+
+	var credentialSecret corev1.Secret
+	err := r.Get(ctx, types.NamespacedName{Name: r.credentialName, Namespace: basicAuthenticator.Namespace}, &credentialSecret)
+	if errors.IsNotFound(err) {
+		r.planChange("wait for secret %s, which does not exist", r.credentialName)
+	} else if err != nil {
+		r.logger.Error(err, "failed to fetch secret")
+		return subreconciler.RequeueWithError(err)
+	} else if !isHtpasswdOnlySecret(&credentialSecret, basicAuthenticator) && !hasCredentialFields(&credentialSecret, basicAuthenticator) {
+		r.planChange("wait for the credentials, as %s", getMissingCredentialsMessage(r.credentialName, basicAuthenticator))
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+func (r *BasicAuthenticatorReconciler) planConfigmap(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	r.configMapName = random_generator.GenerateRandomName(basicAuthenticator.Name, "configmap")
+	configTemplate, _, err := r.getConfigTemplate(ctx, basicAuthenticator)
+	if err != nil {
+		r.planChange("keep configmap %s, as the config template is invalid: %s", r.configMapName, err)
+		return subreconciler.ContinueReconciling()
+	}
+	authenticatorConfig, err := createNginxConfigmap(basicAuthenticator, configTemplate, getEffectiveConfig(r.CustomConfig, basicAuthenticator))
+	if err != nil {
+		r.planChange("keep configmap %s, as the config template is invalid: %s", r.configMapName, err)
+		return subreconciler.ContinueReconciling()
+	}
+	r.configChecksum = getConfigChecksum(authenticatorConfig.Data)
+
+	var foundConfigmap corev1.ConfigMap
+	err = r.Get(ctx, types.NamespacedName{Name: authenticatorConfig.Name, Namespace: basicAuthenticator.Namespace}, &foundConfigmap)
+	if errors.IsNotFound(err) {
+		r.planChange("create configmap %s", authenticatorConfig.Name)
+	} else if err != nil {
+		r.logger.Error(err, "failed to fetch configmap")
+		return subreconciler.RequeueWithError(err)
+	} else if !reflect.DeepEqual(authenticatorConfig.Data, foundConfigmap.Data) {
+		r.planChange("update the nginx config in configmap %s", authenticatorConfig.Name)
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+func (r *BasicAuthenticatorReconciler) planDeployment(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	customConfig := getEffectiveConfig(r.CustomConfig, basicAuthenticator)
+	if basicAuthenticator.Spec.Type == "sidecar" {
+		return r.planInjection(ctx, basicAuthenticator, customConfig)
+	}
+
+	newDeployment := createNginxDeployment(basicAuthenticator, r.configMapName, r.configChecksum, r.credentialName, customConfig)
+	foundDeployment := &appv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: newDeployment.Name, Namespace: basicAuthenticator.Namespace}, foundDeployment)
+	if isConfigOnly(basicAuthenticator) {
+		if err == nil {
+			r.planChange("delete deployment %s, as manageDeployment is disabled", foundDeployment.Name)
+		} else if !errors.IsNotFound(err) {
+			r.logger.Error(err, "failed to fetch deployment")
+			return subreconciler.RequeueWithError(err)
+		}
+		return subreconciler.ContinueReconciling()
+	}
+	if errors.IsNotFound(err) {
+		r.planChange("create deployment %s with %d replicas", newDeployment.Name, *newDeployment.Spec.Replicas)
+		return subreconciler.ContinueReconciling()
+	} else if err != nil {
+		r.logger.Error(err, "failed to fetch deployment")
+		return subreconciler.RequeueWithError(err)
+	}
+	mergedDeployment := foundDeployment.DeepCopy()
+	mergeDeploymentSpec(mergedDeployment, newDeployment)
+	if basicAuthenticator.Spec.AdaptiveScale || basicAuthenticator.Spec.Autoscaling != nil {
+		// the replicas depend on the upstream or the autoscaler, so only the pod template is compared
+		mergedDeployment.Spec.Replicas = foundDeployment.Spec.Replicas
+	}
+	if !reflect.DeepEqual(mergedDeployment.Spec, foundDeployment.Spec) {
+		r.planChange("update deployment %s", foundDeployment.Name)
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+// planInjection reports the deployments and cronJobs createSidecarAuthenticator would inject, update or remove the sidecar of
+func (r *BasicAuthenticatorReconciler) planInjection(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, customConfig *config.CustomConfig) (*ctrl.Result, error) {
+	injection, err := injector(ctx, basicAuthenticator, r.configMapName, r.configChecksum, r.credentialName, customConfig, r.Client)
+	if err != nil {
+		r.logger.Error(err, "failed to compute injection")
+		return subreconciler.RequeueWithError(err)
+	}
+	injected := make([]string, 0, len(injection.injected))
+	for _, deploy := range injection.injected {
+		injected = append(injected, deploy.Name)
+		r.planChange("inject the sidecar into deployment %s", deploy.Name)
+	}
+	for _, deploy := range injection.updated {
+		if !existsInList(injected, deploy.Name) {
+			r.planChange("update the sidecar of deployment %s", deploy.Name)
+		}
+	}
+	for _, deploy := range injection.optedOut {
+		r.planChange("remove the sidecar from deployment %s, which opted out of injection", deploy.Name)
+	}
+	selected := make([]string, 0, len(injection.all))
+	for _, deploy := range injection.all {
+		selected = append(selected, deploy.Name)
+	}
+	for _, name := range basicAuthenticator.Status.InjectedDeployments {
+		if !existsInList(selected, name) {
+			r.planChange("remove the sidecar from deployment %s, which is no longer selected", name)
+		}
+	}
+	injectedCronJobs := make([]string, 0, len(injection.injectedCronJobs))
+	for _, cronJob := range injection.injectedCronJobs {
+		injectedCronJobs = append(injectedCronJobs, cronJob.Name)
+		r.planChange("inject the sidecar into cronjob %s", cronJob.Name)
+	}
+	for _, cronJob := range injection.cronJobs {
+		if !existsInList(injectedCronJobs, cronJob.Name) {
+			r.planChange("update the sidecar of cronjob %s", cronJob.Name)
+		}
+	}
+	for _, cronJob := range injection.staleCronJobs {
+		r.planChange("remove the sidecar from cronjob %s", cronJob.Name)
+	}
+	for _, deploy := range injection.conflicting {
+		r.planChange("skip deployment %s, which is already injected by BasicAuthenticator %s", deploy.Name, deploy.Annotations[InjectedByAnnotation])
+	}
+	for _, collision := range injection.collisions {
+		r.planChange("skip %s, which already has a container named %s", collision, getNginxContainerName(customConfig))
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+// recordPlannedChanges patches the planned changes into the status, emitting them as events only when the plan changes
+func (r *BasicAuthenticatorReconciler) recordPlannedChanges(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	if basicAuthenticator.Status.State == StatusPlanned &&
+		(reflect.DeepEqual(basicAuthenticator.Status.PlannedChanges, r.plannedChanges) ||
+			(len(basicAuthenticator.Status.PlannedChanges) == 0 && len(r.plannedChanges) == 0)) {
+		return subreconciler.ContinueReconciling()
+	}
+	for _, change := range r.plannedChanges {
+		r.Recorder.Event(basicAuthenticator, corev1.EventTypeNormal, EventReasonPlannedChange, change)
+	}
+	if len(r.plannedChanges) == 0 {
+		r.Recorder.Event(basicAuthenticator, corev1.EventTypeNormal, EventReasonPlannedChange, "no changes planned")
+	}
+	patch := client.MergeFrom(basicAuthenticator.DeepCopy())
+	basicAuthenticator.Status.State = StatusPlanned
+	basicAuthenticator.Status.PlannedChanges = r.plannedChanges
+	if err := r.Status().Patch(ctx, basicAuthenticator, patch); err != nil {
+		r.logger.Error(err, "failed to update planned changes")
+		return subreconciler.RequeueWithError(err)
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+// clearPlannedChanges removes the planned changes and state left in the status once the dry-run annotation is removed
+func (r *BasicAuthenticatorReconciler) clearPlannedChanges(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	if len(basicAuthenticator.Status.PlannedChanges) == 0 && basicAuthenticator.Status.State != StatusPlanned {
+		return subreconciler.ContinueReconciling()
+	}
+	patch := client.MergeFrom(basicAuthenticator.DeepCopy())
+	basicAuthenticator.Status.State = StatusReconciling
+	basicAuthenticator.Status.PlannedChanges = nil
+	if err := r.Status().Patch(ctx, basicAuthenticator, patch); err != nil {
+		r.logger.Error(err, "failed to clear planned changes")
+		return subreconciler.RequeueWithError(err)
+	}
+	return subreconciler.ContinueReconciling()
+}
@@ -0,0 +1,102 @@
+package basic_authenticator
+
+import (
+	"context"
+	"github.com/snapp-incubator/simple-authenticator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"strings"
+	"testing"
+)
+
+func TestDryRunPlansInjectionWithoutApplying(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "basicauthenticator-plan",
+			Namespace:   "default",
+			Annotations: map[string]string{DryRunAnnotation: "true"},
+		},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "sidecar",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			Selector:          metav1.LabelSelector{MatchLabels: map[string]string{"app": "target"}},
+		},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "target", Namespace: "default", Labels: map[string]string{"app": "target"}},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+			},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, deployment)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	deploymentKey := types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest.Status.State != StatusPlanned {
+		t.Errorf("expected state %s, got %q", StatusPlanned, latest.Status.State)
+	}
+	plan := strings.Join(latest.Status.PlannedChanges, "\n")
+	for _, change := range []string{"create secret", "create configmap", "inject the sidecar into deployment target"} {
+		if !strings.Contains(plan, change) {
+			t.Errorf("expected %q to be planned, got:\n%s", change, plan)
+		}
+	}
+	if len(recorder.Events) != len(latest.Status.PlannedChanges) {
+		t.Errorf("expected an event for each of the %d planned changes, got %d", len(latest.Status.PlannedChanges), len(recorder.Events))
+	}
+	var secrets corev1.SecretList
+	if err := k8sClient.List(ctx, &secrets); err != nil {
+		t.Fatal(err)
+	}
+	var configMaps corev1.ConfigMapList
+	if err := k8sClient.List(ctx, &configMaps); err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets.Items) != 0 || len(configMaps.Items) != 0 {
+		t.Errorf("expected nothing to be created in dry run, got %d secrets and %d configmaps", len(secrets.Items), len(configMaps.Items))
+	}
+	target := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, deploymentKey, target); err != nil {
+		t.Fatal(err)
+	}
+	if len(target.Spec.Template.Spec.Containers) != 1 || len(latest.Finalizers) != 0 {
+		t.Errorf("expected the deployment and the basic authenticator to be left untouched in dry run")
+	}
+
+	delete(latest.Annotations, DryRunAnnotation)
+	if err := k8sClient.Update(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Get(ctx, deploymentKey, target); err != nil {
+		t.Fatal(err)
+	}
+	if getContainerIndex(target.Spec.Template.Spec.Containers, nginxDefaultContainerName) == -1 {
+		t.Error("expected the sidecar to be injected once the dry-run annotation is removed")
+	}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	if len(latest.Status.PlannedChanges) != 0 {
+		t.Errorf("expected the planned changes to be cleared, got %v", latest.Status.PlannedChanges)
+	}
+}
@@ -3,17 +3,31 @@ package basic_authenticator
 import (
 	"context"
 	defaultError "errors"
+	"fmt"
 	"github.com/opdev/subreconciler"
 	"github.com/snapp-incubator/simple-authenticator/api/v1alpha1"
+	"github.com/snapp-incubator/simple-authenticator/pkg/htpasswd"
+	"github.com/snapp-incubator/simple-authenticator/pkg/random_generator"
 	appv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"math"
+	"net"
 	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sort"
+	"strings"
+	"time"
 )
 
 // Provision provisions the required resources for the basicAuthenticator object
@@ -21,11 +35,25 @@ func (r *BasicAuthenticatorReconciler) Provision(ctx context.Context, req ctrl.R
 	// Do the actual reconcile work
 	subProvisioner := []subreconciler.FnWithRequest{
 		r.setReconcilingStatus,
+		r.clearPlannedChanges,
 		r.addCleanupFinalizer,
+		r.validateAuthType,
+		r.validateErrorPages,
 		r.ensureSecret,
+		r.waitForSecret,
+		r.ensurePathCredentials,
 		r.ensureConfigmap,
+		r.waitForConfigmap,
 		r.ensureDeployment,
+		r.waitForDeployment,
 		r.ensureService,
+		r.ensureIngress,
+		r.ensureRoute,
+		r.ensureNetworkPolicies,
+		r.ensurePodDisruptionBudget,
+		r.ensureHorizontalPodAutoscaler,
+		r.validateUpstream,
+		r.setManagedResources,
 		r.setAvailableStatus,
 	}
 	for _, provisioner := range subProvisioner {
@@ -35,6 +63,10 @@ func (r *BasicAuthenticatorReconciler) Provision(ctx context.Context, req ctrl.R
 		}
 	}
 
+	r.resetBackoff(req)
+	if r.requeueAfter > 0 {
+		return subreconciler.Evaluate(subreconciler.RequeueWithDelay(r.requeueAfter))
+	}
 	return subreconciler.Evaluate(subreconciler.DoNotRequeue())
 }
 func (r *BasicAuthenticatorReconciler) setReconcilingStatus(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
@@ -47,7 +79,7 @@ func (r *BasicAuthenticatorReconciler) setReconcilingStatus(ctx context.Context,
 	basicAuthenticator.Status.State = StatusReconciling
 	if err := r.Update(ctx, basicAuthenticator); err != nil {
 		r.logger.Error(err, "failed to update status")
-		return subreconciler.Requeue()
+		return r.requeueWithBackoff(req)
 	}
 	return subreconciler.ContinueReconciling()
 }
@@ -62,13 +94,153 @@ func (r *BasicAuthenticatorReconciler) addCleanupFinalizer(ctx context.Context,
 		if objUpdated := controllerutil.AddFinalizer(basicAuthenticator, basicAuthenticatorFinalizer); objUpdated {
 			if err := r.Update(ctx, basicAuthenticator); err != nil {
 				r.logger.Error(err, "failed to add basicAuthenticator finalizer")
-				return subreconciler.Requeue()
+				return r.requeueWithBackoff(req)
+			}
+		}
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+// validateAuthType stops provisioning a digest auth basicAuthenticator until an image with the auth_digest module is configured
+func (r *BasicAuthenticatorReconciler) validateAuthType(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	if isDigestAuth(basicAuthenticator) && getEffectiveConfig(r.CustomConfig, basicAuthenticator).WebserverConf.Image == "" {
+		message := "digest auth needs webserver.digest_image in the operator config or configOverrides.image to be an nginx image with the auth_digest module"
+		r.logger.Info(message)
+		if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeAuthTypeSupported, metav1.ConditionFalse, ConditionReasonDigestImageMissing, message); err != nil {
+			r.logger.Error(err, "failed to update auth type condition")
+			return subreconciler.RequeueWithError(err)
+		}
+		// a change of the operator config triggers a new reconcile
+		return subreconciler.DoNotRequeue()
+	}
+	if err := r.removeCondition(ctx, basicAuthenticator, ConditionTypeAuthTypeSupported); err != nil {
+		r.logger.Error(err, "failed to update auth type condition")
+		return subreconciler.RequeueWithError(err)
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+// validateErrorPages stops provisioning until the ConfigMap of Spec.ErrorPages holds each of the pages, as pods mounting
+// a missing key would not start
+func (r *BasicAuthenticatorReconciler) validateErrorPages(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	errorPages := basicAuthenticator.Spec.ErrorPages
+	if errorPages == nil {
+		if err := r.removeCondition(ctx, basicAuthenticator, ConditionTypeErrorPagesValid); err != nil {
+			r.logger.Error(err, "failed to update error pages condition")
+			return subreconciler.RequeueWithError(err)
+		}
+		return subreconciler.ContinueReconciling()
+	}
+	var pagesConfigmap corev1.ConfigMap
+	err := r.Get(ctx, types.NamespacedName{Name: errorPages.ConfigMapName, Namespace: basicAuthenticator.Namespace}, &pagesConfigmap)
+	if errors.IsNotFound(err) {
+		return r.setErrorPagesInvalid(ctx, basicAuthenticator, ConditionReasonErrorPagesNotFound, fmt.Sprintf("configmap %s not found", errorPages.ConfigMapName))
+	}
+	if err != nil {
+		r.logger.Error(err, "failed to fetch error pages configmap")
+		return subreconciler.RequeueWithError(err)
+	}
+	for _, page := range errorPages.Pages {
+		if _, exists := pagesConfigmap.Data[page.Key]; !exists {
+			message := fmt.Sprintf("configmap %s has no %s key for error page %d", errorPages.ConfigMapName, page.Key, page.Code)
+			return r.setErrorPagesInvalid(ctx, basicAuthenticator, ConditionReasonErrorPageKeyNotFound, message)
+		}
+	}
+	if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeErrorPagesValid, metav1.ConditionTrue, ConditionReasonErrorPagesFound, "error pages found"); err != nil {
+		r.logger.Error(err, "failed to update error pages condition")
+		return subreconciler.RequeueWithError(err)
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+func (r *BasicAuthenticatorReconciler) setErrorPagesInvalid(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, reason string, message string) (*ctrl.Result, error) {
+	r.logger.Info(message)
+	if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeErrorPagesValid, metav1.ConditionFalse, reason, message); err != nil {
+		r.logger.Error(err, "failed to update error pages condition")
+		return subreconciler.RequeueWithError(err)
+	}
+	// the referenced configmap is watched, so fixing it triggers a new reconcile
+	return subreconciler.DoNotRequeue()
+}
+
+// ensurePathCredentials checks the secret of each path credential holds credentials nginx can use. The htpasswd file of
+// a secret with a username and password is written into it, like it is for the credentials secret.
+func (r *BasicAuthenticatorReconciler) ensurePathCredentials(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	if len(basicAuthenticator.Spec.PathCredentials) == 0 {
+		if err := r.removeCondition(ctx, basicAuthenticator, ConditionTypePathCredentialsValid); err != nil {
+			r.logger.Error(err, "failed to update path credentials condition")
+			return subreconciler.RequeueWithError(err)
+		}
+		return subreconciler.ContinueReconciling()
+	}
+	keys := credentialsSecretKeys{username: SecretUsernameField, password: SecretPasswordField, htpasswd: SecretHtpasswdField}
+	for _, secretName := range getPathCredentialsSecretNames(basicAuthenticator) {
+		var secret corev1.Secret
+		err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: basicAuthenticator.Namespace}, &secret)
+		if errors.IsNotFound(err) {
+			return r.setPathCredentialsInvalid(ctx, basicAuthenticator, ConditionReasonSecretMissing, fmt.Sprintf("secret %s does not exist", secretName))
+		}
+		if err != nil {
+			r.logger.Error(err, "failed to fetch path credentials secret")
+			return subreconciler.RequeueWithError(err)
+		}
+		_, hasUsername := secret.Data[SecretUsernameField]
+		_, hasPassword := secret.Data[SecretPasswordField]
+		_, hasHtpasswd := secret.Data[SecretHtpasswdField]
+		switch {
+		case hasUsername && hasPassword:
+			if isHtpasswdFieldCurrent(&secret, keys) {
+				continue
+			}
+			if err := updateHtpasswdField(&secret, keys); err != nil {
+				r.logger.Error(err, "failed to update path credentials secret to include htpasswd")
+				return subreconciler.RequeueWithError(err)
+			}
+			if err := r.Update(ctx, &secret); err != nil {
+				r.logger.Error(err, "failed to update path credentials secret")
+				return subreconciler.RequeueWithError(err)
+			}
+		case hasHtpasswd && !hasUsername && !hasPassword:
+			if err := htpasswd.ValidateHtpasswd(string(secret.Data[SecretHtpasswdField])); err != nil {
+				return r.setPathCredentialsInvalid(ctx, basicAuthenticator, ConditionReasonMalformedHtpasswd, fmt.Sprintf("secret %s: %s", secretName, err))
 			}
+		default:
+			message := fmt.Sprintf("secret %s should have both %s and %s fields, or only an %s field", secretName, SecretUsernameField, SecretPasswordField, SecretHtpasswdField)
+			return r.setPathCredentialsInvalid(ctx, basicAuthenticator, ConditionReasonSecretMalformed, message)
 		}
 	}
+	if err := r.setCondition(ctx, basicAuthenticator, ConditionTypePathCredentialsValid, metav1.ConditionTrue, ConditionReasonCredentialsValid, "path credentials are valid"); err != nil {
+		r.logger.Error(err, "failed to update path credentials condition")
+		return subreconciler.RequeueWithError(err)
+	}
 	return subreconciler.ContinueReconciling()
 }
 
+func (r *BasicAuthenticatorReconciler) setPathCredentialsInvalid(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, reason string, message string) (*ctrl.Result, error) {
+	r.logger.Info(message)
+	if err := r.setCondition(ctx, basicAuthenticator, ConditionTypePathCredentialsValid, metav1.ConditionFalse, reason, message); err != nil {
+		r.logger.Error(err, "failed to update path credentials condition")
+		return subreconciler.RequeueWithError(err)
+	}
+	// the referenced secrets are watched, so fixing them triggers a new reconcile
+	return subreconciler.DoNotRequeue()
+}
+
 func (r *BasicAuthenticatorReconciler) getLatestBasicAuthenticator(ctx context.Context, req ctrl.Request, basicAuthenticator *v1alpha1.BasicAuthenticator) (*ctrl.Result, error) {
 	err := r.Get(ctx, req.NamespacedName, basicAuthenticator)
 	if err != nil {
@@ -89,66 +261,347 @@ func (r *BasicAuthenticatorReconciler) ensureSecret(ctx context.Context, req ctr
 		return subreconciler.RequeueWithError(err)
 	}
 	r.credentialName = basicAuthenticator.Spec.CredentialsSecretRef
-	var credentialSecret corev1.Secret
 	if r.credentialName == "" {
-		//create secret
-		newSecret, err := createCredentials(basicAuthenticator)
+		// the generated secret is looked up by its owner rather than Status.CredentialsSecretRef,
+		// as the status still names the user provided secret right after credentialsSecretRef is unset
+		ownedSecret, err := r.getOwnedCredentials(ctx, basicAuthenticator)
 		if err != nil {
-			r.logger.Error(err, "failed to create credentials")
+			r.logger.Error(err, "failed to fetch owned secrets")
 			return subreconciler.RequeueWithError(err)
 		}
-		err = updateHtpasswdField(newSecret)
+		if ownedSecret != nil {
+			r.credentialName = ownedSecret.Name
+		}
+	}
+	var credentialSecret corev1.Secret
+	if r.credentialName == "" {
+		//create secret
+		generatedSecret, conflicts, err := r.createGeneratedSecret(ctx, basicAuthenticator)
 		if err != nil {
-			r.logger.Error(err, "failed to update secret to include htpasswd field")
+			r.logger.Error(err, "failed to create generated secret")
 			return subreconciler.RequeueWithError(err)
 		}
-		err = r.Get(ctx, types.NamespacedName{Name: newSecret.Name, Namespace: newSecret.Namespace}, &credentialSecret)
+		if generatedSecret == nil {
+			message := fmt.Sprintf("generated secret names %s are taken by secrets not owned by this BasicAuthenticator", strings.Join(conflicts, ", "))
+			r.logger.Info(message)
+			if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeCredentialsValid, metav1.ConditionFalse, ConditionReasonSecretNameConflict, message); err != nil {
+				r.logger.Error(err, "failed to update credentials condition")
+				return subreconciler.RequeueWithError(err)
+			}
+			// retrying is unlikely to find a free name either, so the next attempt is left to a change of the BasicAuthenticator
+			return subreconciler.DoNotRequeue()
+		}
+		credentialSecret = *generatedSecret
+		r.credentialName = credentialSecret.Name
+	} else {
+		err := r.Get(ctx, types.NamespacedName{Name: r.credentialName, Namespace: basicAuthenticator.Namespace}, &credentialSecret)
 		if errors.IsNotFound(err) {
-			if err := ctrl.SetControllerReference(basicAuthenticator, newSecret, r.Scheme); err != nil {
-				r.logger.Error(err, "failed to set secret owner")
+			message := fmt.Sprintf("secret %s does not exist", r.credentialName)
+			r.logger.Info(message)
+			if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeCredentialsValid, metav1.ConditionFalse, ConditionReasonSecretMissing, message); err != nil {
+				r.logger.Error(err, "failed to update credentials condition")
 				return subreconciler.RequeueWithError(err)
 			}
-
-			// update basic auth
-			err = r.Create(ctx, newSecret)
-			if err != nil {
-				r.logger.Error(err, "failed to create new secret")
+			// the referenced secret is watched, the requeue only covers missing its creation
+			return r.requeueWithBackoff(req)
+		} else if err != nil {
+			r.logger.Error(err, "failed to fetch secret")
+			return subreconciler.RequeueWithError(err)
+		}
+		if !isHtpasswdOnlySecret(&credentialSecret, basicAuthenticator) && !hasCredentialFields(&credentialSecret, basicAuthenticator) {
+			message := getMissingCredentialsMessage(credentialSecret.Name, basicAuthenticator)
+			r.logger.Info(message)
+			if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeCredentialsValid, metav1.ConditionFalse, ConditionReasonSecretMalformed, message); err != nil {
+				r.logger.Error(err, "failed to update credentials condition")
 				return subreconciler.RequeueWithError(err)
 			}
-			r.credentialName = newSecret.Name
-			basicAuthenticator.Spec.CredentialsSecretRef = r.credentialName
-			//saving secretName inorder to be used in next steps
-			err = r.Update(ctx, basicAuthenticator)
-			if err != nil {
-				r.logger.Error(err, "failed to updated basic authenticator")
+			return subreconciler.DoNotRequeue()
+		}
+		if isHtpasswdOnlySecret(&credentialSecret, basicAuthenticator) && isDigestAuth(basicAuthenticator) {
+			message := fmt.Sprintf("secret %s should have username and password fields, as digest auth cannot use an htpasswd file", credentialSecret.Name)
+			r.logger.Info(message)
+			if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeCredentialsValid, metav1.ConditionFalse, ConditionReasonSecretMalformed, message); err != nil {
+				r.logger.Error(err, "failed to update credentials condition")
 				return subreconciler.RequeueWithError(err)
 			}
-			r.logger.Info("debug", "inside credentialName", r.credentialName)
-		} else if err != nil {
-			r.logger.Error(err, "failed to fetch secret with new name")
-			return subreconciler.RequeueWithError(err)
+			return subreconciler.DoNotRequeue()
 		}
-	} else {
-		err := r.Get(ctx, types.NamespacedName{Name: r.credentialName, Namespace: basicAuthenticator.Namespace}, &credentialSecret)
-		if err != nil {
-			r.logger.Error(err, "failed to fetch secret")
-			return subreconciler.RequeueWithError(err)
+		if isHtpasswdOnlySecret(&credentialSecret, basicAuthenticator) {
+			// user provided htpasswd files are used as is, so a malformed entry has to be caught before nginx rejects every login
+			if err := htpasswd.ValidateHtpasswd(string(credentialSecret.Data[getCredentialsSecretKeys(basicAuthenticator).htpasswd])); err != nil {
+				r.logger.Error(err, "user provided htpasswd is malformed", "secret", credentialSecret.Name)
+				if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeCredentialsValid, metav1.ConditionFalse, ConditionReasonMalformedHtpasswd, err.Error()); err != nil {
+					r.logger.Error(err, "failed to update credentials condition")
+					return subreconciler.RequeueWithError(err)
+				}
+				// the referenced secret is watched, so fixing it triggers a new reconcile
+				return subreconciler.DoNotRequeue()
+			}
+			r.credentialName = credentialSecret.Name
+			return r.setCredentialsValid(ctx, basicAuthenticator, &credentialSecret)
+		}
+		original := credentialSecret.DeepCopy()
+		if metav1.IsControlledBy(&credentialSecret, basicAuthenticator) {
+			setRotationPolicyLabel(&credentialSecret, basicAuthenticator)
+		}
+		rotationToken, rotationRequested := getRequestedRotationToken(basicAuthenticator, &credentialSecret)
+		rotate := r.isRotationDue(basicAuthenticator, &credentialSecret) || rotationRequested
+		previousHtpasswd := r.getPreviousHtpasswd(basicAuthenticator)
+		if rotate {
+			if isRotationOverlapped(basicAuthenticator) {
+				// the generated entry comes first, followed by the one of the previous rotation while its window is open
+				previousHtpasswd = strings.SplitN(string(credentialSecret.Data[SecretHtpasswdField]), "\n", 2)[0]
+			}
+			if err := regeneratePassword(&credentialSecret, basicAuthenticator); err != nil {
+				r.logger.Error(err, "failed to regenerate password")
+				return subreconciler.RequeueWithError(err)
+			}
+			setGeneratedAtAnnotation(&credentialSecret, r.now())
+		}
+		// the entry of the previous rotation is appended again below, so only the current one is checked
+		currentHtpasswd := strings.SplitN(string(credentialSecret.Data[SecretHtpasswdField]), "\n", 2)[0]
+		credentialSecret.Data[SecretHtpasswdField] = []byte(currentHtpasswd)
+		// each hash is salted anew, so rehashing current credentials would update the watched secret on every reconcile
+		if rotate || !isCredentialFieldsCurrent(&credentialSecret, basicAuthenticator) {
+			if err := updateCredentialFields(&credentialSecret, basicAuthenticator); err != nil {
+				r.logger.Error(err, "failed to update secret to include credential files")
+				return subreconciler.RequeueWithError(err)
+			}
 		}
-		err = updateHtpasswdField(&credentialSecret)
+		if previousHtpasswd != "" {
+			// the replaced password keeps working until the overlap window closes
+			credentialSecret.Data[SecretHtpasswdField] = []byte(fmt.Sprintf("%s\n%s", credentialSecret.Data[SecretHtpasswdField], previousHtpasswd))
+		}
+		if !reflect.DeepEqual(original, &credentialSecret) {
+			if err := r.Update(ctx, &credentialSecret); err != nil {
+				r.logger.Error(err, "failed to update secret")
+				return subreconciler.RequeueWithError(err)
+			}
+		}
+		if rotate {
+			rotationTime := metav1.NewTime(r.now())
+			basicAuthenticator.Status.LastRotationTime = &rotationTime
+			if rotationRequested {
+				basicAuthenticator.Status.LastRotationToken = rotationToken
+			}
+			setPreviousHtpasswd(basicAuthenticator, previousHtpasswd, r.now())
+			if err := r.Status().Update(ctx, basicAuthenticator); err != nil {
+				r.logger.Error(err, "failed to update last rotation time")
+				return subreconciler.RequeueWithError(err)
+			}
+			r.logger.Info("rotated credentials", "secret", credentialSecret.Name, "requested", rotationRequested)
+			r.audit(basicAuthenticator, AuditActionCredentialsRotated, "Secret", &credentialSecret)
+			if interval := basicAuthenticator.Spec.RotationInterval; interval != nil && interval.Duration > 0 {
+				r.scheduleRequeue(interval.Duration)
+			}
+			if previousHtpasswd != "" {
+				r.scheduleRequeue(basicAuthenticator.Spec.RotationOverlap.Duration)
+			}
+		} else if previousHtpasswd == "" && basicAuthenticator.Status.PreviousHtpasswd != "" {
+			setPreviousHtpasswd(basicAuthenticator, "", r.now())
+			if err := r.Status().Update(ctx, basicAuthenticator); err != nil {
+				r.logger.Error(err, "failed to clear previous htpasswd")
+				return subreconciler.RequeueWithError(err)
+			}
+			r.logger.Info("rotation overlap window closed", "secret", credentialSecret.Name)
+		}
+		r.credentialName = credentialSecret.Name
+	}
+	return r.setCredentialsValid(ctx, basicAuthenticator, &credentialSecret)
+}
+
+// createGeneratedSecret creates a secret with generated credentials for basicAuthenticator. If the generated name is already
+// taken, the secret is reused when it is owned by basicAuthenticator, adopted when it carries its label but has no owner,
+// and otherwise another name is generated. The taken names are returned if no free name is found within maxSecretNameAttempts.
+func (r *BasicAuthenticatorReconciler) createGeneratedSecret(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator) (*corev1.Secret, []string, error) {
+	conflicts := make([]string, 0)
+	for attempt := 0; attempt < maxSecretNameAttempts; attempt++ {
+		newSecret, err := createCredentials(basicAuthenticator)
 		if err != nil {
-			r.logger.Error(err, "failed to update secret to include htpasswd field")
+			return nil, nil, err
+		}
+		if err := updateCredentialFields(newSecret, basicAuthenticator); err != nil {
+			return nil, nil, err
+		}
+		var foundSecret corev1.Secret
+		err = r.Get(ctx, types.NamespacedName{Name: newSecret.Name, Namespace: newSecret.Namespace}, &foundSecret)
+		if errors.IsNotFound(err) {
+			if err := ctrl.SetControllerReference(basicAuthenticator, newSecret, r.Scheme); err != nil {
+				return nil, nil, err
+			}
+			setGeneratedAtAnnotation(newSecret, r.now())
+			if err := r.Create(ctx, newSecret); err != nil {
+				return nil, nil, err
+			}
+			r.audit(basicAuthenticator, AuditActionCredentialsGenerated, "Secret", newSecret)
+			return newSecret, nil, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if metav1.IsControlledBy(&foundSecret, basicAuthenticator) {
+			// the secret was created in a previous reconcile but is not listed by the cache yet
+			return &foundSecret, nil, nil
+		}
+		if metav1.GetControllerOf(&foundSecret) == nil && foundSecret.Labels[basicAuthenticatorNameLabel] == basicAuthenticator.Name {
+			if err := ctrl.SetControllerReference(basicAuthenticator, &foundSecret, r.Scheme); err != nil {
+				return nil, nil, err
+			}
+			if err := updateCredentialFields(&foundSecret, basicAuthenticator); err != nil {
+				return nil, nil, err
+			}
+			if err := r.Update(ctx, &foundSecret); err != nil {
+				return nil, nil, err
+			}
+			r.logger.Info("adopted secret", "secret", foundSecret.Name)
+			return &foundSecret, nil, nil
+		}
+		conflicts = append(conflicts, foundSecret.Name)
+	}
+	return nil, conflicts, nil
+}
+
+// getOwnedCredentials returns the generated credentials secret of basicAuthenticator, or nil if there is none
+func (r *BasicAuthenticatorReconciler) getOwnedCredentials(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator) (*corev1.Secret, error) {
+	var secretList corev1.SecretList
+	if err := r.List(
+		ctx,
+		&secretList,
+		client.MatchingLabels{basicAuthenticatorNameLabel: basicAuthenticator.Name},
+		client.InNamespace(basicAuthenticator.Namespace)); err != nil {
+		return nil, err
+	}
+	for i := range secretList.Items {
+		if metav1.IsControlledBy(&secretList.Items[i], basicAuthenticator) {
+			return &secretList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// setCredentialsSecretRef patches Status.CredentialsSecretRef instead of updating the whole status,
+// so a status written concurrently neither causes a conflict nor gets overwritten by a stale copy.
+// The spec is left to the user, as GitOps tools would revert a generated name written there.
+// basicAuthenticator is updated with the patched object returned by the API server, so the caller never needs to refetch it.
+func (r *BasicAuthenticatorReconciler) setCredentialsSecretRef(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, secretName string) error {
+	patch := client.MergeFrom(basicAuthenticator.DeepCopy())
+	basicAuthenticator.Status.CredentialsSecretRef = secretName
+	return r.Status().Patch(ctx, basicAuthenticator, patch)
+}
+
+// setGeneratedUsername patches Status.GeneratedUsername, like setCredentialsSecretRef does for the secret name
+func (r *BasicAuthenticatorReconciler) setGeneratedUsername(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, username string) error {
+	patch := client.MergeFrom(basicAuthenticator.DeepCopy())
+	basicAuthenticator.Status.GeneratedUsername = username
+	return r.Status().Patch(ctx, basicAuthenticator, patch)
+}
+
+func (r *BasicAuthenticatorReconciler) setCredentialsValid(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, credentialSecret *corev1.Secret) (*ctrl.Result, error) {
+	if basicAuthenticator.Status.CredentialsSecretRef != credentialSecret.Name {
+		if err := r.setCredentialsSecretRef(ctx, basicAuthenticator, credentialSecret.Name); err != nil {
+			r.logger.Error(err, "failed to update credentials secret ref")
 			return subreconciler.RequeueWithError(err)
 		}
-		err = r.Update(ctx, &credentialSecret)
-		if err != nil {
-			r.logger.Error(err, "failed to update secret")
+	}
+	generatedUsername := ""
+	if metav1.IsControlledBy(credentialSecret, basicAuthenticator) {
+		generatedUsername = string(credentialSecret.Data[SecretUsernameField])
+	}
+	if basicAuthenticator.Status.GeneratedUsername != generatedUsername {
+		if err := r.setGeneratedUsername(ctx, basicAuthenticator, generatedUsername); err != nil {
+			r.logger.Error(err, "failed to update generated username")
 			return subreconciler.RequeueWithError(err)
 		}
-		r.credentialName = credentialSecret.Name
+	}
+	if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeCredentialsValid, metav1.ConditionTrue, ConditionReasonCredentialsValid, "credentials are valid"); err != nil {
+		r.logger.Error(err, "failed to update credentials condition")
+		return subreconciler.RequeueWithError(err)
+	}
+	if err := r.checkCredentialAge(ctx, basicAuthenticator, credentialSecret); err != nil {
+		r.logger.Error(err, "failed to update credentials expired condition")
+		return subreconciler.RequeueWithError(err)
 	}
 	return subreconciler.ContinueReconciling()
 }
 
+// checkCredentialAge sets the CredentialsExpired condition once the credentials are older than Spec.MaxCredentialAge
+func (r *BasicAuthenticatorReconciler) checkCredentialAge(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, credentialSecret *corev1.Secret) error {
+	maxAge := basicAuthenticator.Spec.MaxCredentialAge
+	if maxAge == nil || maxAge.Duration <= 0 {
+		return r.removeCondition(ctx, basicAuthenticator, ConditionTypeCredentialsExpired)
+	}
+	generatedAt := getCredentialsGeneratedAt(credentialSecret)
+	age := r.now().Sub(generatedAt)
+	if age >= maxAge.Duration {
+		message := fmt.Sprintf("credentials of secret %s were generated at %s and exceeded the max age of %s", credentialSecret.Name, generatedAt.UTC().Format(time.RFC3339), maxAge.Duration)
+		return r.setCondition(ctx, basicAuthenticator, ConditionTypeCredentialsExpired, metav1.ConditionTrue, ConditionReasonMaxAgeExceeded, message)
+	}
+	r.scheduleRequeue(maxAge.Duration - age)
+	return r.setCondition(ctx, basicAuthenticator, ConditionTypeCredentialsExpired, metav1.ConditionFalse, ConditionReasonWithinMaxAge, "credentials are within the max age")
+}
+
+// getRequestedRotationToken returns the token of RotateAnnotation and whether it requests a rotation of the controller
+// generated credentials, which is the case until the token is recorded in Status.LastRotationToken
+func getRequestedRotationToken(basicAuthenticator *v1alpha1.BasicAuthenticator, secret *corev1.Secret) (string, bool) {
+	token := basicAuthenticator.Annotations[RotateAnnotation]
+	if token == "" || token == basicAuthenticator.Status.LastRotationToken || !metav1.IsControlledBy(secret, basicAuthenticator) {
+		return token, false
+	}
+	return token, true
+}
+
+// isRotationOverlapped reports whether the password replaced by a rotation stays valid for Spec.RotationOverlap
+func isRotationOverlapped(basicAuthenticator *v1alpha1.BasicAuthenticator) bool {
+	overlap := basicAuthenticator.Spec.RotationOverlap
+	return overlap != nil && overlap.Duration > 0 && !isDigestAuth(basicAuthenticator)
+}
+
+// getPreviousHtpasswd returns the htpasswd entry replaced by the last rotation while the overlap window is open,
+// scheduling the reconcile which drops it once the window closes
+func (r *BasicAuthenticatorReconciler) getPreviousHtpasswd(basicAuthenticator *v1alpha1.BasicAuthenticator) string {
+	expiry := basicAuthenticator.Status.PreviousHtpasswdExpiry
+	if basicAuthenticator.Status.PreviousHtpasswd == "" || expiry == nil || !isRotationOverlapped(basicAuthenticator) {
+		return ""
+	}
+	untilExpiry := expiry.Sub(r.now())
+	if untilExpiry <= 0 {
+		return ""
+	}
+	r.scheduleRequeue(untilExpiry)
+	return basicAuthenticator.Status.PreviousHtpasswd
+}
+
+// setPreviousHtpasswd records the htpasswd entry which stays valid until Spec.RotationOverlap has passed since now,
+// or clears it when previousHtpasswd is empty
+func setPreviousHtpasswd(basicAuthenticator *v1alpha1.BasicAuthenticator, previousHtpasswd string, now time.Time) {
+	if previousHtpasswd == "" {
+		basicAuthenticator.Status.PreviousHtpasswd = ""
+		basicAuthenticator.Status.PreviousHtpasswdExpiry = nil
+		return
+	}
+	expiry := metav1.NewTime(now.Add(basicAuthenticator.Spec.RotationOverlap.Duration))
+	basicAuthenticator.Status.PreviousHtpasswd = previousHtpasswd
+	basicAuthenticator.Status.PreviousHtpasswdExpiry = &expiry
+}
+
+// isRotationDue reports whether the controller generated credentials have outlived Spec.RotationInterval.
+// If they have not, the next reconcile is scheduled for when they will.
+func (r *BasicAuthenticatorReconciler) isRotationDue(basicAuthenticator *v1alpha1.BasicAuthenticator, secret *corev1.Secret) bool {
+	interval := basicAuthenticator.Spec.RotationInterval
+	if interval == nil || interval.Duration <= 0 || !metav1.IsControlledBy(secret, basicAuthenticator) {
+		return false
+	}
+	lastRotation := secret.CreationTimestamp
+	if basicAuthenticator.Status.LastRotationTime != nil {
+		lastRotation = *basicAuthenticator.Status.LastRotationTime
+	}
+	untilRotation := lastRotation.Add(interval.Duration).Sub(r.now())
+	if untilRotation > 0 {
+		r.scheduleRequeue(untilRotation)
+		return false
+	}
+	return true
+}
+
 func (r *BasicAuthenticatorReconciler) ensureConfigmap(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
 	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
 
@@ -156,9 +609,30 @@ func (r *BasicAuthenticatorReconciler) ensureConfigmap(ctx context.Context, req
 		return subreconciler.RequeueWithError(err)
 	}
 
-	authenticatorConfig := createNginxConfigmap(basicAuthenticator)
+	configTemplate, reason, err := r.getConfigTemplate(ctx, basicAuthenticator)
+	if err != nil {
+		r.logger.Error(err, "failed to get config template")
+		if reason == "" {
+			return subreconciler.RequeueWithError(err)
+		}
+		return r.setConfigTemplateInvalid(ctx, basicAuthenticator, reason, err)
+	}
+	authenticatorConfig, err := createNginxConfigmap(basicAuthenticator, configTemplate, getEffectiveConfig(r.CustomConfig, basicAuthenticator))
+	if err != nil {
+		r.logger.Error(err, "failed to render config template")
+		return r.setConfigTemplateInvalid(ctx, basicAuthenticator, ConditionReasonConfigTemplateRenderError, err)
+	}
+	if basicAuthenticator.Spec.ConfigTemplateRef == "" {
+		err = r.removeCondition(ctx, basicAuthenticator, ConditionTypeConfigTemplateValid)
+	} else {
+		err = r.setCondition(ctx, basicAuthenticator, ConditionTypeConfigTemplateValid, metav1.ConditionTrue, ConditionReasonConfigTemplateRendered, "config template rendered")
+	}
+	if err != nil {
+		r.logger.Error(err, "failed to update config template condition")
+		return subreconciler.RequeueWithError(err)
+	}
 	var foundConfigmap corev1.ConfigMap
-	err := r.Get(ctx, types.NamespacedName{Name: authenticatorConfig.Name, Namespace: basicAuthenticator.Namespace}, &foundConfigmap)
+	err = r.Get(ctx, types.NamespacedName{Name: authenticatorConfig.Name, Namespace: basicAuthenticator.Namespace}, &foundConfigmap)
 	if errors.IsNotFound(err) {
 		if err := ctrl.SetControllerReference(basicAuthenticator, authenticatorConfig, r.Scheme); err != nil {
 			r.logger.Error(err, "failed to set configmap owner")
@@ -171,6 +645,7 @@ func (r *BasicAuthenticatorReconciler) ensureConfigmap(ctx context.Context, req
 		}
 		//saving secretName inorder to be used in next steps
 		r.configMapName = authenticatorConfig.Name
+		r.configChecksum = getConfigChecksum(authenticatorConfig.Data)
 
 	} else if err != nil {
 		r.logger.Error(err, "failed to fetch configmap")
@@ -186,11 +661,41 @@ func (r *BasicAuthenticatorReconciler) ensureConfigmap(ctx context.Context, req
 			}
 		}
 		r.configMapName = authenticatorConfig.Name
+		r.configChecksum = getConfigChecksum(authenticatorConfig.Data)
 	}
 
 	return subreconciler.ContinueReconciling()
 }
 
+// getConfigTemplate returns the user supplied config template referenced by Spec.ConfigTemplateRef, or an empty string if there is none.
+// If the template is missing, the reason of the ConfigTemplateValid condition is returned along with the error.
+func (r *BasicAuthenticatorReconciler) getConfigTemplate(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator) (string, string, error) {
+	if basicAuthenticator.Spec.ConfigTemplateRef == "" {
+		return "", "", nil
+	}
+	var templateConfigmap corev1.ConfigMap
+	err := r.Get(ctx, types.NamespacedName{Name: basicAuthenticator.Spec.ConfigTemplateRef, Namespace: basicAuthenticator.Namespace}, &templateConfigmap)
+	if errors.IsNotFound(err) {
+		return "", ConditionReasonConfigTemplateNotFound, err
+	} else if err != nil {
+		return "", "", err
+	}
+	configTemplate, exists := templateConfigmap.Data[v1alpha1.ConfigTemplateKey]
+	if !exists {
+		return "", ConditionReasonConfigTemplateNotFound, fmt.Errorf("configmap %s has no %s key", templateConfigmap.Name, v1alpha1.ConfigTemplateKey)
+	}
+	return configTemplate, "", nil
+}
+
+func (r *BasicAuthenticatorReconciler) setConfigTemplateInvalid(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, reason string, cause error) (*ctrl.Result, error) {
+	if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeConfigTemplateValid, metav1.ConditionFalse, reason, cause.Error()); err != nil {
+		r.logger.Error(err, "failed to update config template condition")
+		return subreconciler.RequeueWithError(err)
+	}
+	// the referenced configmap is watched, so fixing it triggers a new reconcile
+	return subreconciler.DoNotRequeue()
+}
+
 func (r *BasicAuthenticatorReconciler) ensureDeployment(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
 	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
 
@@ -207,12 +712,89 @@ func (r *BasicAuthenticatorReconciler) ensureDeployment(ctx context.Context, req
 	}
 	//Deciding to create sidecar injection or create deployment
 	isSidecar := basicAuthenticator.Spec.Type == "sidecar"
+	if !isSidecar && (len(basicAuthenticator.Spec.Selector.MatchLabels) > 0 || len(basicAuthenticator.Spec.Selector.MatchExpressions) > 0) {
+		// the webhook admits the selector of deployment mode for the BasicAuthenticators created before it was checked
+		r.Recorder.Event(basicAuthenticator, corev1.EventTypeWarning, EventReasonSelectorIgnored, "selector is only used in sidecar mode and is ignored in deployment mode")
+	}
+	if isConfigOnly(basicAuthenticator) {
+		return r.removeDeploymentAuthenticator(ctx, basicAuthenticator)
+	}
 	if isSidecar {
 		return r.createSidecarAuthenticator(ctx, req, basicAuthenticator, r.configMapName, r.credentialName)
 	} else {
 		return r.createDeploymentAuthenticator(ctx, req, basicAuthenticator, r.configMapName, r.credentialName)
 	}
 }
+
+// waitForSecret waits for the credentials secret to be readable before the configmap is applied, if ordered apply is enabled
+func (r *BasicAuthenticatorReconciler) waitForSecret(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	if !isOrderedApply(r.CustomConfig) {
+		return subreconciler.ContinueReconciling()
+	}
+	key := types.NamespacedName{Name: r.credentialName, Namespace: req.Namespace}
+	return r.waitForEstablished(ctx, req, "secret", func() (bool, error) {
+		return r.isEstablished(ctx, key, &corev1.Secret{})
+	})
+}
+
+// waitForConfigmap waits for the nginx configmap to be readable before the deployment is applied, if ordered apply is enabled
+func (r *BasicAuthenticatorReconciler) waitForConfigmap(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	if !isOrderedApply(r.CustomConfig) {
+		return subreconciler.ContinueReconciling()
+	}
+	key := types.NamespacedName{Name: r.configMapName, Namespace: req.Namespace}
+	return r.waitForEstablished(ctx, req, "configmap", func() (bool, error) {
+		return r.isEstablished(ctx, key, &corev1.ConfigMap{})
+	})
+}
+
+// waitForDeployment waits for the deployment controller to observe the latest nginx deployment, if ordered apply is enabled.
+// Injected deployments are not waited for, as the operator does not own them.
+func (r *BasicAuthenticatorReconciler) waitForDeployment(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	if !isOrderedApply(r.CustomConfig) {
+		return subreconciler.ContinueReconciling()
+	}
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	if basicAuthenticator.Spec.Type == "sidecar" || isConfigOnly(basicAuthenticator) {
+		return subreconciler.ContinueReconciling()
+	}
+	key := types.NamespacedName{Name: random_generator.GenerateRandomName(basicAuthenticator.Name, "deployment"), Namespace: req.Namespace}
+	return r.waitForEstablished(ctx, req, "deployment", func() (bool, error) {
+		deployment := &appv1.Deployment{}
+		if established, err := r.isEstablished(ctx, key, deployment); !established || err != nil {
+			return established, err
+		}
+		return deployment.Status.ObservedGeneration >= deployment.Generation, nil
+	})
+}
+
+// waitForEstablished polls condition until it holds, for at most the configured establish timeout.
+// The object is requeued with backoff when the wait times out.
+func (r *BasicAuthenticatorReconciler) waitForEstablished(ctx context.Context, req ctrl.Request, kind string, condition wait.ConditionFunc) (*ctrl.Result, error) {
+	err := wait.PollImmediate(establishPollInterval, getEstablishTimeout(r.CustomConfig), condition)
+	if defaultError.Is(err, wait.ErrWaitTimeout) {
+		r.logger.Info("timed out waiting for resource to be established", "kind", kind)
+		return r.requeueWithBackoff(req)
+	}
+	if err != nil {
+		r.logger.Error(err, "failed to wait for resource to be established", "kind", kind)
+		return subreconciler.RequeueWithError(err)
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+// isEstablished reports whether the object is readable, which may lag behind its creation when reading from the cache
+func (r *BasicAuthenticatorReconciler) isEstablished(ctx context.Context, key types.NamespacedName, obj client.Object) (bool, error) {
+	err := r.Get(ctx, key, obj)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 func (r *BasicAuthenticatorReconciler) ensureService(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
 	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
 
@@ -253,34 +835,466 @@ func (r *BasicAuthenticatorReconciler) ensureService(ctx context.Context, req ct
 	return subreconciler.ContinueReconciling()
 }
 
-func (r *BasicAuthenticatorReconciler) setAvailableStatus(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+func (r *BasicAuthenticatorReconciler) ensureIngress(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
 	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
 
 	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
 		return subreconciler.RequeueWithError(err)
 	}
-
-	basicAuthenticator.Status.State = StatusAvailable
-	if err := r.Update(ctx, basicAuthenticator); err != nil {
-		r.logger.Error(err, "failed to update status")
-		return subreconciler.Requeue()
+	if basicAuthenticator.Spec.Type == "sidecar" {
+		return subreconciler.ContinueReconciling()
 	}
-	return subreconciler.ContinueReconciling()
-}
-
-func (r *BasicAuthenticatorReconciler) createDeploymentAuthenticator(ctx context.Context, req ctrl.Request, basicAuthenticator *v1alpha1.BasicAuthenticator, authenticatorConfigName, secretName string) (*ctrl.Result, error) {
 
-	newDeployment := createNginxDeployment(basicAuthenticator, authenticatorConfigName, secretName, r.CustomConfig)
-	foundDeployment := &appv1.Deployment{}
-	err := r.Get(ctx, types.NamespacedName{Name: newDeployment.Name, Namespace: basicAuthenticator.Namespace}, foundDeployment)
+	newIngress := createNginxIngress(basicAuthenticator)
+	foundIngress := networkingv1.Ingress{}
+	err := r.Get(ctx, types.NamespacedName{Name: newIngress.Name, Namespace: newIngress.Namespace}, &foundIngress)
 	if errors.IsNotFound(err) {
-		if err := ctrl.SetControllerReference(basicAuthenticator, newDeployment, r.Scheme); err != nil {
-			r.logger.Error(err, "failed to set deployment owner")
+		if basicAuthenticator.Spec.Ingress == nil {
+			return subreconciler.ContinueReconciling()
+		}
+		if err := ctrl.SetControllerReference(basicAuthenticator, newIngress, r.Scheme); err != nil {
+			r.logger.Error(err, "failed to set ingress owner")
 			return subreconciler.RequeueWithError(err)
 		}
-		if basicAuthenticator.Spec.AdaptiveScale && basicAuthenticator.Spec.AppService != "" {
-			replica, err := r.acquireTargetReplica(ctx, basicAuthenticator)
-			if err != nil {
+		if err := r.Create(ctx, newIngress); err != nil {
+			r.logger.Error(err, "failed to create new ingress")
+			return subreconciler.RequeueWithError(err)
+		}
+	} else if err != nil {
+		r.logger.Error(err, "failed to fetch ingress")
+		return subreconciler.RequeueWithError(err)
+	} else if basicAuthenticator.Spec.Ingress == nil {
+		if err := r.Delete(ctx, &foundIngress); err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "failed to delete ingress")
+			return subreconciler.RequeueWithError(err)
+		}
+	} else if !reflect.DeepEqual(newIngress.Spec, foundIngress.Spec) {
+		r.logger.Info("updating ingress")
+		foundIngress.Spec = newIngress.Spec
+		if err := r.Update(ctx, &foundIngress); err != nil {
+			r.logger.Error(err, "failed to update ingress")
+			return subreconciler.RequeueWithError(err)
+		}
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+func (r *BasicAuthenticatorReconciler) ensureRoute(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	if basicAuthenticator.Spec.Type == "sidecar" {
+		return subreconciler.ContinueReconciling()
+	}
+	if !r.routeAvailable {
+		if basicAuthenticator.Spec.Route == nil {
+			if err := r.removeCondition(ctx, basicAuthenticator, ConditionTypeRouteReady); err != nil {
+				r.logger.Error(err, "failed to update route condition")
+				return subreconciler.RequeueWithError(err)
+			}
+			return subreconciler.ContinueReconciling()
+		}
+		if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeRouteReady, metav1.ConditionFalse, ConditionReasonRouteAPIUnavailable,
+			"route.openshift.io/v1 API is not available in the cluster, no route is created"); err != nil {
+			r.logger.Error(err, "failed to update route condition")
+			return subreconciler.RequeueWithError(err)
+		}
+		return subreconciler.ContinueReconciling()
+	}
+
+	foundRoute := newRoute()
+	err := r.Get(ctx, types.NamespacedName{Name: getNginxRouteName(basicAuthenticator), Namespace: basicAuthenticator.Namespace}, foundRoute)
+	if errors.IsNotFound(err) {
+		if basicAuthenticator.Spec.Route == nil {
+			return subreconciler.ContinueReconciling()
+		}
+		route := newRoute()
+		if err := applyNginxRouteSpec(route, basicAuthenticator); err != nil {
+			r.logger.Error(err, "failed to build route")
+			return subreconciler.RequeueWithError(err)
+		}
+		if err := ctrl.SetControllerReference(basicAuthenticator, route, r.Scheme); err != nil {
+			r.logger.Error(err, "failed to set route owner")
+			return subreconciler.RequeueWithError(err)
+		}
+		if err := r.Create(ctx, route); err != nil {
+			r.logger.Error(err, "failed to create new route")
+			return subreconciler.RequeueWithError(err)
+		}
+	} else if err != nil {
+		r.logger.Error(err, "failed to fetch route")
+		return subreconciler.RequeueWithError(err)
+	} else if basicAuthenticator.Spec.Route == nil {
+		if err := r.Delete(ctx, foundRoute); err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "failed to delete route")
+			return subreconciler.RequeueWithError(err)
+		}
+	} else {
+		updatedRoute := foundRoute.DeepCopy()
+		if err := applyNginxRouteSpec(updatedRoute, basicAuthenticator); err != nil {
+			r.logger.Error(err, "failed to build route")
+			return subreconciler.RequeueWithError(err)
+		}
+		if !reflect.DeepEqual(updatedRoute.Object["spec"], foundRoute.Object["spec"]) {
+			r.logger.Info("updating route")
+			if err := r.Update(ctx, updatedRoute); err != nil {
+				r.logger.Error(err, "failed to update route")
+				return subreconciler.RequeueWithError(err)
+			}
+		}
+	}
+
+	if basicAuthenticator.Spec.Route == nil {
+		err = r.removeCondition(ctx, basicAuthenticator, ConditionTypeRouteReady)
+	} else {
+		err = r.setCondition(ctx, basicAuthenticator, ConditionTypeRouteReady, metav1.ConditionTrue, ConditionReasonRouteCreated, "route is created")
+	}
+	if err != nil {
+		r.logger.Error(err, "failed to update route condition")
+		return subreconciler.RequeueWithError(err)
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+func (r *BasicAuthenticatorReconciler) ensureNetworkPolicies(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	if basicAuthenticator.Spec.Type == "sidecar" {
+		return subreconciler.ContinueReconciling()
+	}
+
+	var upstreamService *corev1.Service
+	if basicAuthenticator.Spec.AppService != "" {
+		var foundService corev1.Service
+		err := r.Get(ctx, types.NamespacedName{Name: basicAuthenticator.Spec.AppService, Namespace: basicAuthenticator.Namespace}, &foundService)
+		if err == nil {
+			upstreamService = &foundService
+		} else if !errors.IsNotFound(err) {
+			r.logger.Error(err, "failed to fetch upstream service")
+			return subreconciler.RequeueWithError(err)
+		}
+	}
+
+	ingressPeers := getIngressPeers(basicAuthenticator, getEffectiveConfig(r.CustomConfig, basicAuthenticator))
+	for _, newPolicy := range createZeroTrustNetworkPolicies(basicAuthenticator, upstreamService, ingressPeers) {
+		if err := r.ensureNetworkPolicy(ctx, basicAuthenticator, newPolicy, basicAuthenticator.Spec.ZeroTrust); err != nil {
+			return subreconciler.RequeueWithError(err)
+		}
+	}
+	ingressPolicy := createIngressNetworkPolicy(basicAuthenticator, ingressPeers)
+	if err := r.ensureNetworkPolicy(ctx, basicAuthenticator, ingressPolicy, isNetworkPolicyEnabled(basicAuthenticator)); err != nil {
+		return subreconciler.RequeueWithError(err)
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+// ensureNetworkPolicy creates or updates newPolicy if enabled, and deletes it otherwise
+func (r *BasicAuthenticatorReconciler) ensureNetworkPolicy(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, newPolicy *networkingv1.NetworkPolicy, enabled bool) error {
+	foundPolicy := networkingv1.NetworkPolicy{}
+	err := r.Get(ctx, types.NamespacedName{Name: newPolicy.Name, Namespace: newPolicy.Namespace}, &foundPolicy)
+	if errors.IsNotFound(err) {
+		if !enabled {
+			return nil
+		}
+		if err := ctrl.SetControllerReference(basicAuthenticator, newPolicy, r.Scheme); err != nil {
+			r.logger.Error(err, "failed to set network policy owner")
+			return err
+		}
+		if err := r.Create(ctx, newPolicy); err != nil {
+			r.logger.Error(err, "failed to create new network policy")
+			return err
+		}
+	} else if err != nil {
+		r.logger.Error(err, "failed to fetch network policy")
+		return err
+	} else if !enabled {
+		if err := r.Delete(ctx, &foundPolicy); err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "failed to delete network policy")
+			return err
+		}
+	} else if !reflect.DeepEqual(newPolicy.Spec, foundPolicy.Spec) {
+		r.logger.Info("updating network policy")
+		foundPolicy.Spec = newPolicy.Spec
+		if err := r.Update(ctx, &foundPolicy); err != nil {
+			r.logger.Error(err, "failed to update network policy")
+			return err
+		}
+	}
+	return nil
+}
+
+// ensurePodDisruptionBudget keeps a PodDisruptionBudget for the nginx pods while there is more than one replica,
+// and removes it once the replicas drop back to one or it is disabled
+func (r *BasicAuthenticatorReconciler) ensurePodDisruptionBudget(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	if basicAuthenticator.Spec.Type == "sidecar" {
+		return subreconciler.ContinueReconciling()
+	}
+
+	needed := isPodDisruptionBudgetNeeded(basicAuthenticator)
+	newBudget := createPodDisruptionBudget(basicAuthenticator)
+	foundBudget := policyv1.PodDisruptionBudget{}
+	err := r.Get(ctx, types.NamespacedName{Name: newBudget.Name, Namespace: newBudget.Namespace}, &foundBudget)
+	if errors.IsNotFound(err) {
+		if !needed {
+			return subreconciler.ContinueReconciling()
+		}
+		if err := ctrl.SetControllerReference(basicAuthenticator, newBudget, r.Scheme); err != nil {
+			r.logger.Error(err, "failed to set pod disruption budget owner")
+			return subreconciler.RequeueWithError(err)
+		}
+		if err := r.Create(ctx, newBudget); err != nil {
+			r.logger.Error(err, "failed to create new pod disruption budget")
+			return subreconciler.RequeueWithError(err)
+		}
+	} else if err != nil {
+		r.logger.Error(err, "failed to fetch pod disruption budget")
+		return subreconciler.RequeueWithError(err)
+	} else if !needed {
+		if err := r.Delete(ctx, &foundBudget); err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "failed to delete pod disruption budget")
+			return subreconciler.RequeueWithError(err)
+		}
+	} else if !reflect.DeepEqual(newBudget.Spec, foundBudget.Spec) {
+		r.logger.Info("updating pod disruption budget")
+		foundBudget.Spec = newBudget.Spec
+		if err := r.Update(ctx, &foundBudget); err != nil {
+			r.logger.Error(err, "failed to update pod disruption budget")
+			return subreconciler.RequeueWithError(err)
+		}
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+// ensureHorizontalPodAutoscaler keeps a HorizontalPodAutoscaler for the nginx deployment while Spec.Autoscaling is set
+func (r *BasicAuthenticatorReconciler) ensureHorizontalPodAutoscaler(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	if basicAuthenticator.Spec.Type == "sidecar" {
+		return subreconciler.ContinueReconciling()
+	}
+
+	newAutoscaler := createHorizontalPodAutoscaler(basicAuthenticator)
+	foundAutoscaler := autoscalingv2.HorizontalPodAutoscaler{}
+	err := r.Get(ctx, types.NamespacedName{Name: newAutoscaler.Name, Namespace: newAutoscaler.Namespace}, &foundAutoscaler)
+	if errors.IsNotFound(err) {
+		if basicAuthenticator.Spec.Autoscaling == nil {
+			return subreconciler.ContinueReconciling()
+		}
+		if err := ctrl.SetControllerReference(basicAuthenticator, newAutoscaler, r.Scheme); err != nil {
+			r.logger.Error(err, "failed to set horizontal pod autoscaler owner")
+			return subreconciler.RequeueWithError(err)
+		}
+		if err := r.Create(ctx, newAutoscaler); err != nil {
+			r.logger.Error(err, "failed to create new horizontal pod autoscaler")
+			return subreconciler.RequeueWithError(err)
+		}
+	} else if err != nil {
+		r.logger.Error(err, "failed to fetch horizontal pod autoscaler")
+		return subreconciler.RequeueWithError(err)
+	} else if basicAuthenticator.Spec.Autoscaling == nil {
+		if err := r.Delete(ctx, &foundAutoscaler); err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "failed to delete horizontal pod autoscaler")
+			return subreconciler.RequeueWithError(err)
+		}
+	} else if !reflect.DeepEqual(newAutoscaler.Spec, foundAutoscaler.Spec) {
+		r.logger.Info("updating horizontal pod autoscaler")
+		foundAutoscaler.Spec = newAutoscaler.Spec
+		if err := r.Update(ctx, &foundAutoscaler); err != nil {
+			r.logger.Error(err, "failed to update horizontal pod autoscaler")
+			return subreconciler.RequeueWithError(err)
+		}
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+// validateUpstream halts the reconcile with an UpstreamUnavailable condition if AppService and AppPort do not resolve.
+// As upstreams are not watched, it keeps checking periodically until they do.
+func (r *BasicAuthenticatorReconciler) validateUpstream(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	if basicAuthenticator.Spec.Type == "sidecar" || !basicAuthenticator.Spec.ValidateUpstream {
+		if err := r.removeCondition(ctx, basicAuthenticator, ConditionTypeUpstreamAvailable); err != nil {
+			r.logger.Error(err, "failed to update upstream condition")
+			return subreconciler.RequeueWithError(err)
+		}
+		return subreconciler.ContinueReconciling()
+	}
+
+	if err := r.checkUpstream(ctx, basicAuthenticator); err != nil {
+		r.logger.Info("upstream is unavailable", "reason", err.Error())
+		if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeUpstreamAvailable, metav1.ConditionFalse, ConditionReasonUpstreamUnavailable, err.Error()); err != nil {
+			r.logger.Error(err, "failed to update upstream condition")
+			return subreconciler.RequeueWithError(err)
+		}
+		return subreconciler.RequeueWithDelay(upstreamRetryInterval)
+	}
+	if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeUpstreamAvailable, metav1.ConditionTrue, ConditionReasonUpstreamAvailable, "upstream is available"); err != nil {
+		r.logger.Error(err, "failed to update upstream condition")
+		return subreconciler.RequeueWithError(err)
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+// checkUpstream verifies the upstream service exposes AppPort when AppService points to a cluster service,
+// and falls back to resolving AppService as a host name otherwise.
+func (r *BasicAuthenticatorReconciler) checkUpstream(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator) error {
+	appService := basicAuthenticator.Spec.AppService
+	if appService == "" {
+		return defaultError.New("appService is not set")
+	}
+	serviceKey, isClusterService := getUpstreamServiceKey(basicAuthenticator)
+	if isClusterService {
+		var upstreamService corev1.Service
+		err := r.Get(ctx, serviceKey, &upstreamService)
+		if err == nil {
+			for _, port := range upstreamService.Spec.Ports {
+				if int(port.Port) == basicAuthenticator.Spec.AppPort {
+					return nil
+				}
+			}
+			return fmt.Errorf("service %s does not expose port %d", serviceKey, basicAuthenticator.Spec.AppPort)
+		}
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		if !strings.Contains(appService, ".") {
+			return fmt.Errorf("service %s not found", serviceKey)
+		}
+	}
+	if _, err := net.DefaultResolver.LookupHost(ctx, appService); err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", appService, err)
+	}
+	return nil
+}
+
+// setManagedResources records the resources created or injected for the basicAuthenticator in Status.ManagedResources.
+// It runs once every resource is ensured, so the resources removed in this reconcile are no longer listed.
+func (r *BasicAuthenticatorReconciler) setManagedResources(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+	managedResources, err := r.getManagedResources(ctx, basicAuthenticator)
+	if err != nil {
+		r.logger.Error(err, "failed to list managed resources")
+		return subreconciler.RequeueWithError(err)
+	}
+	if reflect.DeepEqual(managedResources, basicAuthenticator.Status.ManagedResources) {
+		return subreconciler.ContinueReconciling()
+	}
+	basicAuthenticator.Status.ManagedResources = managedResources
+	if err := r.Status().Update(ctx, basicAuthenticator); err != nil {
+		r.logger.Error(err, "failed to update managed resources")
+		return r.requeueWithBackoff(req)
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+// getManagedResources returns the secret and configmap, the nginx deployment or the injected workloads, and the other
+// resources enabled in the spec. The deployments and cronJobs are found by their basicAuthenticatorNameLabel.
+func (r *BasicAuthenticatorReconciler) getManagedResources(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator) ([]v1alpha1.ResourceRef, error) {
+	namespace := basicAuthenticator.Namespace
+	resources := []v1alpha1.ResourceRef{
+		{Kind: "Secret", Name: r.credentialName, Namespace: namespace},
+		{Kind: "ConfigMap", Name: r.configMapName, Namespace: namespace},
+	}
+	nameLabel := client.MatchingLabels{basicAuthenticatorNameLabel: basicAuthenticator.Name}
+	var deployments appv1.DeploymentList
+	if err := r.List(ctx, &deployments, client.InNamespace(namespace), nameLabel); err != nil {
+		return nil, err
+	}
+	for _, deploy := range deployments.Items {
+		resources = append(resources, v1alpha1.ResourceRef{Kind: "Deployment", Name: deploy.Name, Namespace: namespace})
+	}
+	if basicAuthenticator.Spec.Type == "sidecar" {
+		var cronJobs batchv1.CronJobList
+		if err := r.List(ctx, &cronJobs, client.InNamespace(namespace), nameLabel); err != nil {
+			return nil, err
+		}
+		for _, cronJob := range cronJobs.Items {
+			resources = append(resources, v1alpha1.ResourceRef{Kind: "CronJob", Name: cronJob.Name, Namespace: namespace})
+		}
+		return resources, nil
+	}
+	if isConfigOnly(basicAuthenticator) {
+		return resources, nil
+	}
+	resources = append(resources, v1alpha1.ResourceRef{Kind: "Service", Name: getNginxServiceName(basicAuthenticator), Namespace: namespace})
+	if basicAuthenticator.Spec.Ingress != nil {
+		resources = append(resources, v1alpha1.ResourceRef{Kind: "Ingress", Name: createNginxIngress(basicAuthenticator).Name, Namespace: namespace})
+	}
+	if basicAuthenticator.Spec.Route != nil && r.routeAvailable {
+		resources = append(resources, v1alpha1.ResourceRef{Kind: "Route", Name: getNginxRouteName(basicAuthenticator), Namespace: namespace})
+	}
+	if basicAuthenticator.Spec.ZeroTrust {
+		for _, policy := range createZeroTrustNetworkPolicies(basicAuthenticator, nil, nil) {
+			resources = append(resources, v1alpha1.ResourceRef{Kind: "NetworkPolicy", Name: policy.Name, Namespace: namespace})
+		}
+	}
+	if isNetworkPolicyEnabled(basicAuthenticator) {
+		resources = append(resources, v1alpha1.ResourceRef{Kind: "NetworkPolicy", Name: createIngressNetworkPolicy(basicAuthenticator, nil).Name, Namespace: namespace})
+	}
+	if isPodDisruptionBudgetNeeded(basicAuthenticator) {
+		resources = append(resources, v1alpha1.ResourceRef{Kind: "PodDisruptionBudget", Name: createPodDisruptionBudget(basicAuthenticator).Name, Namespace: namespace})
+	}
+	if basicAuthenticator.Spec.Autoscaling != nil {
+		resources = append(resources, v1alpha1.ResourceRef{Kind: "HorizontalPodAutoscaler", Name: createHorizontalPodAutoscaler(basicAuthenticator).Name, Namespace: namespace})
+	}
+	return resources, nil
+}
+
+func (r *BasicAuthenticatorReconciler) setAvailableStatus(ctx context.Context, req ctrl.Request) (*ctrl.Result, error) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{}
+
+	if r, err := r.getLatestBasicAuthenticator(ctx, req, basicAuthenticator); subreconciler.ShouldHaltOrRequeue(r, err) {
+		return subreconciler.RequeueWithError(err)
+	}
+
+	basicAuthenticator.Status.State = StatusAvailable
+	if isConfigOnly(basicAuthenticator) {
+		basicAuthenticator.Status.State = StatusConfigOnly
+	}
+	if meta.IsStatusConditionTrue(basicAuthenticator.Status.Conditions, ConditionTypeCredentialsExpired) {
+		basicAuthenticator.Status.State = StatusDegraded
+	}
+	if err := r.Update(ctx, basicAuthenticator); err != nil {
+		r.logger.Error(err, "failed to update status")
+		return r.requeueWithBackoff(req)
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+func (r *BasicAuthenticatorReconciler) createDeploymentAuthenticator(ctx context.Context, req ctrl.Request, basicAuthenticator *v1alpha1.BasicAuthenticator, authenticatorConfigName, secretName string) (*ctrl.Result, error) {
+
+	customConfig := getEffectiveConfig(r.CustomConfig, basicAuthenticator)
+	newDeployment := createNginxDeployment(basicAuthenticator, authenticatorConfigName, r.configChecksum, secretName, customConfig)
+	foundDeployment := &appv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: newDeployment.Name, Namespace: basicAuthenticator.Namespace}, foundDeployment)
+	if errors.IsNotFound(err) {
+		if err := ctrl.SetControllerReference(basicAuthenticator, newDeployment, r.Scheme); err != nil {
+			r.logger.Error(err, "failed to set deployment owner")
+			return subreconciler.RequeueWithError(err)
+		}
+		if basicAuthenticator.Spec.AdaptiveScale && basicAuthenticator.Spec.AppService != "" {
+			replica, err := r.acquireTargetReplica(ctx, basicAuthenticator)
+			if err != nil {
 				r.logger.Error(err, "failed to acquire target replica using adaptiveScale")
 				return subreconciler.RequeueWithError(err)
 			}
@@ -294,6 +1308,11 @@ func (r *BasicAuthenticatorReconciler) createDeploymentAuthenticator(ctx context
 		}
 		r.logger.Info("created deployment")
 		r.deploymentLabel = newDeployment.Spec.Selector
+		if err := r.setReadiness(ctx, basicAuthenticator, []*appv1.Deployment{newDeployment}); err != nil {
+			r.logger.Error(err, "failed to update basic authenticator status")
+			return subreconciler.RequeueWithError(err)
+		}
+		r.scheduleRequeue(getProgressRequeueInterval(customConfig))
 	} else if err != nil {
 		r.logger.Error(err, "failed to fetch deployment")
 		return subreconciler.RequeueWithError(err)
@@ -308,42 +1327,264 @@ func (r *BasicAuthenticatorReconciler) createDeploymentAuthenticator(ctx context
 			}
 			targetReplica = &replica
 		}
+		if basicAuthenticator.Spec.Autoscaling != nil {
+			// the replicas are left to the autoscaler, so the two do not fight over them
+			targetReplica = foundDeployment.Spec.Replicas
+		}
 
-		if !reflect.DeepEqual(newDeployment.Spec, foundDeployment.Spec) {
+		mergedDeployment := foundDeployment.DeepCopy()
+		mergeDeploymentSpec(mergedDeployment, newDeployment)
+		mergedDeployment.Spec.Replicas = targetReplica
+		if !reflect.DeepEqual(mergedDeployment.Spec, foundDeployment.Spec) {
 			r.logger.Info("updating deployment")
 
-			foundDeployment.Spec = newDeployment.Spec
-			foundDeployment.Spec.Replicas = targetReplica
+			foundDeployment = mergedDeployment
 			err = r.Update(ctx, foundDeployment)
 			if err != nil {
 				r.logger.Error(err, "failed to update deployment")
 				return subreconciler.RequeueWithError(err)
 			}
 		}
+		// each reconcile starts without the label of the previous one, so the service is kept in sync on every reconcile
+		r.deploymentLabel = foundDeployment.Spec.Selector
 		r.logger.Info("updating ready replicas")
-		basicAuthenticator.Status.ReadyReplicas = int(foundDeployment.Status.ReadyReplicas)
-		err = r.Status().Update(ctx, basicAuthenticator)
-		if err != nil {
+		if err := r.setReadiness(ctx, basicAuthenticator, []*appv1.Deployment{foundDeployment}); err != nil {
 			r.logger.Error(err, "failed to update basic authenticator status")
 			return subreconciler.RequeueWithError(err)
 		}
+		if isDeploymentProgressing(foundDeployment) {
+			// the deployment's status changes are watched too, but requeuing keeps ReadyReplicas converging predictably
+			r.scheduleRequeue(getProgressRequeueInterval(customConfig))
+		}
+	}
+	return subreconciler.ContinueReconciling()
+}
+
+// removeDeploymentAuthenticator deletes the nginx deployment and service created before basicAuthenticator was switched to
+// config only. The other resources built on them are removed by their own steps, as the webhook keeps them unset.
+func (r *BasicAuthenticatorReconciler) removeDeploymentAuthenticator(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator) (*ctrl.Result, error) {
+	owned := []client.Object{
+		&appv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: random_generator.GenerateRandomName(basicAuthenticator.Name, "deployment")}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: getNginxServiceName(basicAuthenticator)}},
+	}
+	for _, obj := range owned {
+		err := r.Get(ctx, types.NamespacedName{Name: obj.GetName(), Namespace: basicAuthenticator.Namespace}, obj)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			r.logger.Error(err, "failed to fetch nginx workload", "name", obj.GetName())
+			return subreconciler.RequeueWithError(err)
+		}
+		if !metav1.IsControlledBy(obj, basicAuthenticator) {
+			continue
+		}
+		if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "failed to delete nginx workload", "name", obj.GetName())
+			return subreconciler.RequeueWithError(err)
+		}
+	}
+	r.deploymentLabel = nil
+	// nginx runs outside the operator, so the generated secret and config, ensured in the previous steps, are all there is to be ready
+	if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeReady, metav1.ConditionTrue, ConditionReasonConfigOnly, "the credentials secret and nginx config are generated, nginx is not managed"); err != nil {
+		r.logger.Error(err, "failed to update ready condition")
+		return subreconciler.RequeueWithError(err)
+	}
+	if basicAuthenticator.Status.ReadyReplicas != 0 {
+		basicAuthenticator.Status.ReadyReplicas = 0
+		if err := r.Status().Update(ctx, basicAuthenticator); err != nil {
+			r.logger.Error(err, "failed to update ready replicas")
+			return subreconciler.RequeueWithError(err)
+		}
 	}
 	return subreconciler.ContinueReconciling()
 }
 
 func (r *BasicAuthenticatorReconciler) createSidecarAuthenticator(ctx context.Context, req ctrl.Request, basicAuthenticator *v1alpha1.BasicAuthenticator, authenticatorConfigName, secretName string) (*ctrl.Result, error) {
-	deploymentsToUpdate, err := injector(ctx, basicAuthenticator, authenticatorConfigName, secretName, r.CustomConfig, r.Client)
+	customConfig := getEffectiveConfig(r.CustomConfig, basicAuthenticator)
+	injection, err := injector(ctx, basicAuthenticator, authenticatorConfigName, r.configChecksum, secretName, customConfig, r.Client)
 	if err != nil {
 		r.logger.Error(err, "failed to inject into deployments")
 		return subreconciler.RequeueWithError(err)
 	}
-	for _, deploy := range deploymentsToUpdate {
+	for _, deploy := range injection.updated {
 		err := r.Update(ctx, deploy)
 		if err != nil {
 			r.logger.Error(err, "failed to update injected deployments")
 			return subreconciler.RequeueWithError(err)
 		}
 	}
+	for _, deploy := range injection.injected {
+		r.Recorder.Eventf(deploy, corev1.EventTypeNormal, EventReasonSidecarInjected, "authenticator sidecar injected by BasicAuthenticator %s", basicAuthenticator.Name)
+		r.Recorder.Eventf(basicAuthenticator, corev1.EventTypeNormal, EventReasonSidecarInjected, "authenticator sidecar injected into deployment %s", deploy.Name)
+		r.audit(basicAuthenticator, AuditActionSidecarInjected, "Deployment", deploy)
+	}
+	for _, drift := range injection.drifted {
+		r.logger.Info("repaired drifted sidecar", "deployment", drift.deployment.Name, "drift", drift.description)
+		r.Recorder.Eventf(drift.deployment, corev1.EventTypeWarning, EventReasonDriftDetected, "authenticator sidecar injected again as %s", drift.description)
+		r.Recorder.Eventf(basicAuthenticator, corev1.EventTypeWarning, EventReasonDriftDetected, "authenticator sidecar injected again into deployment %s as %s", drift.deployment.Name, drift.description)
+		r.audit(basicAuthenticator, AuditActionSidecarRepaired, "Deployment", drift.deployment)
+	}
+	if err := r.setDriftCondition(ctx, basicAuthenticator, injection.drifted); err != nil {
+		r.logger.Error(err, "failed to update drift condition")
+		return subreconciler.RequeueWithError(err)
+	}
+	for _, deploy := range removeInjectedResources(injection.optedOut, getNginxContainerName(customConfig), getInjectedVolumeNames(basicAuthenticator, secretName), []string{authenticatorConfigName}) {
+		if err := r.Update(ctx, deploy); err != nil {
+			r.logger.Error(err, "failed to remove sidecar from opted out deployment")
+			return subreconciler.RequeueWithError(err)
+		}
+		r.Recorder.Eventf(deploy, corev1.EventTypeNormal, EventReasonSidecarRemoved, "authenticator sidecar removed as deployment opted out of injection")
+		r.Recorder.Eventf(basicAuthenticator, corev1.EventTypeNormal, EventReasonSidecarRemoved, "authenticator sidecar removed from opted out deployment %s", deploy.Name)
+		r.audit(basicAuthenticator, AuditActionSidecarRemoved, "Deployment", deploy)
+	}
+	for _, cronJob := range injection.cronJobs {
+		if err := r.Update(ctx, cronJob); err != nil {
+			r.logger.Error(err, "failed to update injected cronjobs")
+			return subreconciler.RequeueWithError(err)
+		}
+	}
+	for _, cronJob := range injection.injectedCronJobs {
+		r.Recorder.Eventf(cronJob, corev1.EventTypeNormal, EventReasonSidecarInjected, "authenticator sidecar injected by BasicAuthenticator %s", basicAuthenticator.Name)
+		r.Recorder.Eventf(basicAuthenticator, corev1.EventTypeNormal, EventReasonSidecarInjected, "authenticator sidecar injected into cronjob %s", cronJob.Name)
+		r.audit(basicAuthenticator, AuditActionSidecarInjected, "CronJob", cronJob)
+	}
+	for _, cronJob := range removeInjectedCronJobResources(injection.staleCronJobs, getNginxContainerName(customConfig), getInjectedVolumeNames(basicAuthenticator, secretName), []string{authenticatorConfigName}) {
+		if err := r.Update(ctx, cronJob); err != nil {
+			r.logger.Error(err, "failed to remove sidecar from stale cronjob")
+			return subreconciler.RequeueWithError(err)
+		}
+		r.Recorder.Eventf(cronJob, corev1.EventTypeNormal, EventReasonSidecarRemoved, "authenticator sidecar removed as cronjob is no longer selected by BasicAuthenticator %s", basicAuthenticator.Name)
+		r.Recorder.Eventf(basicAuthenticator, corev1.EventTypeNormal, EventReasonSidecarRemoved, "authenticator sidecar removed from cronjob %s which is no longer selected", cronJob.Name)
+		r.audit(basicAuthenticator, AuditActionSidecarRemoved, "CronJob", cronJob)
+	}
+	if err := r.pruneStaleInjections(ctx, basicAuthenticator, injection.all, getNginxContainerName(customConfig), getInjectedVolumeNames(basicAuthenticator, secretName), []string{authenticatorConfigName}); err != nil {
+		r.logger.Error(err, "failed to prune stale injections")
+		return subreconciler.RequeueWithError(err)
+	}
+	if err := r.setReadiness(ctx, basicAuthenticator, injection.all); err != nil {
+		r.logger.Error(err, "failed to update sidecar readiness")
+		return subreconciler.RequeueWithError(err)
+	}
+	return r.setInjectionConflictCondition(ctx, basicAuthenticator, injection.conflicting, injection.collisions)
+}
+
+// setReadiness aggregates the ready replicas of the nginx deployment, or of the injected deployments in sidecar mode, into
+// the status and sets the Ready condition once all of them rolled out. The deployments are watched, so their rollout triggers a new reconcile.
+func (r *BasicAuthenticatorReconciler) setReadiness(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, deployments []*appv1.Deployment) error {
+	readyReplicas := 0
+	notReady := make([]string, 0)
+	for _, deploy := range deployments {
+		readyReplicas += int(deploy.Status.ReadyReplicas)
+		if !isDeploymentRolledOut(deploy) {
+			notReady = append(notReady, deploy.Name)
+		}
+	}
+	if basicAuthenticator.Status.ReadyReplicas != readyReplicas {
+		basicAuthenticator.Status.ReadyReplicas = readyReplicas
+		if err := r.Status().Update(ctx, basicAuthenticator); err != nil {
+			return err
+		}
+	}
+	switch {
+	case len(deployments) == 0:
+		return r.setCondition(ctx, basicAuthenticator, ConditionTypeReady, metav1.ConditionFalse, ConditionReasonNoTargets, "no deployment is injected")
+	case len(notReady) > 0:
+		message := fmt.Sprintf("deployments not ready: %s", strings.Join(notReady, ", "))
+		return r.setCondition(ctx, basicAuthenticator, ConditionTypeReady, metav1.ConditionFalse, ConditionReasonTargetsNotReady, message)
+	default:
+		message := fmt.Sprintf("all %d deployments are ready", len(deployments))
+		return r.setCondition(ctx, basicAuthenticator, ConditionTypeReady, metav1.ConditionTrue, ConditionReasonAllTargetsReady, message)
+	}
+}
+
+// pruneStaleInjections removes the sidecar from the deployments injected in a previous reconcile which are no longer selected,
+// and records the currently injected ones in the status.
+func (r *BasicAuthenticatorReconciler) pruneStaleInjections(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, injected []*appv1.Deployment, containerName string, secrets []string, configmaps []string) error {
+	injectedNames := make([]string, 0, len(injected))
+	for _, deploy := range injected {
+		injectedNames = append(injectedNames, deploy.Name)
+	}
+	sort.Strings(injectedNames)
+	for _, name := range basicAuthenticator.Status.InjectedDeployments {
+		if existsInList(injectedNames, name) {
+			continue
+		}
+		staleDeployment := &appv1.Deployment{}
+		err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: basicAuthenticator.Namespace}, staleDeployment)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if getContainerIndex(staleDeployment.Spec.Template.Spec.Containers, containerName) == -1 {
+			continue
+		}
+		if injectedBy, exists := staleDeployment.Annotations[InjectedByAnnotation]; exists && injectedBy != basicAuthenticator.Name {
+			continue
+		}
+		removeInjectedResources([]*appv1.Deployment{staleDeployment}, containerName, secrets, configmaps)
+		if err := r.Update(ctx, staleDeployment); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(staleDeployment, corev1.EventTypeNormal, EventReasonSidecarRemoved, "authenticator sidecar removed as deployment is no longer selected by BasicAuthenticator %s", basicAuthenticator.Name)
+		r.Recorder.Eventf(basicAuthenticator, corev1.EventTypeNormal, EventReasonSidecarRemoved, "authenticator sidecar removed from deployment %s which is no longer selected", staleDeployment.Name)
+		r.audit(basicAuthenticator, AuditActionSidecarRemoved, "Deployment", staleDeployment)
+	}
+	if reflect.DeepEqual(injectedNames, basicAuthenticator.Status.InjectedDeployments) ||
+		(len(injectedNames) == 0 && len(basicAuthenticator.Status.InjectedDeployments) == 0) {
+		return nil
+	}
+	basicAuthenticator.Status.InjectedDeployments = injectedNames
+	return r.Status().Update(ctx, basicAuthenticator)
+}
+
+// setDriftCondition reports the deployments whose sidecar was repaired in this reconcile. The condition is only added once
+// drift is found, and turns False on the next reconcile finding none, so its last transition tells when it was repaired.
+func (r *BasicAuthenticatorReconciler) setDriftCondition(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, drifted []injectionDrift) error {
+	if len(drifted) == 0 {
+		if meta.FindStatusCondition(basicAuthenticator.Status.Conditions, ConditionTypeDriftDetected) == nil {
+			return nil
+		}
+		return r.setCondition(ctx, basicAuthenticator, ConditionTypeDriftDetected, metav1.ConditionFalse, ConditionReasonNoDrift, "every injected deployment has the sidecar")
+	}
+	drifts := make([]string, 0, len(drifted))
+	for _, drift := range drifted {
+		drifts = append(drifts, fmt.Sprintf("deployment %s: %s", drift.deployment.Name, drift.description))
+	}
+	return r.setCondition(ctx, basicAuthenticator, ConditionTypeDriftDetected, metav1.ConditionTrue, ConditionReasonSidecarRepaired, strings.Join(drifts, ", "))
+}
+
+// setInjectionConflictCondition reports the deployments which were not injected as another basicAuthenticator already injected them,
+// and the workloads which were not injected as they have a container named like the sidecar
+func (r *BasicAuthenticatorReconciler) setInjectionConflictCondition(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, conflicting []*appv1.Deployment, collisions []string) (*ctrl.Result, error) {
+	if len(conflicting) == 0 && len(collisions) == 0 {
+		if err := r.removeCondition(ctx, basicAuthenticator, ConditionTypeInjectionConflict); err != nil {
+			r.logger.Error(err, "failed to update injection conflict condition")
+			return subreconciler.RequeueWithError(err)
+		}
+		return subreconciler.ContinueReconciling()
+	}
+	conflicts := make([]string, 0, len(conflicting))
+	for _, deploy := range conflicting {
+		conflicts = append(conflicts, fmt.Sprintf("deployment %s is already injected by BasicAuthenticator %s", deploy.Name, deploy.Annotations[InjectedByAnnotation]))
+	}
+	reason := ConditionReasonAlreadyInjected
+	if len(collisions) > 0 {
+		containerName := getNginxContainerName(getEffectiveConfig(r.CustomConfig, basicAuthenticator))
+		for _, collision := range collisions {
+			conflicts = append(conflicts, fmt.Sprintf("%s already has a container named %s", collision, containerName))
+		}
+		if len(conflicting) == 0 {
+			reason = ConditionReasonContainerNameCollision
+		}
+	}
+	message := strings.Join(conflicts, ", ")
+	r.Recorder.Event(basicAuthenticator, corev1.EventTypeWarning, reason, message)
+	if err := r.setCondition(ctx, basicAuthenticator, ConditionTypeInjectionConflict, metav1.ConditionTrue, reason, message); err != nil {
+		r.logger.Error(err, "failed to update injection conflict condition")
+		return subreconciler.RequeueWithError(err)
+	}
 	return subreconciler.ContinueReconciling()
 }
 
@@ -0,0 +1,1996 @@
+package basic_authenticator
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/opdev/subreconciler"
+	"github.com/snapp-incubator/simple-authenticator/api/v1alpha1"
+	"github.com/snapp-incubator/simple-authenticator/internal/config"
+	"github.com/snapp-incubator/simple-authenticator/pkg/htpasswd"
+	"github.com/snapp-incubator/simple-authenticator/pkg/random_generator"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/pointer"
+	"math"
+	"reflect"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestReconciler returns a reconciler on a fake client holding objs, which knows the built-in kinds and BasicAuthenticator
+func newTestReconciler(t *testing.T, objs ...client.Object) (*BasicAuthenticatorReconciler, client.Client) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	r := &BasicAuthenticatorReconciler{Client: k8sClient, Scheme: scheme, Recorder: record.NewFakeRecorder(10), logger: logr.Discard()}
+	return r, k8sClient
+}
+
+func TestEnsureSecretLeavesCurrentCredentialsUnchanged(t *testing.T) {
+	for _, authType := range []string{"", v1alpha1.AuthTypeDigest} {
+		t.Run(authType, func(t *testing.T) {
+			ctx := context.Background()
+			basicAuthenticator := &v1alpha1.BasicAuthenticator{
+				ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-unchanged", Namespace: "default"},
+				Spec: v1alpha1.BasicAuthenticatorSpec{
+					Type:                 "deployment",
+					AppPort:              8080,
+					AuthenticatorPort:    8080,
+					CredentialsSecretRef: "credentials",
+					AuthType:             authType,
+				},
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+				Data:       map[string][]byte{SecretUsernameField: []byte("admin"), SecretPasswordField: []byte("secret")},
+			}
+			r, k8sClient := newTestReconciler(t, basicAuthenticator, secret)
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+			secretKey := types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}
+			getResourceVersion := func() string {
+				if result, err := r.ensureSecret(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+					t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+				}
+				latest := &corev1.Secret{}
+				if err := k8sClient.Get(ctx, secretKey, latest); err != nil {
+					t.Fatal(err)
+				}
+				return latest.ResourceVersion
+			}
+
+			first := getResourceVersion()
+			if second := getResourceVersion(); second != first {
+				t.Errorf("expected a secret with current credential files not to be updated, got resourceVersion %s after %s", second, first)
+			}
+		})
+	}
+}
+
+func TestSetCredentialsSecretRefWithConcurrentStatusUpdate(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-patch", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "deployment", AppPort: 8080, AuthenticatorPort: 8080},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	key := types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}
+
+	stale := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, key, stale); err != nil {
+		t.Fatal(err)
+	}
+	concurrent := stale.DeepCopy()
+	concurrent.Status.State = StatusReconciling
+	if err := k8sClient.Status().Update(ctx, concurrent); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.setCredentialsSecretRef(ctx, stale, "basicauthenticator-patch-secret"); err != nil {
+		t.Fatalf("expected no conflict, got %v", err)
+	}
+
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, key, latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest.Status.CredentialsSecretRef != "basicauthenticator-patch-secret" {
+		t.Errorf("expected credentialsSecretRef to be patched, got %q", latest.Status.CredentialsSecretRef)
+	}
+	if latest.Spec.CredentialsSecretRef != "" {
+		t.Errorf("expected spec to be left untouched, got credentialsSecretRef %q", latest.Spec.CredentialsSecretRef)
+	}
+	if latest.Status.State != StatusReconciling {
+		t.Errorf("expected concurrent status to be kept, got %q", latest.Status.State)
+	}
+}
+
+func TestRotationPolicyLabelPersistsThroughRotation(t *testing.T) {
+	ctx := context.Background()
+	lastRotation := metav1.NewTime(time.Now().Add(-time.Hour))
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-rotation", Namespace: "default", UID: "basicauthenticator-rotation-uid"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:                 "deployment",
+			AppPort:              8080,
+			AuthenticatorPort:    8080,
+			CredentialsSecretRef: "basicauthenticator-rotation-secret",
+			RotationInterval:     &metav1.Duration{Duration: time.Minute},
+			RotationPolicyLabel:  "monthly",
+		},
+		Status: v1alpha1.BasicAuthenticatorStatus{LastRotationTime: &lastRotation},
+	}
+	secret, err := createCredentials(basicAuthenticator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Name = basicAuthenticator.Spec.CredentialsSecretRef
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	if err := ctrl.SetControllerReference(basicAuthenticator, secret, r.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Create(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+
+	if _, err := r.ensureSecret(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	rotatedSecret := &corev1.Secret{}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, rotatedSecret); err != nil {
+		t.Fatal(err)
+	}
+	if string(rotatedSecret.Data["password"]) == string(secret.Data["password"]) {
+		t.Fatal("expected the password to be rotated")
+	}
+	if rotatedSecret.Labels[RotationPolicyLabel] != "monthly" {
+		t.Errorf("expected rotation policy label to persist, got %q", rotatedSecret.Labels[RotationPolicyLabel])
+	}
+}
+
+func TestAuditLogOfRotation(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	lastRotation := metav1.NewTime(now.Add(-time.Hour))
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-audit", Namespace: "default", UID: "basicauthenticator-audit-uid"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:                 "deployment",
+			AppPort:              8080,
+			AuthenticatorPort:    8080,
+			CredentialsSecretRef: "basicauthenticator-audit-secret",
+			RotationInterval:     &metav1.Duration{Duration: time.Minute},
+		},
+		Status: v1alpha1.BasicAuthenticatorStatus{LastRotationTime: &lastRotation},
+	}
+	secret, err := createCredentials(basicAuthenticator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Name = basicAuthenticator.Spec.CredentialsSecretRef
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	if err := ctrl.SetControllerReference(basicAuthenticator, secret, r.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Create(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	var entries []map[string]interface{}
+	logger := funcr.NewJSON(func(obj string) {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(obj), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["component"] == auditComponent {
+			entries = append(entries, entry)
+		}
+	}, funcr.Options{})
+	r.logger = logger
+	r.clock = clocktesting.NewFakeClock(now)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+
+	if _, err := r.ensureSecret(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected a single audit entry, got %v", entries)
+	}
+	expected := map[string]string{
+		"action":                 AuditActionCredentialsRotated,
+		"timestamp":              "2023-01-01T00:00:00Z",
+		"authenticatorName":      basicAuthenticator.Name,
+		"authenticatorNamespace": basicAuthenticator.Namespace,
+		"authenticatorUID":       string(basicAuthenticator.UID),
+		"targetKind":             "Secret",
+		"targetName":             secret.Name,
+		"targetNamespace":        secret.Namespace,
+	}
+	for field, value := range expected {
+		if entries[0][field] != value {
+			t.Errorf("expected audit field %s to be %q, got %v", field, value, entries[0][field])
+		}
+	}
+}
+
+func TestRotateAnnotationRegeneratesCredentialsOnce(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "basicauthenticator-rotate",
+			Namespace:   "default",
+			UID:         "basicauthenticator-rotate-uid",
+			Annotations: map[string]string{RotateAnnotation: "compromised-1"},
+		},
+		Spec: v1alpha1.BasicAuthenticatorSpec{Type: "deployment", AppPort: 8080, AuthenticatorPort: 8080},
+	}
+	secret, err := createCredentials(basicAuthenticator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	if err := ctrl.SetControllerReference(basicAuthenticator, secret, r.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Create(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	secretKey := types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}
+
+	if _, err := r.ensureSecret(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	rotatedSecret := &corev1.Secret{}
+	if err := k8sClient.Get(ctx, secretKey, rotatedSecret); err != nil {
+		t.Fatal(err)
+	}
+	if string(rotatedSecret.Data[SecretPasswordField]) == string(secret.Data[SecretPasswordField]) {
+		t.Fatal("expected the password to be rotated on request")
+	}
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest.Status.LastRotationToken != "compromised-1" || latest.Status.LastRotationTime == nil {
+		t.Errorf("expected the rotation token and time to be recorded, got %q and %v", latest.Status.LastRotationToken, latest.Status.LastRotationTime)
+	}
+
+	if _, err := r.ensureSecret(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	unchangedSecret := &corev1.Secret{}
+	if err := k8sClient.Get(ctx, secretKey, unchangedSecret); err != nil {
+		t.Fatal(err)
+	}
+	if string(unchangedSecret.Data[SecretPasswordField]) != string(rotatedSecret.Data[SecretPasswordField]) {
+		t.Error("expected the same token not to rotate the credentials again")
+	}
+}
+
+func TestRotationOverlapKeepsPreviousPassword(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clocktesting.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	lastRotation := metav1.NewTime(fakeClock.Now().Add(-2 * time.Hour))
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-overlap", Namespace: "default", UID: "basicauthenticator-overlap-uid"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppPort:           8080,
+			AuthenticatorPort: 8080,
+			RotationInterval:  &metav1.Duration{Duration: time.Hour},
+			RotationOverlap:   &metav1.Duration{Duration: 10 * time.Minute},
+		},
+		Status: v1alpha1.BasicAuthenticatorStatus{LastRotationTime: &lastRotation},
+	}
+	secret, err := createCredentials(basicAuthenticator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := updateCredentialFields(secret, basicAuthenticator); err != nil {
+		t.Fatal(err)
+	}
+	previousEntry := string(secret.Data[SecretHtpasswdField])
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	if err := ctrl.SetControllerReference(basicAuthenticator, secret, r.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Create(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	r.clock = fakeClock
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	secretKey := types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}
+	getEntries := func() []string {
+		latest := &corev1.Secret{}
+		if err := k8sClient.Get(ctx, secretKey, latest); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(string(latest.Data[SecretHtpasswdField]), "\n")
+	}
+
+	if _, err := r.ensureSecret(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if entries := getEntries(); len(entries) != 2 || entries[0] == previousEntry || entries[1] != previousEntry {
+		t.Errorf("expected the new entry followed by the previous one, got %v", entries)
+	}
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	expiry := fakeClock.Now().Add(10 * time.Minute)
+	if latest.Status.PreviousHtpasswd != previousEntry || latest.Status.PreviousHtpasswdExpiry == nil || !latest.Status.PreviousHtpasswdExpiry.Time.Equal(expiry) {
+		t.Errorf("expected the previous entry to be tracked until %s, got %q until %v", expiry, latest.Status.PreviousHtpasswd, latest.Status.PreviousHtpasswdExpiry)
+	}
+
+	fakeClock.Step(5 * time.Minute)
+	r.requeueAfter = 0
+	if _, err := r.ensureSecret(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if entries := getEntries(); len(entries) != 2 || entries[1] != previousEntry {
+		t.Errorf("expected the previous entry to be kept within the window, got %v", entries)
+	}
+	if r.requeueAfter != 5*time.Minute {
+		t.Errorf("expected a requeue for when the window closes, got %s", r.requeueAfter)
+	}
+
+	fakeClock.Step(5 * time.Minute)
+	if _, err := r.ensureSecret(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if entries := getEntries(); len(entries) != 1 || entries[0] == previousEntry {
+		t.Errorf("expected only the new entry once the window closed, got %v", entries)
+	}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest.Status.PreviousHtpasswd != "" || latest.Status.PreviousHtpasswdExpiry != nil {
+		t.Errorf("expected the previous entry to be cleared from the status, got %q", latest.Status.PreviousHtpasswd)
+	}
+}
+
+func TestExclusiveInjectionRejectsSecondAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	selector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "protected"}}
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "second", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "sidecar", Selector: selector, AppPort: 8080, AuthenticatorPort: 8081},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "protected",
+			Namespace:   "default",
+			Labels:      selector.MatchLabels,
+			Annotations: map[string]string{InjectedByAnnotation: "first"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: nginxDefaultContainerName}}},
+			},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, deployment)
+	r.CustomConfig = &config.CustomConfig{SidecarConf: config.SidecarConfig{ExclusiveInjection: true}}
+
+	if _, err := r.createSidecarAuthenticator(ctx, ctrl.Request{}, basicAuthenticator, "configmap", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}, latest); err != nil {
+		t.Fatal(err)
+	}
+	condition := meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeInjectionConflict)
+	if condition == nil || condition.Status != metav1.ConditionTrue {
+		t.Fatalf("expected an injection conflict, got %v", latest.Status.Conditions)
+	}
+	expectedMessage := "deployment protected is already injected by BasicAuthenticator first"
+	if condition.Message != expectedMessage {
+		t.Errorf("expected message %q, got %q", expectedMessage, condition.Message)
+	}
+	foundDeployment := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}, foundDeployment); err != nil {
+		t.Fatal(err)
+	}
+	if foundDeployment.Labels[basicAuthenticatorNameLabel] != "" {
+		t.Errorf("expected the deployment to be left untouched, got labels %v", foundDeployment.Labels)
+	}
+}
+
+func TestSidecarRemovedFromDeploymentNoLongerSelected(t *testing.T) {
+	ctx := context.Background()
+	selector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "protected"}}
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-prune", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "sidecar", Selector: selector, AppPort: 8080, AuthenticatorPort: 8081},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "protected", Namespace: "default", Labels: map[string]string{"app": "protected"}},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, deployment)
+	baKey := types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}
+	deploymentKey := types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}
+
+	reconcile := func() {
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, baKey, latest); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.createSidecarAuthenticator(ctx, ctrl.Request{NamespacedName: baKey}, latest, "configmap", "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reconcile()
+	injected := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, deploymentKey, injected); err != nil {
+		t.Fatal(err)
+	}
+	if getContainerIndex(injected.Spec.Template.Spec.Containers, nginxDefaultContainerName) == -1 {
+		t.Fatal("expected the sidecar to be injected")
+	}
+
+	delete(injected.Labels, "app")
+	if err := k8sClient.Update(ctx, injected); err != nil {
+		t.Fatal(err)
+	}
+	reconcile()
+
+	pruned := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, deploymentKey, pruned); err != nil {
+		t.Fatal(err)
+	}
+	if getContainerIndex(pruned.Spec.Template.Spec.Containers, nginxDefaultContainerName) != -1 {
+		t.Errorf("expected the sidecar to be removed, got containers %v", pruned.Spec.Template.Spec.Containers)
+	}
+	if len(pruned.Spec.Template.Spec.Volumes) != 0 {
+		t.Errorf("expected the injected volumes to be removed, got %v", pruned.Spec.Template.Spec.Volumes)
+	}
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, baKey, latest); err != nil {
+		t.Fatal(err)
+	}
+	if len(latest.Status.InjectedDeployments) != 0 {
+		t.Errorf("expected no injected deployments in status, got %v", latest.Status.InjectedDeployments)
+	}
+}
+
+func TestEnsureSecretReusesOwnedSecretOnStaleRead(t *testing.T) {
+	ctx := context.Background()
+	// the ref of a secret created in a previous reconcile is not visible yet
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-stale", Namespace: "default", UID: "basicauthenticator-stale-uid"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "deployment", AppPort: 8080, AuthenticatorPort: 8080},
+	}
+	secret, err := createCredentials(basicAuthenticator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	if err := ctrl.SetControllerReference(basicAuthenticator, secret, r.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Create(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	key := types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}
+
+	if _, err := r.ensureSecret(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	var secrets corev1.SecretList
+	if err := k8sClient.List(ctx, &secrets); err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets.Items) != 1 {
+		t.Errorf("expected the owned secret to be reused, got %d secrets", len(secrets.Items))
+	}
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, key, latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest.Status.CredentialsSecretRef != secret.Name {
+		t.Errorf("expected credentialsSecretRef %q, got %q", secret.Name, latest.Status.CredentialsSecretRef)
+	}
+	if latest.Spec.CredentialsSecretRef != "" {
+		t.Errorf("expected spec to be left untouched, got credentialsSecretRef %q", latest.Spec.CredentialsSecretRef)
+	}
+}
+
+func TestCredentialsExpiredAfterMaxAge(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-max-age", Namespace: "default", UID: "basicauthenticator-max-age-uid"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppPort:           8080,
+			AuthenticatorPort: 8080,
+			MaxCredentialAge:  &metav1.Duration{Duration: 24 * time.Hour},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	fakeClock := clocktesting.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	r.clock = fakeClock
+	key := types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}
+
+	getExpiredCondition := func() *metav1.Condition {
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, key, latest); err != nil {
+			t.Fatal(err)
+		}
+		return meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeCredentialsExpired)
+	}
+
+	if _, err := r.ensureSecret(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	if condition := getExpiredCondition(); condition == nil || condition.Status != metav1.ConditionFalse {
+		t.Fatalf("expected fresh credentials not to be expired, got %v", condition)
+	}
+	if r.requeueAfter != 24*time.Hour {
+		t.Errorf("expected a requeue when the credentials expire, got %s", r.requeueAfter)
+	}
+
+	fakeClock.Step(25 * time.Hour)
+	r.initVars(ctrl.Request{NamespacedName: key})
+	if _, err := r.ensureSecret(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	condition := getExpiredCondition()
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != ConditionReasonMaxAgeExceeded {
+		t.Errorf("expected credentials to be expired after the max age, got %v", condition)
+	}
+}
+
+// laggingClient hides secrets from the first reads, as a cache which did not observe their creation yet would
+type laggingClient struct {
+	client.Client
+	hiddenReads int
+	reads       int
+}
+
+func (c *laggingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if _, ok := obj.(*corev1.Secret); ok {
+		c.reads++
+		if c.reads <= c.hiddenReads {
+			return errors.NewNotFound(corev1.Resource("secrets"), key.Name)
+		}
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func TestOrderedApplyWaitsForEstablishedResources(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-ordered", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "deployment", AppPort: 8080, AuthenticatorPort: 8080},
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"}}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       random_generator.GenerateRandomName(basicAuthenticator.Name, "deployment"),
+			Namespace:  "default",
+			Generation: 2,
+		},
+		Status: appsv1.DeploymentStatus{ObservedGeneration: 1},
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	newReconciler := func(hiddenReads int, timeout time.Duration) (*BasicAuthenticatorReconciler, *laggingClient) {
+		r, fakeClient := newTestReconciler(t, basicAuthenticator, secret, deployment)
+		k8sClient := &laggingClient{Client: fakeClient, hiddenReads: hiddenReads}
+		r.Client = k8sClient
+		r.CustomConfig = &config.CustomConfig{ReconcileConf: config.ReconcileConfig{OrderedApply: true, EstablishTimeout: timeout}}
+		r.credentialName = secret.Name
+		return r, k8sClient
+	}
+
+	r, k8sClient := newReconciler(2, 5*time.Second)
+	result, err := r.waitForSecret(ctx, req)
+	if subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected to continue once the secret is established, got %v, %v", result, err)
+	}
+	if k8sClient.reads != 3 {
+		t.Errorf("expected the secret to be read until it is established, got %d reads", k8sClient.reads)
+	}
+
+	r, _ = newReconciler(math.MaxInt, 10*time.Millisecond)
+	result, err = r.waitForSecret(ctx, req)
+	if err != nil || result == nil || result.RequeueAfter == 0 {
+		t.Errorf("expected a requeue when the secret is not established in time, got %v, %v", result, err)
+	}
+
+	r, _ = newReconciler(0, 10*time.Millisecond)
+	result, err = r.waitForDeployment(ctx, req)
+	if err != nil || result == nil || result.RequeueAfter == 0 {
+		t.Errorf("expected a requeue until the deployment generation is observed, got %v, %v", result, err)
+	}
+}
+
+func TestSidecarInjectedIntoCronJobJobTemplate(t *testing.T) {
+	ctx := context.Background()
+	selector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "protected"}}
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-cronjob", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "sidecar", Selector: selector, InjectCronJobs: true, AppPort: 8080, AuthenticatorPort: 8081},
+	}
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "protected", Namespace: "default", Labels: map[string]string{"app": "protected"}},
+		Spec: batchv1.CronJobSpec{
+			Schedule: "@hourly",
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							RestartPolicy: corev1.RestartPolicyNever,
+							Containers:    []corev1.Container{{Name: "app"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, cronJob)
+	baKey := types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}
+	cronJobKey := types.NamespacedName{Name: cronJob.Name, Namespace: cronJob.Namespace}
+
+	reconcile := func() {
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, baKey, latest); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.createSidecarAuthenticator(ctx, ctrl.Request{NamespacedName: baKey}, latest, "configmap", "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reconcile()
+	injected := &batchv1.CronJob{}
+	if err := k8sClient.Get(ctx, cronJobKey, injected); err != nil {
+		t.Fatal(err)
+	}
+	podSpec := injected.Spec.JobTemplate.Spec.Template.Spec
+	idx := getContainerIndex(podSpec.Containers, nginxDefaultContainerName)
+	if idx == -1 {
+		t.Fatal("expected the sidecar to be injected into the job template")
+	}
+	if len(podSpec.Containers[idx].Command) == 0 || !strings.Contains(strings.Join(podSpec.Containers[idx].Command, " "), LifecycleDoneFile) {
+		t.Errorf("expected the sidecar to stop once the job is done, got command %v", podSpec.Containers[idx].Command)
+	}
+	if podSpec.RestartPolicy != corev1.RestartPolicyNever {
+		t.Errorf("expected the restart policy to be kept, got %q", podSpec.RestartPolicy)
+	}
+
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, baKey, latest); err != nil {
+		t.Fatal(err)
+	}
+	latest.Spec.InjectCronJobs = false
+	if err := k8sClient.Update(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	reconcile()
+
+	pruned := &batchv1.CronJob{}
+	if err := k8sClient.Get(ctx, cronJobKey, pruned); err != nil {
+		t.Fatal(err)
+	}
+	podSpec = pruned.Spec.JobTemplate.Spec.Template.Spec
+	if len(podSpec.Containers) != 1 || len(podSpec.Containers[0].VolumeMounts) != 0 || len(podSpec.Volumes) != 0 {
+		t.Errorf("expected the sidecar and its volumes to be removed, got %v", podSpec)
+	}
+}
+
+func TestSidecarReadinessAggregatesInjectedDeployments(t *testing.T) {
+	ctx := context.Background()
+	selector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "protected"}}
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-readiness", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "sidecar", Selector: selector, AppPort: 8080, AuthenticatorPort: 8081},
+	}
+	newDeployment := func(name string, availableReplicas int32) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "protected"}},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: pointer.Int32(2),
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+				},
+			},
+			Status: appsv1.DeploymentStatus{UpdatedReplicas: 2, ReadyReplicas: availableReplicas, AvailableReplicas: availableReplicas},
+		}
+	}
+	ready := newDeployment("ready", 2)
+	rollingOut := newDeployment("rolling-out", 1)
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, ready, rollingOut)
+	baKey := types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}
+
+	reconcile := func() *v1alpha1.BasicAuthenticator {
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, baKey, latest); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.createSidecarAuthenticator(ctx, ctrl.Request{NamespacedName: baKey}, latest, "configmap", "secret"); err != nil {
+			t.Fatal(err)
+		}
+		if err := k8sClient.Get(ctx, baKey, latest); err != nil {
+			t.Fatal(err)
+		}
+		return latest
+	}
+
+	latest := reconcile()
+	if latest.Status.ReadyReplicas != 3 {
+		t.Errorf("expected the ready replicas of all injected deployments, got %d", latest.Status.ReadyReplicas)
+	}
+	condition := meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeReady)
+	if condition == nil || condition.Status != metav1.ConditionFalse || !strings.Contains(condition.Message, rollingOut.Name) {
+		t.Errorf("expected not to be ready while %s rolls out, got %v", rollingOut.Name, condition)
+	}
+
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: rollingOut.Name, Namespace: rollingOut.Namespace}, rollingOut); err != nil {
+		t.Fatal(err)
+	}
+	rollingOut.Status.ReadyReplicas = 2
+	rollingOut.Status.AvailableReplicas = 2
+	if err := k8sClient.Status().Update(ctx, rollingOut); err != nil {
+		t.Fatal(err)
+	}
+	latest = reconcile()
+	if latest.Status.ReadyReplicas != 4 {
+		t.Errorf("expected the ready replicas of all injected deployments, got %d", latest.Status.ReadyReplicas)
+	}
+	condition = meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeReady)
+	if condition == nil || condition.Status != metav1.ConditionTrue {
+		t.Errorf("expected to be ready once all deployments rolled out, got %v", condition)
+	}
+}
+
+func TestInjectingTwiceKeepsOneSidecar(t *testing.T) {
+	ctx := context.Background()
+	selector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "protected"}}
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-twice", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "sidecar", Selector: selector, AppPort: 8080, AuthenticatorPort: 8081},
+	}
+	// the application runs its own nginx, so the sidecar is given another name
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "protected", Namespace: "default", Labels: map[string]string{"app": "protected"}},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: "nginx"}}},
+			},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, deployment)
+	r.CustomConfig = &config.CustomConfig{WebserverConf: config.WebserverConfig{ContainerName: "authenticator"}}
+	baKey := types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}
+	deploymentKey := types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}
+
+	for _, authenticatorPort := range []int{8081, 8082} {
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, baKey, latest); err != nil {
+			t.Fatal(err)
+		}
+		latest.Spec.AuthenticatorPort = authenticatorPort
+		if _, err := r.createSidecarAuthenticator(ctx, ctrl.Request{NamespacedName: baKey}, latest, "configmap", "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	injected := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, deploymentKey, injected); err != nil {
+		t.Fatal(err)
+	}
+	containers := injected.Spec.Template.Spec.Containers
+	if len(containers) != 2 || containers[0].Name != "nginx" || containers[0].Image != "nginx" {
+		t.Fatalf("expected the application container and exactly one sidecar, got %v", containers)
+	}
+	if containers[1].Name != "authenticator" || containers[1].Ports[0].ContainerPort != 8082 {
+		t.Errorf("expected the sidecar to be updated in place, got %v", containers[1])
+	}
+	if len(injected.Spec.Template.Spec.Volumes) != 2 {
+		t.Errorf("expected the sidecar volumes not to be duplicated, got %v", injected.Spec.Template.Spec.Volumes)
+	}
+}
+
+func TestContainerNameCollisionIsReported(t *testing.T) {
+	ctx := context.Background()
+	selector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "protected"}}
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-collision", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "sidecar", Selector: selector, AppPort: 8080, AuthenticatorPort: 8081},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "protected", Namespace: "default", Labels: map[string]string{"app": "protected"}},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: nginxDefaultContainerName, Image: "nginx"}}},
+			},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, deployment)
+	baKey := types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}
+
+	if _, err := r.createSidecarAuthenticator(ctx, ctrl.Request{NamespacedName: baKey}, basicAuthenticator, "configmap", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	found := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}, found); err != nil {
+		t.Fatal(err)
+	}
+	if len(found.Spec.Template.Spec.Containers) != 1 || found.Spec.Template.Spec.Containers[0].Image != "nginx" {
+		t.Errorf("expected the application container to be left untouched, got %v", found.Spec.Template.Spec.Containers)
+	}
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, baKey, latest); err != nil {
+		t.Fatal(err)
+	}
+	condition := meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeInjectionConflict)
+	if condition == nil || condition.Reason != ConditionReasonContainerNameCollision {
+		t.Errorf("expected the name collision to be reported, got %v", condition)
+	}
+}
+
+func TestLabelOnlyInjectionIsTakenOver(t *testing.T) {
+	ctx := context.Background()
+	selector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "protected"}}
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-legacy", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "sidecar", Selector: selector, AppPort: 8080, AuthenticatorPort: 8081},
+	}
+	// injected before InjectedByAnnotation was set, when only the name label marked the deployment
+	newDeployment := func(name string, annotations map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Labels:      map[string]string{"app": "protected", basicAuthenticatorNameLabel: basicAuthenticator.Name},
+				Annotations: annotations,
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: nginxDefaultContainerName, Image: "nginx"}}},
+				},
+			},
+		}
+	}
+	injected := newDeployment("injected", nil)
+	optedOut := newDeployment("opted-out", map[string]string{InjectAnnotation: "false"})
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, injected, optedOut)
+	baKey := types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}
+
+	if _, err := r.createSidecarAuthenticator(ctx, ctrl.Request{NamespacedName: baKey}, basicAuthenticator, "configmap", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	found := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: injected.Name, Namespace: injected.Namespace}, found); err != nil {
+		t.Fatal(err)
+	}
+	if found.Annotations[InjectedByAnnotation] != basicAuthenticator.Name {
+		t.Errorf("expected the injected-by annotation to be backfilled, got %v", found.Annotations)
+	}
+	if drift := getSidecarDrift(&found.Spec.Template.Spec, nginxDefaultContainerName, "configmap"); drift != "" {
+		t.Errorf("expected the sidecar to be updated in place, got %s", drift)
+	}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: optedOut.Name, Namespace: optedOut.Namespace}, found); err != nil {
+		t.Fatal(err)
+	}
+	if getContainerIndex(found.Spec.Template.Spec.Containers, nginxDefaultContainerName) != -1 {
+		t.Errorf("expected the sidecar to be removed from the opted out deployment, got %v", found.Spec.Template.Spec.Containers)
+	}
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, baKey, latest); err != nil {
+		t.Fatal(err)
+	}
+	if meta.IsStatusConditionTrue(latest.Status.Conditions, ConditionTypeInjectionConflict) {
+		t.Errorf("expected no collision to be reported for its own sidecar, got %v", latest.Status.Conditions)
+	}
+}
+
+func TestInjectorSecondRunLeavesDeploymentUnchanged(t *testing.T) {
+	ctx := context.Background()
+	selector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "protected"}}
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-idempotent", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "sidecar", Selector: selector, AppPort: 8080, AuthenticatorPort: 8081, InMemoryTmp: true},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "protected", Namespace: "default", Labels: map[string]string{"app": "protected"}},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, deployment)
+	baKey := types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}
+	deploymentKey := types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}
+
+	if _, err := r.createSidecarAuthenticator(ctx, ctrl.Request{NamespacedName: baKey}, basicAuthenticator, "configmap", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	// the API server defaults some fields of the injected sidecar
+	injected := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, deploymentKey, injected); err != nil {
+		t.Fatal(err)
+	}
+	podSpec := &injected.Spec.Template.Spec
+	sidecar := &podSpec.Containers[getContainerIndex(podSpec.Containers, nginxDefaultContainerName)]
+	sidecar.TerminationMessagePath = corev1.TerminationMessagePathDefault
+	sidecar.ImagePullPolicy = corev1.PullIfNotPresent
+	sidecar.Ports[0].Protocol = corev1.ProtocolTCP
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Secret != nil {
+			podSpec.Volumes[i].Secret.DefaultMode = pointer.Int32(corev1.SecretVolumeSourceDefaultMode)
+		}
+		if podSpec.Volumes[i].ConfigMap != nil {
+			podSpec.Volumes[i].ConfigMap.DefaultMode = pointer.Int32(corev1.ConfigMapVolumeSourceDefaultMode)
+		}
+	}
+	if err := k8sClient.Update(ctx, injected); err != nil {
+		t.Fatal(err)
+	}
+
+	injection, err := injector(ctx, basicAuthenticator, "configmap", "", "secret", nil, k8sClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(injection.all) != 1 || len(injection.updated) != 0 {
+		t.Fatalf("expected the injected deployment to need no update, got %d updated", len(injection.updated))
+	}
+	if !reflect.DeepEqual(injection.all[0].Spec, injected.Spec) {
+		t.Errorf("expected the second run to leave the deployment spec unchanged, got %v", injection.all[0].Spec)
+	}
+
+	if _, err := r.createSidecarAuthenticator(ctx, ctrl.Request{NamespacedName: baKey}, basicAuthenticator, "configmap", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	found := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, deploymentKey, found); err != nil {
+		t.Fatal(err)
+	}
+	if found.ResourceVersion != injected.ResourceVersion {
+		t.Errorf("expected the deployment not to be updated, resource version changed from %s to %s", injected.ResourceVersion, found.ResourceVersion)
+	}
+}
+
+func TestConfigChangeBumpsChecksumAnnotation(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-checksum", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "deployment", Replicas: 1, AppPort: 3000, AuthenticatorPort: 8080},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	r.credentialName = "credentials"
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	deploymentKey := types.NamespacedName{Name: random_generator.GenerateRandomName(basicAuthenticator.Name, "deployment"), Namespace: "default"}
+	getChecksum := func() string {
+		for _, step := range []subreconciler.FnWithRequest{r.ensureConfigmap, r.ensureDeployment} {
+			if result, err := step(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+				t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+			}
+		}
+		deployment := &appsv1.Deployment{}
+		if err := k8sClient.Get(ctx, deploymentKey, deployment); err != nil {
+			t.Fatal(err)
+		}
+		return deployment.Spec.Template.Annotations[ConfigChecksumAnnotation]
+	}
+
+	checksum := getChecksum()
+	if checksum == "" {
+		t.Fatal("expected a config checksum annotation on the pod template")
+	}
+	if getChecksum() != checksum {
+		t.Error("expected the checksum to stay the same while the config is unchanged")
+	}
+
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	latest.Spec.StripAuthHeader = true
+	if err := k8sClient.Update(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	if bumped := getChecksum(); bumped == checksum {
+		t.Errorf("expected the checksum to change with the config, got %s", bumped)
+	}
+
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	latest.Spec.UseConfigReloader = true
+	if err := k8sClient.Update(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	checksum = getChecksum()
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	latest.Spec.StripAuthHeader = false
+	if err := k8sClient.Update(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded := getChecksum(); reloaded != checksum {
+		t.Errorf("expected the pods not to be rolled when the config reloader is used, got checksum %s", reloaded)
+	}
+}
+
+func TestNetworkPolicyRestrictsIngressToNginx(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-netpol", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			ZeroTrust:         true,
+			NetworkPolicy:     &v1alpha1.NetworkPolicySpec{Enabled: true},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	r.CustomConfig = &config.CustomConfig{NetworkPolicyConf: config.NetworkPolicyConfig{IngressControllerNamespace: "openshift-ingress"}}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+
+	if result, err := r.ensureNetworkPolicies(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+	}
+	for _, name := range []string{"basicauthenticator-netpol-ingress", "basicauthenticator-netpol-allow"} {
+		policy := &networkingv1.NetworkPolicy{}
+		if err := k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, policy); err != nil {
+			t.Fatal(err)
+		}
+		from := policy.Spec.Ingress[0].From
+		if len(from) != 1 || from[0].NamespaceSelector == nil || from[0].NamespaceSelector.MatchLabels[corev1.LabelMetadataName] != "openshift-ingress" {
+			t.Errorf("expected %s to only allow the ingress controller namespace, got %+v", name, from)
+		}
+		if len(policy.OwnerReferences) != 1 || policy.OwnerReferences[0].Name != basicAuthenticator.Name {
+			t.Errorf("expected %s to be owned by the basic authenticator, got %+v", name, policy.OwnerReferences)
+		}
+	}
+
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	peers := []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "client"}}}}
+	latest.Spec.NetworkPolicy.From = peers
+	if err := k8sClient.Update(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.ensureNetworkPolicies(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+	}
+	policy := &networkingv1.NetworkPolicy{}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: "basicauthenticator-netpol-ingress", Namespace: "default"}, policy); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(policy.Spec.Ingress[0].From, peers) {
+		t.Errorf("expected the configured peers to be allowed, got %+v", policy.Spec.Ingress[0].From)
+	}
+
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	latest.Spec.NetworkPolicy.Enabled = false
+	if err := k8sClient.Update(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.ensureNetworkPolicies(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+	}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: "basicauthenticator-netpol-ingress", Namespace: "default"}, policy); !errors.IsNotFound(err) {
+		t.Errorf("expected the network policy to be removed once disabled, got %v", err)
+	}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: "basicauthenticator-netpol-allow", Namespace: "default"}, policy); err != nil {
+		t.Fatal(err)
+	}
+	if policy.Spec.Ingress[0].From != nil {
+		t.Errorf("expected the zero trust policy to allow any source again, got %+v", policy.Spec.Ingress[0].From)
+	}
+}
+
+func TestPodDisruptionBudgetFollowsReplicas(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-pdb", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:                "deployment",
+			Replicas:            1,
+			AppPort:             3000,
+			AuthenticatorPort:   8080,
+			PodDisruptionBudget: &v1alpha1.PodDisruptionBudgetSpec{Enabled: true},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	budgetKey := types.NamespacedName{Name: random_generator.GenerateRandomName(basicAuthenticator.Name, "pdb"), Namespace: "default"}
+	setReplicas := func(replicas int) {
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+			t.Fatal(err)
+		}
+		latest.Spec.Replicas = replicas
+		if err := k8sClient.Update(ctx, latest); err != nil {
+			t.Fatal(err)
+		}
+		if result, err := r.ensurePodDisruptionBudget(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+			t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+		}
+	}
+
+	setReplicas(1)
+	budget := &policyv1.PodDisruptionBudget{}
+	if err := k8sClient.Get(ctx, budgetKey, budget); !errors.IsNotFound(err) {
+		t.Fatalf("expected no pod disruption budget for a single replica, got %v", err)
+	}
+
+	setReplicas(3)
+	if err := k8sClient.Get(ctx, budgetKey, budget); err != nil {
+		t.Fatal(err)
+	}
+	if budget.Spec.MinAvailable == nil || budget.Spec.MinAvailable.IntValue() != 1 {
+		t.Errorf("expected minAvailable to default to 1, got %v", budget.Spec.MinAvailable)
+	}
+	if budget.Spec.Selector.MatchLabels[basicAuthenticatorNameLabel] != basicAuthenticator.Name {
+		t.Errorf("expected the budget to select the nginx pods, got %v", budget.Spec.Selector)
+	}
+	if len(budget.OwnerReferences) != 1 || budget.OwnerReferences[0].Name != basicAuthenticator.Name {
+		t.Errorf("expected the budget to be owned by the basic authenticator, got %+v", budget.OwnerReferences)
+	}
+
+	setReplicas(1)
+	if err := k8sClient.Get(ctx, budgetKey, budget); !errors.IsNotFound(err) {
+		t.Errorf("expected the pod disruption budget to be removed once back to a single replica, got %v", err)
+	}
+}
+
+func TestAutoscalingLeavesReplicasToHorizontalPodAutoscaler(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-hpa", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			Autoscaling:       &v1alpha1.AutoscalingSpec{MinReplicas: 2, MaxReplicas: 5},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	r.configMapName = "configmap"
+	r.credentialName = "credentials"
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	deploymentKey := types.NamespacedName{Name: random_generator.GenerateRandomName(basicAuthenticator.Name, "deployment"), Namespace: "default"}
+	autoscalerKey := types.NamespacedName{Name: random_generator.GenerateRandomName(basicAuthenticator.Name, "hpa"), Namespace: "default"}
+	reconcile := func() *appsv1.Deployment {
+		for _, step := range []subreconciler.FnWithRequest{r.ensureDeployment, r.ensureHorizontalPodAutoscaler} {
+			if result, err := step(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+				t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+			}
+		}
+		deployment := &appsv1.Deployment{}
+		if err := k8sClient.Get(ctx, deploymentKey, deployment); err != nil {
+			t.Fatal(err)
+		}
+		return deployment
+	}
+
+	if deployment := reconcile(); *deployment.Spec.Replicas != 2 {
+		t.Errorf("expected the deployment to start with minReplicas, got %d", *deployment.Spec.Replicas)
+	}
+	autoscaler := &autoscalingv2.HorizontalPodAutoscaler{}
+	if err := k8sClient.Get(ctx, autoscalerKey, autoscaler); err != nil {
+		t.Fatal(err)
+	}
+	if autoscaler.Spec.ScaleTargetRef.Name != deploymentKey.Name || autoscaler.Spec.MaxReplicas != 5 || *autoscaler.Spec.MinReplicas != 2 {
+		t.Errorf("expected the autoscaler to scale the nginx deployment between 2 and 5, got %+v", autoscaler.Spec)
+	}
+	if utilization := autoscaler.Spec.Metrics[0].Resource.Target.AverageUtilization; *utilization != defaultTargetCPUUtilization {
+		t.Errorf("expected the default target CPU utilization, got %d", *utilization)
+	}
+	if len(autoscaler.OwnerReferences) != 1 || autoscaler.OwnerReferences[0].Name != basicAuthenticator.Name {
+		t.Errorf("expected the autoscaler to be owned by the basic authenticator, got %+v", autoscaler.OwnerReferences)
+	}
+
+	scaled := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, deploymentKey, scaled); err != nil {
+		t.Fatal(err)
+	}
+	scaled.Spec.Replicas = pointer.Int32(4)
+	if err := k8sClient.Update(ctx, scaled); err != nil {
+		t.Fatal(err)
+	}
+	if deployment := reconcile(); *deployment.Spec.Replicas != 4 {
+		t.Errorf("expected the replicas set by the autoscaler to be kept, got %d", *deployment.Spec.Replicas)
+	}
+
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	latest.Spec.Autoscaling = nil
+	if err := k8sClient.Update(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	if deployment := reconcile(); *deployment.Spec.Replicas != 1 {
+		t.Errorf("expected the replicas to be managed again once autoscaling is disabled, got %d", *deployment.Spec.Replicas)
+	}
+	if err := k8sClient.Get(ctx, autoscalerKey, autoscaler); !errors.IsNotFound(err) {
+		t.Errorf("expected the autoscaler to be removed once autoscaling is disabled, got %v", err)
+	}
+}
+
+func TestReferencedSecretMissingOrMalformed(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-missing", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "deployment", AppPort: 8080, AuthenticatorPort: 8080, CredentialsSecretRef: "credentials"},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	getReason := func() string {
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+			t.Fatal(err)
+		}
+		condition := meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeCredentialsValid)
+		if condition == nil {
+			return ""
+		}
+		return condition.Reason
+	}
+
+	result, err := r.ensureSecret(ctx, req)
+	if err != nil || result == nil || result.RequeueAfter == 0 {
+		t.Errorf("expected a requeue while the secret is missing, got %v, %v", result, err)
+	}
+	if reason := getReason(); reason != ConditionReasonSecretMissing {
+		t.Errorf("expected reason %s, got %q", ConditionReasonSecretMissing, reason)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+		Data:       map[string][]byte{"username": []byte("user")},
+	}
+	if err := k8sClient.Create(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.ensureSecret(ctx, req); !subreconciler.ShouldHaltOrRequeue(result, err) || err != nil {
+		t.Errorf("expected to halt without an error on a malformed secret, got %v, %v", result, err)
+	}
+	if reason := getReason(); reason != ConditionReasonSecretMalformed {
+		t.Errorf("expected reason %s, got %q", ConditionReasonSecretMalformed, reason)
+	}
+
+	secret.Data["password"] = []byte("password")
+	if err := k8sClient.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.ensureSecret(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected to continue once the secret is fixed, got %v, %v", result, err)
+	}
+	if reason := getReason(); reason != ConditionReasonCredentialsValid {
+		t.Errorf("expected the credentials to be valid again, got reason %q", reason)
+	}
+}
+
+func TestCredentialsSecretKeys(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-keys", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:                  "deployment",
+			AppPort:               8080,
+			AuthenticatorPort:     8080,
+			CredentialsSecretRef:  "credentials",
+			CredentialsSecretKeys: &v1alpha1.CredentialsSecretKeys{Username: "user", Password: "pass"},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+		Data:       map[string][]byte{"user": []byte("admin"), "pass": []byte("secret")},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, secret)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	secretKey := types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}
+	getReason := func() string {
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+			t.Fatal(err)
+		}
+		condition := meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeCredentialsValid)
+		if condition == nil {
+			return ""
+		}
+		return condition.Reason
+	}
+
+	if result, err := r.ensureSecret(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected the renamed username and password keys to be read, got %v, %v", result, err)
+	}
+	if err := k8sClient.Get(ctx, secretKey, secret); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(secret.Data[SecretHtpasswdField]), "admin:") {
+		t.Errorf("expected the htpasswd to be generated from the renamed keys, got %q", secret.Data[SecretHtpasswdField])
+	}
+
+	hash, err := htpasswd.ApacheHash("password", "saltsalt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	htpasswdFile := "external:" + hash
+	secret.Data = map[string][]byte{"user": []byte("admin"), "pass": []byte("secret"), "auth": []byte(htpasswdFile)}
+	if err := k8sClient.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Get(ctx, req.NamespacedName, basicAuthenticator); err != nil {
+		t.Fatal(err)
+	}
+	basicAuthenticator.Spec.CredentialsSecretKeys.Htpasswd = "auth"
+	if err := k8sClient.Update(ctx, basicAuthenticator); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.ensureSecret(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected the htpasswd key to be used, got %v, %v", result, err)
+	}
+	if err := k8sClient.Get(ctx, secretKey, secret); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := secret.Data[SecretHtpasswdField]; exists || string(secret.Data["auth"]) != htpasswdFile {
+		t.Errorf("expected the htpasswd file to be used verbatim, got %v", secret.Data)
+	}
+	items := getCredentialItems(basicAuthenticator)
+	if items[0].Key != "auth" || items[0].Path != SecretHtpasswdField {
+		t.Errorf("expected the htpasswd key to be mounted as %s, got %+v", SecretHtpasswdField, items)
+	}
+
+	delete(secret.Data, "auth")
+	if err := k8sClient.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.ensureSecret(ctx, req); !subreconciler.ShouldHaltOrRequeue(result, err) || err != nil {
+		t.Errorf("expected to halt without an error once the htpasswd key is missing, got %v, %v", result, err)
+	}
+	if reason := getReason(); reason != ConditionReasonSecretMalformed {
+		t.Errorf("expected reason %s, got %q", ConditionReasonSecretMalformed, reason)
+	}
+}
+
+func TestRequeueWhileDeploymentIsProgressing(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-progress", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "deployment", Replicas: 2, AppPort: 3000, AuthenticatorPort: 8080},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	r.CustomConfig = &config.CustomConfig{ReconcileConf: config.ReconcileConfig{ProgressRequeueInterval: 5 * time.Second}}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	deploymentKey := types.NamespacedName{Name: random_generator.GenerateRandomName(basicAuthenticator.Name, "deployment"), Namespace: "default"}
+	reconcileDeployment := func() time.Duration {
+		r.initVars(req)
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+			t.Fatal(err)
+		}
+		if result, err := r.createDeploymentAuthenticator(ctx, req, latest, "config", "credentials"); subreconciler.ShouldHaltOrRequeue(result, err) {
+			t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+		}
+		return r.requeueAfter
+	}
+
+	if requeueAfter := reconcileDeployment(); requeueAfter != 5*time.Second {
+		t.Errorf("expected a requeue after the deployment is created, got %v", requeueAfter)
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, deploymentKey, deployment); err != nil {
+		t.Fatal(err)
+	}
+	deployment.Status.ReadyReplicas = 1
+	if err := k8sClient.Status().Update(ctx, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if requeueAfter := reconcileDeployment(); requeueAfter != 5*time.Second {
+		t.Errorf("expected a requeue while only some replicas are ready, got %v", requeueAfter)
+	}
+
+	if err := k8sClient.Get(ctx, deploymentKey, deployment); err != nil {
+		t.Fatal(err)
+	}
+	deployment.Status.ReadyReplicas = 2
+	if err := k8sClient.Status().Update(ctx, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if requeueAfter := reconcileDeployment(); requeueAfter != 0 {
+		t.Errorf("expected no requeue once all replicas are ready, got %v", requeueAfter)
+	}
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest.Status.ReadyReplicas != 2 {
+		t.Errorf("expected the ready replicas to converge to 2, got %d", latest.Status.ReadyReplicas)
+	}
+}
+
+func TestDeploymentReadinessFollowsNginxDeployment(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-ready", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "deployment", Replicas: 2, AppPort: 3000, AuthenticatorPort: 8080},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	deploymentKey := types.NamespacedName{Name: random_generator.GenerateRandomName(basicAuthenticator.Name, "deployment"), Namespace: "default"}
+	reconcileDeployment := func() *metav1.Condition {
+		r.initVars(req)
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+			t.Fatal(err)
+		}
+		if result, err := r.createDeploymentAuthenticator(ctx, req, latest, "config", "credentials"); subreconciler.ShouldHaltOrRequeue(result, err) {
+			t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+		}
+		if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+			t.Fatal(err)
+		}
+		return meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeReady)
+	}
+
+	if condition := reconcileDeployment(); condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != ConditionReasonTargetsNotReady {
+		t.Errorf("expected not to be ready while the nginx deployment rolls out, got %v", condition)
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, deploymentKey, deployment); err != nil {
+		t.Fatal(err)
+	}
+	deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: deployment.Generation, UpdatedReplicas: 2, ReadyReplicas: 2, AvailableReplicas: 2}
+	if err := k8sClient.Status().Update(ctx, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if condition := reconcileDeployment(); condition == nil || condition.Status != metav1.ConditionTrue {
+		t.Errorf("expected to be ready once the nginx deployment is available, got %v", condition)
+	}
+}
+
+// takenNameClient creates a secret, built by takenBy, under the name of every secret read before it exists
+type takenNameClient struct {
+	client.Client
+	takenBy func(name string) *corev1.Secret
+}
+
+func (c *takenNameClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	err := c.Client.Get(ctx, key, obj, opts...)
+	if _, ok := obj.(*corev1.Secret); ok && errors.IsNotFound(err) {
+		taken := c.takenBy(key.Name)
+		taken.Namespace = key.Namespace
+		if err := c.Client.Create(ctx, taken); err != nil {
+			return err
+		}
+		return c.Client.Get(ctx, key, obj, opts...)
+	}
+	return err
+}
+
+func TestSelectorIgnoredInDeploymentMode(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-selector", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			Selector:          metav1.LabelSelector{MatchLabels: map[string]string{"app": "protected"}},
+		},
+	}
+	r, _ := newTestReconciler(t, basicAuthenticator)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	r.configMapName = "configmap"
+	r.credentialName = "credentials"
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+
+	if result, err := r.ensureDeployment(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected a single event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, EventReasonSelectorIgnored) {
+		t.Errorf("expected the ignored selector to be reported, got %q", event)
+	}
+}
+
+func TestGeneratedSecretNameTaken(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-taken", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "deployment", AppPort: 3000, AuthenticatorPort: 8080},
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	newReconciler := func(takenBy func(name string) *corev1.Secret) *BasicAuthenticatorReconciler {
+		r, fakeClient := newTestReconciler(t, basicAuthenticator.DeepCopy())
+		r.Client = &takenNameClient{Client: fakeClient, takenBy: takenBy}
+		return r
+	}
+
+	r := newReconciler(func(name string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name}, Data: map[string][]byte{"username": []byte("other")}}
+	})
+	result, err := r.ensureSecret(ctx, req)
+	if err != nil || result == nil || result.Requeue || result.RequeueAfter != 0 {
+		t.Errorf("expected to stop without requeuing on a name conflict, got %v, %v", result, err)
+	}
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := r.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	condition := meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeCredentialsValid)
+	if condition == nil || condition.Reason != ConditionReasonSecretNameConflict {
+		t.Errorf("expected reason %s, got %+v", ConditionReasonSecretNameConflict, condition)
+	}
+	var secrets corev1.SecretList
+	if err := r.List(ctx, &secrets); err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets.Items) != maxSecretNameAttempts {
+		t.Errorf("expected %d names to be tried, got %d", maxSecretNameAttempts, len(secrets.Items))
+	}
+
+	r = newReconciler(func(name string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{basicAuthenticatorNameLabel: basicAuthenticator.Name}},
+			Data:       map[string][]byte{"username": []byte("user"), "password": []byte("pass")},
+		}
+	})
+	if result, err := r.ensureSecret(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected to continue reconciling with the adopted secret, got %v, %v", result, err)
+	}
+	adopted := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: r.credentialName, Namespace: "default"}, adopted); err != nil {
+		t.Fatal(err)
+	}
+	if len(adopted.OwnerReferences) != 1 || adopted.OwnerReferences[0].Name != basicAuthenticator.Name {
+		t.Errorf("expected the secret to be adopted, got owner references %+v", adopted.OwnerReferences)
+	}
+	if _, ok := adopted.Data[SecretHtpasswdField]; !ok {
+		t.Error("expected the adopted secret to get an htpasswd field")
+	}
+}
+
+func TestGeneratedUsernameInStatus(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-username", Namespace: "default"},
+		Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "deployment", AppPort: 3000, AuthenticatorPort: 8080},
+	}
+	userSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "user-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"username": []byte("user"), "password": []byte("pass")},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, userSecret)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+
+	if result, err := r.ensureSecret(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+	}
+	generated := &corev1.Secret{}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: r.credentialName, Namespace: "default"}, generated); err != nil {
+		t.Fatal(err)
+	}
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest.Status.GeneratedUsername == "" || latest.Status.GeneratedUsername != string(generated.Data["username"]) {
+		t.Errorf("expected the generated username %q in status, got %q", generated.Data["username"], latest.Status.GeneratedUsername)
+	}
+
+	latest.Spec.CredentialsSecretRef = userSecret.Name
+	if err := k8sClient.Update(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.ensureSecret(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+	}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest.Status.GeneratedUsername != "" {
+		t.Errorf("expected no generated username with a user provided secret, got %q", latest.Status.GeneratedUsername)
+	}
+}
+
+func TestErrorPagesConfigMapValidated(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-errors", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			ErrorPages: &v1alpha1.ErrorPagesSpec{
+				ConfigMapName: "error-pages",
+				Pages:         []v1alpha1.ErrorPage{{Code: 401, Key: "401.html"}, {Code: 403, Key: "403.html"}},
+			},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	getReason := func() string {
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+			t.Fatal(err)
+		}
+		condition := meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeErrorPagesValid)
+		if condition == nil {
+			return ""
+		}
+		return condition.Reason
+	}
+
+	result, err := r.validateErrorPages(ctx, req)
+	if !subreconciler.ShouldHaltOrRequeue(result, err) || err != nil {
+		t.Fatalf("expected provisioning to halt without the configmap, got %v, %v", result, err)
+	}
+	if reason := getReason(); reason != ConditionReasonErrorPagesNotFound {
+		t.Errorf("expected reason %s, got %q", ConditionReasonErrorPagesNotFound, reason)
+	}
+
+	pages := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "error-pages", Namespace: "default"},
+		Data:       map[string]string{"401.html": "<h1>Unauthorized</h1>"},
+	}
+	if err := k8sClient.Create(ctx, pages); err != nil {
+		t.Fatal(err)
+	}
+	result, err = r.validateErrorPages(ctx, req)
+	if !subreconciler.ShouldHaltOrRequeue(result, err) || err != nil {
+		t.Fatalf("expected provisioning to halt with a missing page, got %v, %v", result, err)
+	}
+	if reason := getReason(); reason != ConditionReasonErrorPageKeyNotFound {
+		t.Errorf("expected reason %s, got %q", ConditionReasonErrorPageKeyNotFound, reason)
+	}
+
+	pages.Data["403.html"] = "<h1>Forbidden</h1>"
+	if err := k8sClient.Update(ctx, pages); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.validateErrorPages(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+	}
+	if reason := getReason(); reason != ConditionReasonErrorPagesFound {
+		t.Errorf("expected reason %s, got %q", ConditionReasonErrorPagesFound, reason)
+	}
+	if requests := r.findConfigMapReferencingBasicAuthenticators(pages); len(requests) != 1 || requests[0].NamespacedName != req.NamespacedName {
+		t.Errorf("expected a change of the error pages configmap to enqueue the basic authenticator, got %v", requests)
+	}
+}
+
+func TestPathCredentialsSecretsValidated(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-paths", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			ProtectedPaths:    []string{"/admin"},
+			PathCredentials:   []v1alpha1.PathCredential{{Path: "/admin", CredentialsSecretRef: "admin-credentials"}},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	getReason := func() string {
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+			t.Fatal(err)
+		}
+		condition := meta.FindStatusCondition(latest.Status.Conditions, ConditionTypePathCredentialsValid)
+		if condition == nil {
+			return ""
+		}
+		return condition.Reason
+	}
+
+	result, err := r.ensurePathCredentials(ctx, req)
+	if !subreconciler.ShouldHaltOrRequeue(result, err) || err != nil {
+		t.Fatalf("expected provisioning to halt without the secret, got %v, %v", result, err)
+	}
+	if reason := getReason(); reason != ConditionReasonSecretMissing {
+		t.Errorf("expected reason %s, got %q", ConditionReasonSecretMissing, reason)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "admin-credentials", Namespace: "default"},
+		Data:       map[string][]byte{SecretUsernameField: []byte("admin")},
+	}
+	if err := k8sClient.Create(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	result, err = r.ensurePathCredentials(ctx, req)
+	if !subreconciler.ShouldHaltOrRequeue(result, err) || err != nil {
+		t.Fatalf("expected provisioning to halt without a password, got %v, %v", result, err)
+	}
+	if reason := getReason(); reason != ConditionReasonSecretMalformed {
+		t.Errorf("expected reason %s, got %q", ConditionReasonSecretMalformed, reason)
+	}
+
+	secret.Data[SecretPasswordField] = []byte("secret")
+	if err := k8sClient.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.ensurePathCredentials(ctx, req); subreconciler.ShouldHaltOrRequeue(result, err) {
+		t.Fatalf("expected to continue reconciling, got %v, %v", result, err)
+	}
+	if reason := getReason(); reason != ConditionReasonCredentialsValid {
+		t.Errorf("expected reason %s, got %q", ConditionReasonCredentialsValid, reason)
+	}
+	if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret); err != nil {
+		t.Fatal(err)
+	}
+	written := string(secret.Data[SecretHtpasswdField])
+	if err := htpasswd.ValidateHtpasswd(written); err != nil || !strings.HasPrefix(written, "admin:") {
+		t.Fatalf("expected the htpasswd file of admin to be written, got %q: %v", written, err)
+	}
+	if _, err := r.ensurePathCredentials(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data[SecretHtpasswdField]) != written {
+		t.Error("expected the htpasswd file to be kept while the credentials are unchanged")
+	}
+	if requests := r.findReferencingBasicAuthenticators(secret); len(requests) != 1 || requests[0].NamespacedName != req.NamespacedName {
+		t.Errorf("expected a change of the path credentials secret to enqueue the basic authenticator, got %v", requests)
+	}
+}
+
+func TestConfigOnlyRemovesDeployment(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-config-only", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			ManageDeployment:  pointer.Bool(true),
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	deploymentKey := types.NamespacedName{Name: random_generator.GenerateRandomName(basicAuthenticator.Name, "deployment"), Namespace: "default"}
+	serviceKey := types.NamespacedName{Name: getNginxServiceName(basicAuthenticator), Namespace: "default"}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Get(ctx, deploymentKey, &appsv1.Deployment{}); err != nil {
+		t.Fatalf("expected the nginx deployment to be created, got %v", err)
+	}
+	if err := k8sClient.Get(ctx, serviceKey, &corev1.Service{}); err != nil {
+		t.Fatalf("expected the nginx service to be created, got %v", err)
+	}
+
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	latest.Spec.ManageDeployment = pointer.Bool(false)
+	if err := k8sClient.Update(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Get(ctx, deploymentKey, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the nginx deployment to be deleted, got %v", err)
+	}
+	if err := k8sClient.Get(ctx, serviceKey, &corev1.Service{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the nginx service to be deleted, got %v", err)
+	}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest.Status.State != StatusConfigOnly {
+		t.Errorf("expected state %s, got %q", StatusConfigOnly, latest.Status.State)
+	}
+	if condition := meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeReady); condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != ConditionReasonConfigOnly {
+		t.Errorf("expected to be ready once the config is generated, got %v", condition)
+	}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: latest.Status.CredentialsSecretRef, Namespace: "default"}, &corev1.Secret{}); err != nil {
+		t.Errorf("expected the credentials secret to be kept, got %v", err)
+	}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: random_generator.GenerateRandomName(basicAuthenticator.Name, "configmap"), Namespace: "default"}, &corev1.ConfigMap{}); err != nil {
+		t.Errorf("expected the nginx configmap to be kept, got %v", err)
+	}
+}
+
+func TestManagedResourcesInStatus(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-inventory", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			Ingress:           &v1alpha1.IngressSpec{Host: "app.example.com"},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	getManagedKinds := func() []string {
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+			t.Fatal(err)
+		}
+		kinds := make([]string, 0, len(latest.Status.ManagedResources))
+		for _, resource := range latest.Status.ManagedResources {
+			if resource.Namespace != "default" || resource.Name == "" {
+				t.Errorf("expected a named resource in the namespace of the basic authenticator, got %+v", resource)
+			}
+			kinds = append(kinds, resource.Kind)
+		}
+		return kinds
+	}
+
+	expected := []string{"Secret", "ConfigMap", "Deployment", "Service", "Ingress"}
+	if kinds := getManagedKinds(); !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("expected managed resources %v, got %v", expected, kinds)
+	}
+
+	latest := &v1alpha1.BasicAuthenticator{}
+	if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+		t.Fatal(err)
+	}
+	latest.Spec.Ingress = nil
+	if err := k8sClient.Update(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"Secret", "ConfigMap", "Deployment", "Service"}
+	if kinds := getManagedKinds(); !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("expected the removed ingress to be dropped from the managed resources %v, got %v", expected, kinds)
+	}
+}
+
+func TestDriftedSidecarInjectedAgain(t *testing.T) {
+	ctx := context.Background()
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-drift", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "sidecar",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			Selector:          metav1.LabelSelector{MatchLabels: map[string]string{"app": "target"}},
+		},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "target", Namespace: "default", Labels: map[string]string{"app": "target"}},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+			},
+		},
+	}
+	r, k8sClient := newTestReconciler(t, basicAuthenticator, deployment)
+	recorder := record.NewFakeRecorder(20)
+	r.Recorder = recorder
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: basicAuthenticator.Name, Namespace: basicAuthenticator.Namespace}}
+	deploymentKey := types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}
+	getDriftCondition := func() *metav1.Condition {
+		latest := &v1alpha1.BasicAuthenticator{}
+		if err := k8sClient.Get(ctx, req.NamespacedName, latest); err != nil {
+			t.Fatal(err)
+		}
+		return meta.FindStatusCondition(latest.Status.Conditions, ConditionTypeDriftDetected)
+	}
+	drainEvents := func() string {
+		var events []string
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		return strings.Join(events, "\n")
+	}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if condition := getDriftCondition(); condition != nil {
+		t.Errorf("expected no drift condition after the first injection, got %+v", condition)
+	}
+	if events := drainEvents(); strings.Contains(events, EventReasonDriftDetected) {
+		t.Errorf("expected no drift events after the first injection, got:\n%s", events)
+	}
+
+	target := &appsv1.Deployment{}
+	if err := k8sClient.Get(ctx, deploymentKey, target); err != nil {
+		t.Fatal(err)
+	}
+	target.Spec.Template.Spec.Containers = target.Spec.Template.Spec.Containers[:1]
+	if err := k8sClient.Update(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sClient.Get(ctx, deploymentKey, target); err != nil {
+		t.Fatal(err)
+	}
+	if getContainerIndex(target.Spec.Template.Spec.Containers, nginxDefaultContainerName) == -1 {
+		t.Fatal("expected the removed sidecar to be injected again")
+	}
+	condition := getDriftCondition()
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != ConditionReasonSidecarRepaired || !strings.Contains(condition.Message, "deployment target") {
+		t.Errorf("expected a drift condition naming the deployment, got %+v", condition)
+	}
+	events := drainEvents()
+	if strings.Count(events, EventReasonDriftDetected) != 2 || strings.Contains(events, EventReasonSidecarInjected) {
+		t.Errorf("expected drift events on the deployment and the basic authenticator instead of an injection, got:\n%s", events)
+	}
+
+	idx := getContainerIndex(target.Spec.Template.Spec.Containers, nginxDefaultContainerName)
+	target.Spec.Template.Spec.Containers[idx].VolumeMounts = nil
+	if err := k8sClient.Update(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if condition := getDriftCondition(); condition == nil || !strings.Contains(condition.Message, "no longer mounts the nginx config") {
+		t.Errorf("expected the unmounted config to be reported as drift, got %+v", condition)
+	}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if condition := getDriftCondition(); condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != ConditionReasonNoDrift {
+		t.Errorf("expected the drift condition to turn false once nothing drifted, got %+v", condition)
+	}
+}
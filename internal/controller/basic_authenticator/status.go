@@ -0,0 +1,35 @@
+package basic_authenticator
+
+import (
+	"context"
+	"github.com/snapp-incubator/simple-authenticator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setCondition sets the given condition on basicAuthenticator's status.
+// The status is only written if the condition actually changed, to avoid triggering needless reconciles.
+func (r *BasicAuthenticatorReconciler) setCondition(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, conditionType string, status metav1.ConditionStatus, reason, message string) error {
+	current := meta.FindStatusCondition(basicAuthenticator.Status.Conditions, conditionType)
+	if current != nil && current.Status == status && current.Reason == reason && current.Message == message &&
+		current.ObservedGeneration == basicAuthenticator.Generation {
+		return nil
+	}
+	meta.SetStatusCondition(&basicAuthenticator.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: basicAuthenticator.Generation,
+	})
+	return r.Status().Update(ctx, basicAuthenticator)
+}
+
+// removeCondition removes the given condition type from basicAuthenticator's status if it exists
+func (r *BasicAuthenticatorReconciler) removeCondition(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, conditionType string) error {
+	if meta.FindStatusCondition(basicAuthenticator.Status.Conditions, conditionType) == nil {
+		return nil
+	}
+	meta.RemoveStatusCondition(&basicAuthenticator.Status.Conditions, conditionType)
+	return r.Status().Update(ctx, basicAuthenticator)
+}
@@ -1,9 +1,80 @@
 package basic_authenticator
 
 import (
+	"github.com/snapp-incubator/simple-authenticator/api/v1alpha1"
 	"github.com/snapp-incubator/simple-authenticator/internal/config"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"strings"
+	"time"
 )
 
+// getUpstreamServiceKey returns the service AppService refers to, if it is written as a cluster service name like
+// "svc", "svc.namespace" or "svc.namespace.svc.cluster.local". "svc.namespace" may also be a host name outside the cluster.
+func getUpstreamServiceKey(basicAuthenticator *v1alpha1.BasicAuthenticator) (types.NamespacedName, bool) {
+	parts := strings.Split(basicAuthenticator.Spec.AppService, ".")
+	switch {
+	case len(parts) == 1:
+		return types.NamespacedName{Name: parts[0], Namespace: basicAuthenticator.Namespace}, true
+	case len(parts) == 2 || (len(parts) > 2 && parts[2] == "svc"):
+		return types.NamespacedName{Name: parts[0], Namespace: parts[1]}, true
+	default:
+		return types.NamespacedName{}, false
+	}
+}
+
+var routeGVK = schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+
+// isRouteAPIAvailable reports whether the cluster serves OpenShift Routes
+func isRouteAPIAvailable(mapper meta.RESTMapper) bool {
+	_, err := mapper.RESTMapping(routeGVK.GroupKind(), routeGVK.Version)
+	return err == nil
+}
+
+// newRoute returns an empty Route. Routes are handled as unstructured objects to avoid depending on the OpenShift API.
+func newRoute() *unstructured.Unstructured {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(routeGVK)
+	return route
+}
+
+// getEffectiveConfig shallow-merges the overrides of the basicAuthenticator's namespace and then its ConfigOverrides
+// over the operator's CustomConfig. The returned config is a copy, so the operator-wide config is never changed by a single object.
+func getEffectiveConfig(customConfig *config.CustomConfig, basicAuthenticator *v1alpha1.BasicAuthenticator) *config.CustomConfig {
+	effectiveConfig := config.CustomConfig{}
+	if customConfig != nil {
+		effectiveConfig = *customConfig
+	}
+	if namespaceConfig, exists := effectiveConfig.NamespaceConfs[basicAuthenticator.Namespace]; exists {
+		if namespaceConfig.Image != "" {
+			effectiveConfig.WebserverConf.Image = namespaceConfig.Image
+		}
+		if namespaceConfig.Resources != nil {
+			effectiveConfig.WebserverConf.Resources = *namespaceConfig.Resources
+		}
+	}
+	if isDigestAuth(basicAuthenticator) {
+		// only an image built with the auth_digest module can serve digest auth, so the default image is not used
+		effectiveConfig.WebserverConf.Image = effectiveConfig.WebserverConf.DigestImage
+	}
+	overrides := basicAuthenticator.Spec.ConfigOverrides
+	if overrides == nil {
+		return &effectiveConfig
+	}
+	if overrides.Image != "" {
+		effectiveConfig.WebserverConf.Image = overrides.Image
+	}
+	if overrides.Resources != nil {
+		effectiveConfig.WebserverConf.Resources = *overrides.Resources
+	}
+	return &effectiveConfig
+}
+
 func getNginxContainerImage(customConfig *config.CustomConfig) string {
 
 	if customConfig != nil && customConfig.WebserverConf.Image != "" {
@@ -17,3 +88,141 @@ func getNginxContainerName(customConfig *config.CustomConfig) string {
 	}
 	return nginxDefaultContainerName
 }
+func getReloaderContainerImage(customConfig *config.CustomConfig) string {
+	if customConfig != nil && customConfig.ReloaderConf.Image != "" {
+		return customConfig.ReloaderConf.Image
+	}
+	return reloaderDefaultImageAddress
+}
+
+func getNginxContainerResources(customConfig *config.CustomConfig) corev1.ResourceRequirements {
+	if customConfig != nil {
+		return customConfig.WebserverConf.Resources
+	}
+	return corev1.ResourceRequirements{}
+}
+
+// getSidecarContainerResources returns the resources of the injected sidecar, which fall back to the nginx container's
+func getSidecarContainerResources(customConfig *config.CustomConfig, basicAuthenticator *v1alpha1.BasicAuthenticator) corev1.ResourceRequirements {
+	overrides := basicAuthenticator.Spec.ConfigOverrides
+	if overrides != nil && overrides.SidecarResources != nil {
+		return *overrides.SidecarResources
+	}
+	return getNginxContainerResources(customConfig)
+}
+
+func getNginxContainerSecurityContext(customConfig *config.CustomConfig) *corev1.SecurityContext {
+	if customConfig != nil && customConfig.WebserverConf.SecurityContext != nil {
+		return customConfig.WebserverConf.SecurityContext.DeepCopy()
+	}
+	return &corev1.SecurityContext{
+		RunAsNonRoot:             pointer.Bool(true),
+		RunAsUser:                pointer.Int64(nginxDefaultUID),
+		AllowPrivilegeEscalation: pointer.Bool(false),
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+func getNginxPodSecurityContext(customConfig *config.CustomConfig) *corev1.PodSecurityContext {
+	if customConfig != nil && customConfig.WebserverConf.PodSecurityContext != nil {
+		return customConfig.WebserverConf.PodSecurityContext.DeepCopy()
+	}
+	return &corev1.PodSecurityContext{
+		RunAsNonRoot: pointer.Bool(true),
+		RunAsUser:    pointer.Int64(nginxDefaultUID),
+		RunAsGroup:   pointer.Int64(nginxDefaultUID),
+		FSGroup:      pointer.Int64(nginxDefaultUID),
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// isDigestAuth reports whether nginx should ask for digest auth. Objects created before AuthType existed use basic auth
+func isDigestAuth(basicAuthenticator *v1alpha1.BasicAuthenticator) bool {
+	return basicAuthenticator.Spec.AuthType == v1alpha1.AuthTypeDigest
+}
+
+// isConfigOnly reports whether only the credentials secret and the nginx config are managed for basicAuthenticator,
+// leaving the nginx deployment to its users
+func isConfigOnly(basicAuthenticator *v1alpha1.BasicAuthenticator) bool {
+	manageDeployment := basicAuthenticator.Spec.ManageDeployment
+	return basicAuthenticator.Spec.Type != "sidecar" && manageDeployment != nil && !*manageDeployment
+}
+
+// isExclusiveInjection reports whether a deployment may only be injected by a single basicAuthenticator
+func isExclusiveInjection(customConfig *config.CustomConfig) bool {
+	return customConfig != nil && customConfig.SidecarConf.ExclusiveInjection
+}
+
+// isNamespaceAllowed reports whether the operator may act in namespace, which every namespace is unless AllowedNamespaces is set
+func isNamespaceAllowed(customConfig *config.CustomConfig, namespace string) bool {
+	if customConfig == nil || len(customConfig.AllowedNamespaces) == 0 {
+		return true
+	}
+	return existsInList(customConfig.AllowedNamespaces, namespace)
+}
+
+// isProxyHeadersEnabled reports whether nginx should pass the client information headers to the upstream
+func isProxyHeadersEnabled(customConfig *config.CustomConfig) bool {
+	return customConfig == nil || !customConfig.WebserverConf.DisableProxyHeaders
+}
+
+// getIngressControllerNamespace returns the namespace allowed to reach nginx when a network policy lists no peers
+func getIngressControllerNamespace(customConfig *config.CustomConfig) string {
+	if customConfig != nil && customConfig.NetworkPolicyConf.IngressControllerNamespace != "" {
+		return customConfig.NetworkPolicyConf.IngressControllerNamespace
+	}
+	return defaultIngressControllerNamespace
+}
+
+// isOrderedApply reports whether each resource should be established before the next one is applied
+func isOrderedApply(customConfig *config.CustomConfig) bool {
+	return customConfig != nil && customConfig.ReconcileConf.OrderedApply
+}
+
+func getMaxConcurrentReconciles(customConfig *config.CustomConfig) int {
+	if customConfig != nil && customConfig.ReconcileConf.MaxConcurrentReconciles > 0 {
+		return customConfig.ReconcileConf.MaxConcurrentReconciles
+	}
+	return defaultMaxConcurrentReconciles
+}
+
+func getEstablishTimeout(customConfig *config.CustomConfig) time.Duration {
+	if customConfig != nil && customConfig.ReconcileConf.EstablishTimeout > 0 {
+		return customConfig.ReconcileConf.EstablishTimeout
+	}
+	return defaultEstablishTimeout
+}
+
+func getProgressRequeueInterval(customConfig *config.CustomConfig) time.Duration {
+	if customConfig != nil && customConfig.ReconcileConf.ProgressRequeueInterval > 0 {
+		return customConfig.ReconcileConf.ProgressRequeueInterval
+	}
+	return defaultProgressRequeueInterval
+}
+
+// isDeploymentProgressing reports whether fewer replicas of deployment are ready than it desires
+func isDeploymentProgressing(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ReadyReplicas < replicas
+}
+
+// isDeploymentRolledOut reports whether all replicas of deployment run its latest pod template and are available
+func isDeploymentRolledOut(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas
+}
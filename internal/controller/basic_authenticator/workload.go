@@ -1,8 +1,10 @@
 package basic_authenticator
 
 import (
+	"bytes"
 	"context"
-	defaultError "errors"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/snapp-incubator/simple-authenticator/api/v1alpha1"
@@ -10,22 +12,40 @@ import (
 	"github.com/snapp-incubator/simple-authenticator/pkg/htpasswd"
 	"github.com/snapp-incubator/simple-authenticator/pkg/random_generator"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+	"path"
+	"reflect"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
 	"strings"
+	texttemplate "text/template"
+	"time"
 )
 
 // TODO: come up with better name that "nginx"
-func createNginxDeployment(basicAuthenticator *v1alpha1.BasicAuthenticator, configMapName string, credentialName string, customConfig *config.CustomConfig) *appsv1.Deployment {
+func createNginxDeployment(basicAuthenticator *v1alpha1.BasicAuthenticator, configMapName string, configChecksum string, credentialName string, customConfig *config.CustomConfig) *appsv1.Deployment {
 	nginxImageAddress := getNginxContainerImage(customConfig)
 	nginxContainerName := getNginxContainerName(customConfig)
+	nginxContainerResources := getNginxContainerResources(customConfig)
+	nginxSecurityContext := getNginxContainerSecurityContext(customConfig)
+	nginxPodSecurityContext := getNginxPodSecurityContext(customConfig)
 
 	deploymentName := random_generator.GenerateRandomName(basicAuthenticator.Name, "deployment")
-	replicas := int32(basicAuthenticator.Spec.Replicas)
+	replicas := int32(getMinReplicas(basicAuthenticator))
 	authenticatorPort := int32(basicAuthenticator.Spec.AuthenticatorPort)
+	if basicAuthenticator.Spec.UseConfigReloader {
+		// the reloader reloads nginx gracefully, so the pods are not rolled on config changes
+		configChecksum = ""
+	}
 
 	basicAuthLabels := map[string]string{"app": deploymentName, basicAuthenticatorNameLabel: basicAuthenticator.Name}
 
@@ -41,14 +61,24 @@ func createNginxDeployment(basicAuthenticator *v1alpha1.BasicAuthenticator, conf
 			Selector: &metav1.LabelSelector{MatchLabels: basicAuthLabels},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:   deploymentName,
-					Labels: basicAuthLabels,
+					Name:        deploymentName,
+					Labels:      basicAuthLabels,
+					Annotations: getPodTemplateAnnotations(basicAuthenticator, configChecksum),
 				},
 				Spec: corev1.PodSpec{
+					SecurityContext:               nginxPodSecurityContext,
+					ImagePullSecrets:              getImagePullSecrets(basicAuthenticator),
+					TerminationGracePeriodSeconds: pointer.Int64(getTerminationGracePeriodSeconds(basicAuthenticator)),
 					Containers: []corev1.Container{
 						{
-							Name:  nginxContainerName,
-							Image: nginxImageAddress,
+							Name:            nginxContainerName,
+							Image:           nginxImageAddress,
+							ImagePullPolicy: getImagePullPolicy(basicAuthenticator),
+							Args:            getNginxArgs(basicAuthenticator),
+							Resources:       nginxContainerResources,
+							SecurityContext: nginxSecurityContext,
+							StartupProbe:    getStartupProbe(basicAuthenticator),
+							Lifecycle:       getNginxLifecycle(basicAuthenticator),
 							Ports: []corev1.ContainerPort{
 								{
 									ContainerPort: authenticatorPort,
@@ -82,12 +112,7 @@ func createNginxDeployment(basicAuthenticator *v1alpha1.BasicAuthenticator, conf
 							VolumeSource: corev1.VolumeSource{
 								Secret: &corev1.SecretVolumeSource{
 									SecretName: credentialName,
-									Items: []corev1.KeyToPath{
-										{
-											Key:  SecretHtpasswdField,
-											Path: SecretHtpasswdField,
-										},
-									},
+									Items:      getCredentialItems(basicAuthenticator),
 								},
 							},
 						},
@@ -96,18 +121,73 @@ func createNginxDeployment(basicAuthenticator *v1alpha1.BasicAuthenticator, conf
 			},
 		},
 	}
+	setNodePlacement(&deploy.Spec.Template.Spec, basicAuthenticator)
+	deploy.Spec.Template.Spec.TopologySpreadConstraints = getTopologySpreadConstraints(basicAuthenticator, basicAuthLabels)
+	if basicAuthenticator.Spec.InMemoryTmp {
+		deploy.Spec.Template.Spec.Containers[0].VolumeMounts = append(deploy.Spec.Template.Spec.Containers[0].VolumeMounts, getTmpVolumeMount())
+		deploy.Spec.Template.Spec.Volumes = append(deploy.Spec.Template.Spec.Volumes, getTmpVolume())
+	}
+	if basicAuthenticator.Spec.ErrorPages != nil {
+		deploy.Spec.Template.Spec.Containers[0].VolumeMounts = append(deploy.Spec.Template.Spec.Containers[0].VolumeMounts, getErrorPagesVolumeMount())
+		deploy.Spec.Template.Spec.Volumes = append(deploy.Spec.Template.Spec.Volumes, getErrorPagesVolume(basicAuthenticator.Spec.ErrorPages))
+	}
+	deploy.Spec.Template.Spec.Containers[0].VolumeMounts = append(deploy.Spec.Template.Spec.Containers[0].VolumeMounts, getPathCredentialsVolumeMounts(basicAuthenticator)...)
+	deploy.Spec.Template.Spec.Volumes = append(deploy.Spec.Template.Spec.Volumes, getPathCredentialsVolumes(basicAuthenticator)...)
+	deploy.Spec.Template.Spec.Containers[0].VolumeMounts = append(deploy.Spec.Template.Spec.Containers[0].VolumeMounts, getExtraVolumeMounts(basicAuthenticator)...)
+	deploy.Spec.Template.Spec.Volumes = append(deploy.Spec.Template.Spec.Volumes, getExtraVolumes(basicAuthenticator)...)
+	if basicAuthenticator.Spec.TLS != nil {
+		deploy.Spec.Template.Spec.Containers[0].Ports = append(deploy.Spec.Template.Spec.Containers[0].Ports, getTLSContainerPort(basicAuthenticator))
+		deploy.Spec.Template.Spec.Containers[0].VolumeMounts = append(deploy.Spec.Template.Spec.Containers[0].VolumeMounts, getTLSVolumeMount(basicAuthenticator))
+		deploy.Spec.Template.Spec.Volumes = append(deploy.Spec.Template.Spec.Volumes, getTLSVolume(basicAuthenticator))
+	}
+	if basicAuthenticator.Spec.UseConfigReloader {
+		deploy.Spec.Template.Spec.ShareProcessNamespace = pointer.Bool(true)
+		deploy.Spec.Template.Spec.Containers = append(deploy.Spec.Template.Spec.Containers, corev1.Container{
+			Name:            reloaderContainerName,
+			Image:           getReloaderContainerImage(customConfig),
+			Command:         []string{"/bin/sh", "-c", reloaderScript},
+			SecurityContext: getNginxContainerSecurityContext(customConfig),
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      configMapName,
+					MountPath: ConfigMountPath,
+					ReadOnly:  true,
+				},
+				{
+					Name:      credentialName,
+					MountPath: SecretMountDir,
+					ReadOnly:  true,
+				},
+			},
+		})
+	}
+	if basicAuthenticator.Spec.UseConfigReloader && basicAuthenticator.Spec.TLS != nil {
+		reloaderIdx := getContainerIndex(deploy.Spec.Template.Spec.Containers, reloaderContainerName)
+		deploy.Spec.Template.Spec.Containers[reloaderIdx].VolumeMounts = append(deploy.Spec.Template.Spec.Containers[reloaderIdx].VolumeMounts, getTLSVolumeMount(basicAuthenticator))
+	}
 	return deploy
 }
 
-func createNginxConfigmap(basicAuthenticator *v1alpha1.BasicAuthenticator) *corev1.ConfigMap {
+func createNginxConfigmap(basicAuthenticator *v1alpha1.BasicAuthenticator, configTemplate string, customConfig *config.CustomConfig) (*corev1.ConfigMap, error) {
 	configmapName := random_generator.GenerateRandomName(basicAuthenticator.Name, "configmap")
 	basicAuthLabels := map[string]string{
 		basicAuthenticatorNameLabel: basicAuthenticator.Name,
 	}
-	nginxConf := fillTemplate(template, SecretMountPath, basicAuthenticator)
+	proxyHeadersEnabled := isProxyHeadersEnabled(customConfig)
+	nginxConf := fillTemplate(template, getCredentialsPath(basicAuthenticator), basicAuthenticator, proxyHeadersEnabled)
+	if configTemplate != "" {
+		var err error
+		nginxConf, err = renderConfigTemplate(configTemplate, basicAuthenticator, proxyHeadersEnabled)
+		if err != nil {
+			return nil, err
+		}
+	}
 	data := map[string]string{
 		"nginx.conf": nginxConf,
 	}
+	if basicAuthenticator.Spec.Tuning != nil {
+		data[MainConfigKey] = fillMainTemplate(basicAuthenticator.Spec.Tuning)
+	}
 	configMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      configmapName,
@@ -116,17 +196,17 @@ func createNginxConfigmap(basicAuthenticator *v1alpha1.BasicAuthenticator) *core
 		},
 		Data: data,
 	}
-	return configMap
+	return configMap, nil
 }
 
-func updateHtpasswdField(secret *corev1.Secret) error {
-	username, ok := secret.Data["username"]
+func updateHtpasswdField(secret *corev1.Secret, keys credentialsSecretKeys) error {
+	username, ok := secret.Data[keys.username]
 	if !ok {
-		return defaultError.New("username not found in secret")
+		return fmt.Errorf("%s not found in secret", keys.username)
 	}
-	password, ok := secret.Data["password"]
+	password, ok := secret.Data[keys.password]
 	if !ok {
-		return defaultError.New("password not found in secret")
+		return fmt.Errorf("%s not found in secret", keys.password)
 	}
 	salt, err := random_generator.GenerateRandomString(8)
 	if err != nil {
@@ -137,15 +217,172 @@ func updateHtpasswdField(secret *corev1.Secret) error {
 		return err
 	}
 	htpasswdString := fmt.Sprintf("%s:%s", string(username), hashedPassword)
-	secret.Data["htpasswd"] = []byte(htpasswdString)
+	secret.Data[SecretHtpasswdField] = []byte(htpasswdString)
+	return nil
+}
+
+// isHtpasswdFieldCurrent reports whether the htpasswd field of the secret is the apr1 entry of its username and password.
+// updateHtpasswdField salts each hash anew, so the entry is checked with its own salt rather than compared to a new one.
+func isHtpasswdFieldCurrent(secret *corev1.Secret, keys credentialsSecretKeys) bool {
+	entry := string(secret.Data[SecretHtpasswdField])
+	username, hash, found := strings.Cut(entry, ":")
+	if !found || username != string(secret.Data[keys.username]) {
+		return false
+	}
+	hashParts := strings.Split(hash, "$")
+	if len(hashParts) != 4 || hashParts[1] != "apr1" {
+		return false
+	}
+	expected, err := htpasswd.ApacheHash(string(secret.Data[keys.password]), hashParts[2])
+	return err == nil && expected == hash
+}
+
+// updateCredentialFields sets the credential files nginx reads for the AuthType of basicAuthenticator
+func updateCredentialFields(secret *corev1.Secret, basicAuthenticator *v1alpha1.BasicAuthenticator) error {
+	keys := getCredentialsSecretKeys(basicAuthenticator)
+	if err := updateHtpasswdField(secret, keys); err != nil {
+		return err
+	}
+	if isDigestAuth(basicAuthenticator) {
+		return updateHtdigestField(secret, keys)
+	}
+	return nil
+}
+
+// isCredentialFieldsCurrent reports whether the credential files of the secret for the AuthType of basicAuthenticator are
+// those of its username and password
+func isCredentialFieldsCurrent(secret *corev1.Secret, basicAuthenticator *v1alpha1.BasicAuthenticator) bool {
+	keys := getCredentialsSecretKeys(basicAuthenticator)
+	if !isHtpasswdFieldCurrent(secret, keys) {
+		return false
+	}
+	if !isDigestAuth(basicAuthenticator) {
+		return true
+	}
+	expected := secret.DeepCopy()
+	if err := updateHtdigestField(expected, keys); err != nil {
+		return false
+	}
+	return bytes.Equal(expected.Data[SecretHtdigestField], secret.Data[SecretHtdigestField])
+}
+
+// updateHtdigestField sets the htdigest file nginx's auth_digest module reads, holding the HA1 hash of the credentials.
+// Unlike htpasswd, the hash is unsalted, so it only changes with the username or password.
+func updateHtdigestField(secret *corev1.Secret, keys credentialsSecretKeys) error {
+	username, ok := secret.Data[keys.username]
+	if !ok {
+		return fmt.Errorf("%s not found in secret", keys.username)
+	}
+	password, ok := secret.Data[keys.password]
+	if !ok {
+		return fmt.Errorf("%s not found in secret", keys.password)
+	}
+	hash := htpasswd.DigestHash(string(username), authRealm, string(password))
+	secret.Data[SecretHtdigestField] = []byte(fmt.Sprintf("%s:%s:%s", string(username), authRealm, hash))
 	return nil
 }
+
+// getCredentialItems returns the keys of the credentials secret nginx reads
+func getCredentialItems(basicAuthenticator *v1alpha1.BasicAuthenticator) []corev1.KeyToPath {
+	items := []corev1.KeyToPath{
+		{
+			Key:  getCredentialsSecretKeys(basicAuthenticator).htpasswd,
+			Path: SecretHtpasswdField,
+		},
+	}
+	if isDigestAuth(basicAuthenticator) {
+		items = append(items, corev1.KeyToPath{Key: SecretHtdigestField, Path: SecretHtdigestField})
+	}
+	return items
+}
+
+// getSidecarCredentialItems returns the keys of the credentials secret mounted into the sidecar. The whole secret is mounted
+// unless the htpasswd file is kept under another key, so the volumes of workloads injected before are left as they are.
+func getSidecarCredentialItems(basicAuthenticator *v1alpha1.BasicAuthenticator) []corev1.KeyToPath {
+	if !usesHtpasswdKey(basicAuthenticator) {
+		return nil
+	}
+	return getCredentialItems(basicAuthenticator)
+}
+
+func getCredentialsPath(basicAuthenticator *v1alpha1.BasicAuthenticator) string {
+	if isDigestAuth(basicAuthenticator) {
+		return DigestSecretMountPath
+	}
+	return SecretMountPath
+}
+
+// credentialsSecretKeys are the keys the credentials are read from in the credentials secret
+type credentialsSecretKeys struct {
+	username string
+	password string
+	htpasswd string
+}
+
+// getCredentialsSecretKeys returns the keys of the credentials secret of basicAuthenticator. Spec.CredentialsSecretKeys
+// only applies to the user provided secret, the generated secrets always use the default keys.
+func getCredentialsSecretKeys(basicAuthenticator *v1alpha1.BasicAuthenticator) credentialsSecretKeys {
+	keys := credentialsSecretKeys{username: SecretUsernameField, password: SecretPasswordField, htpasswd: SecretHtpasswdField}
+	override := basicAuthenticator.Spec.CredentialsSecretKeys
+	if basicAuthenticator.Spec.CredentialsSecretRef == "" || override == nil {
+		return keys
+	}
+	if override.Username != "" {
+		keys.username = override.Username
+	}
+	if override.Password != "" {
+		keys.password = override.Password
+	}
+	if override.Htpasswd != "" {
+		keys.htpasswd = override.Htpasswd
+	}
+	return keys
+}
+
+// usesHtpasswdKey reports whether the user provided secret names the key of a ready htpasswd file,
+// which is then used as is even if the secret has a username and password as well
+func usesHtpasswdKey(basicAuthenticator *v1alpha1.BasicAuthenticator) bool {
+	return basicAuthenticator.Spec.CredentialsSecretRef != "" && basicAuthenticator.Spec.CredentialsSecretKeys != nil &&
+		basicAuthenticator.Spec.CredentialsSecretKeys.Htpasswd != ""
+}
+
+// isHtpasswdOnlySecret reports whether the secret provides a ready htpasswd file instead of a username and password
+func isHtpasswdOnlySecret(secret *corev1.Secret, basicAuthenticator *v1alpha1.BasicAuthenticator) bool {
+	keys := getCredentialsSecretKeys(basicAuthenticator)
+	_, hasUsername := secret.Data[keys.username]
+	_, hasPassword := secret.Data[keys.password]
+	_, hasHtpasswd := secret.Data[keys.htpasswd]
+	return hasHtpasswd && (usesHtpasswdKey(basicAuthenticator) || (!hasUsername && !hasPassword))
+}
+
+// hasCredentialFields reports whether the secret has the username and password to build the htpasswd file from
+func hasCredentialFields(secret *corev1.Secret, basicAuthenticator *v1alpha1.BasicAuthenticator) bool {
+	if usesHtpasswdKey(basicAuthenticator) {
+		return false
+	}
+	keys := getCredentialsSecretKeys(basicAuthenticator)
+	_, hasUsername := secret.Data[keys.username]
+	_, hasPassword := secret.Data[keys.password]
+	return hasUsername && hasPassword
+}
+
+// getMissingCredentialsMessage describes the fields a secret which has neither of the credential formats is missing
+func getMissingCredentialsMessage(secretName string, basicAuthenticator *v1alpha1.BasicAuthenticator) string {
+	keys := getCredentialsSecretKeys(basicAuthenticator)
+	if usesHtpasswdKey(basicAuthenticator) {
+		return fmt.Sprintf("secret %s should have an %s field", secretName, keys.htpasswd)
+	}
+	return fmt.Sprintf("secret %s should have both %s and %s fields, or only an %s field", secretName, keys.username, keys.password, keys.htpasswd)
+}
+
 func createCredentials(basicAuthenticator *v1alpha1.BasicAuthenticator) (*corev1.Secret, error) {
+	policy := basicAuthenticator.Spec.CredentialPolicy
 	username, err := random_generator.GenerateRandomString(20)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to generate username")
 	}
-	password, err := random_generator.GenerateRandomString(20)
+	username = policy.UsernamePrefix + username
+	password, err := generatePassword(policy)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to generate password")
 	}
@@ -164,14 +401,62 @@ func createCredentials(basicAuthenticator *v1alpha1.BasicAuthenticator) (*corev1
 			Labels:    basicAuthLabels,
 		},
 		Data: map[string][]byte{
-			"username": []byte(username),
-			"password": []byte(password),
+			SecretUsernameField: []byte(username),
+			SecretPasswordField: []byte(password),
 		},
 	}
+	setRotationPolicyLabel(secret, basicAuthenticator)
 	return secret, nil
 }
+
+// setGeneratedAtAnnotation records when the credentials of secret were generated
+func setGeneratedAtAnnotation(secret *corev1.Secret, generatedAt time.Time) {
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[GeneratedAtAnnotation] = generatedAt.UTC().Format(time.RFC3339)
+}
+
+// getCredentialsGeneratedAt returns when the credentials of secret were generated,
+// which for secrets not generated by the operator is their creation time
+func getCredentialsGeneratedAt(secret *corev1.Secret) time.Time {
+	if generatedAt, err := time.Parse(time.RFC3339, secret.Annotations[GeneratedAtAnnotation]); err == nil {
+		return generatedAt
+	}
+	return secret.CreationTimestamp.Time
+}
+
+// setRotationPolicyLabel keeps the rotation-policy label of a generated secret in sync with Spec.RotationPolicyLabel
+func setRotationPolicyLabel(secret *corev1.Secret, basicAuthenticator *v1alpha1.BasicAuthenticator) {
+	if basicAuthenticator.Spec.RotationPolicyLabel == "" {
+		delete(secret.Labels, RotationPolicyLabel)
+		return
+	}
+	if secret.Labels == nil {
+		secret.Labels = make(map[string]string)
+	}
+	secret.Labels[RotationPolicyLabel] = basicAuthenticator.Spec.RotationPolicyLabel
+}
+func generatePassword(policy v1alpha1.CredentialPolicy) (string, error) {
+	passwordLength := policy.PasswordLength
+	if passwordLength == 0 {
+		passwordLength = defaultPasswordLength
+	}
+	return random_generator.GeneratePassword(passwordLength, policy.IncludeSymbols)
+}
+
+// regeneratePassword replaces the password of the given secret keeping its username
+func regeneratePassword(secret *corev1.Secret, basicAuthenticator *v1alpha1.BasicAuthenticator) error {
+	password, err := generatePassword(basicAuthenticator.Spec.CredentialPolicy)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate password")
+	}
+	secret.Data[SecretPasswordField] = []byte(password)
+	return nil
+}
+
 func createNginxService(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, selector *metav1.LabelSelector) *corev1.Service {
-	serviceName := fmt.Sprintf("%s-svc", basicAuthenticator.Name)
+	serviceName := getNginxServiceName(basicAuthenticator)
 	serviceType := getServiceType(basicAuthenticator.Spec.ServiceType)
 	targetPort := intstr.IntOrString{Type: intstr.Int, IntVal: int32(basicAuthenticator.Spec.AuthenticatorPort)}
 	basicAuthLabel := map[string]string{
@@ -195,103 +480,1394 @@ func createNginxService(ctx context.Context, basicAuthenticator *v1alpha1.BasicA
 			},
 		},
 	}
+	if basicAuthenticator.Spec.TLS != nil {
+		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+			Port:       httpsServicePort,
+			TargetPort: intstr.FromInt(basicAuthenticator.Spec.TLS.Port),
+			Name:       "https",
+		})
+	}
 	return &svc
 }
-func injector(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, configMapName string, credentialName string, customConfig *config.CustomConfig, k8Client client.Client) ([]*appsv1.Deployment, error) {
-	nginxImageAddress := getNginxContainerImage(customConfig)
-	nginxContainerName := getNginxContainerName(customConfig)
 
-	authenticatorPort := int32(basicAuthenticator.Spec.AuthenticatorPort)
-	var deploymentList appsv1.DeploymentList
-	if err := k8Client.List(
-		ctx,
-		&deploymentList,
-		client.MatchingLabelsSelector{Selector: labels.SelectorFromSet(basicAuthenticator.Spec.Selector.MatchLabels)},
-		client.InNamespace(basicAuthenticator.Namespace)); err != nil {
-		return nil, err
+// createNginxIngress returns the Ingress routing Spec.Ingress.Host to the nginx service.
+// The Ingress is named after the basicAuthenticator even if Spec.Ingress is unset, so a previously created one can be found.
+func createNginxIngress(basicAuthenticator *v1alpha1.BasicAuthenticator) *networkingv1.Ingress {
+	basicAuthLabels := map[string]string{
+		basicAuthenticatorNameLabel: basicAuthenticator.Name,
+	}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-ingress", basicAuthenticator.Name),
+			Namespace: basicAuthenticator.Namespace,
+			Labels:    basicAuthLabels,
+		},
+	}
+	if basicAuthenticator.Spec.Ingress == nil {
+		return ingress
+	}
+	pathType := networkingv1.PathTypePrefix
+	ingress.Spec = networkingv1.IngressSpec{
+		IngressClassName: basicAuthenticator.Spec.Ingress.IngressClassName,
+		Rules: []networkingv1.IngressRule{
+			{
+				Host: basicAuthenticator.Spec.Ingress.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{
+							{
+								Path:     "/",
+								PathType: &pathType,
+								Backend: networkingv1.IngressBackend{
+									Service: &networkingv1.IngressServiceBackend{
+										Name: getNginxServiceName(basicAuthenticator),
+										Port: networkingv1.ServiceBackendPort{
+											Number: int32(basicAuthenticator.Spec.AuthenticatorPort),
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
-	resultDeployments := make([]*appsv1.Deployment, 0)
+	return ingress
+}
 
-	for _, deployment := range deploymentList.Items {
-		if deployment.Labels == nil {
-			deployment.Labels = make(map[string]string)
+// applyNginxRouteSpec sets the fields of the Route's spec managed by the controller, keeping the ones defaulted by OpenShift
+func applyNginxRouteSpec(route *unstructured.Unstructured, basicAuthenticator *v1alpha1.BasicAuthenticator) error {
+	route.SetName(getNginxRouteName(basicAuthenticator))
+	route.SetNamespace(basicAuthenticator.Namespace)
+	route.SetLabels(map[string]string{
+		basicAuthenticatorNameLabel: basicAuthenticator.Name,
+	})
+	if err := unstructured.SetNestedMap(route.Object, map[string]interface{}{
+		"kind": "Service",
+		"name": getNginxServiceName(basicAuthenticator),
+	}, "spec", "to"); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(route.Object, "authenticator", "spec", "port", "targetPort"); err != nil {
+		return err
+	}
+	if basicAuthenticator.Spec.Route.Host != "" {
+		if err := unstructured.SetNestedField(route.Object, basicAuthenticator.Spec.Route.Host, "spec", "host"); err != nil {
+			return err
 		}
-		deployment.Labels[basicAuthenticatorNameLabel] = basicAuthenticator.Name
-		idx := getContainerIndex(deployment.Spec.Template.Spec.Containers, nginxContainerName)
-		if idx == -1 { // meaning its the first time creating container
-			deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers, corev1.Container{
-				Name:  nginxContainerName,
-				Image: nginxImageAddress,
-				Ports: []corev1.ContainerPort{
-					{
-						ContainerPort: authenticatorPort,
+	}
+	if !basicAuthenticator.Spec.Route.EdgeTLS {
+		unstructured.RemoveNestedField(route.Object, "spec", "tls")
+		return nil
+	}
+	return unstructured.SetNestedMap(route.Object, map[string]interface{}{
+		"termination":                   "edge",
+		"insecureEdgeTerminationPolicy": "Redirect",
+	}, "spec", "tls")
+}
+
+// createZeroTrustNetworkPolicies returns a default-deny policy for the nginx pods and a policy allowing the traffic nginx needs:
+// ingress on the authenticator and TLS ports (which also keeps the kubelet probes working), egress to the upstream and DNS.
+// When the upstream is a service in the same namespace, egress is limited to its pods, otherwise only the port is restricted.
+// Ingress is only limited to ingressPeers if given, as policies are additive and would otherwise reopen what NetworkPolicy restricts.
+func createZeroTrustNetworkPolicies(basicAuthenticator *v1alpha1.BasicAuthenticator, upstreamService *corev1.Service, ingressPeers []networkingv1.NetworkPolicyPeer) []*networkingv1.NetworkPolicy {
+	basicAuthLabels := map[string]string{
+		basicAuthenticatorNameLabel: basicAuthenticator.Name,
+	}
+	podSelector := metav1.LabelSelector{MatchLabels: basicAuthLabels}
+	tcp := corev1.ProtocolTCP
+	udp := corev1.ProtocolUDP
+	dnsPort := intstr.FromInt(53)
+	authenticatorPort := intstr.FromInt(basicAuthenticator.Spec.AuthenticatorPort)
+
+	upstreamEgress := networkingv1.NetworkPolicyEgressRule{
+		Ports: []networkingv1.NetworkPolicyPort{
+			{Protocol: &tcp, Port: getUpstreamTargetPort(basicAuthenticator, upstreamService)},
+		},
+	}
+	if upstreamService != nil && len(upstreamService.Spec.Selector) != 0 {
+		upstreamEgress.To = []networkingv1.NetworkPolicyPeer{
+			{PodSelector: &metav1.LabelSelector{MatchLabels: upstreamService.Spec.Selector}},
+		}
+	}
+
+	denyAll := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-deny-all", basicAuthenticator.Name),
+			Namespace: basicAuthenticator.Namespace,
+			Labels:    basicAuthLabels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: podSelector,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		},
+	}
+	allow := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-allow", basicAuthenticator.Name),
+			Namespace: basicAuthenticator.Namespace,
+			Labels:    basicAuthLabels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: podSelector,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: []networkingv1.NetworkPolicyPort{
+						{Protocol: &tcp, Port: &authenticatorPort},
 					},
+					From: ingressPeers,
 				},
-				VolumeMounts: []corev1.VolumeMount{
-					{
-						Name:      configMapName,
-						MountPath: ConfigMountPath,
-					},
-					{
-						Name:      credentialName,
-						MountPath: SecretMountDir,
+			},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				upstreamEgress,
+				{
+					Ports: []networkingv1.NetworkPolicyPort{
+						{Protocol: &udp, Port: &dnsPort},
+						{Protocol: &tcp, Port: &dnsPort},
 					},
 				},
-			})
-			deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
-				Name: configMapName,
-				VolumeSource: corev1.VolumeSource{
-					ConfigMap: &corev1.ConfigMapVolumeSource{
-						LocalObjectReference: corev1.LocalObjectReference{
-							Name: configMapName,
-						},
+			},
+		},
+	}
+	if basicAuthenticator.Spec.TLS != nil {
+		tlsPort := intstr.FromInt(basicAuthenticator.Spec.TLS.Port)
+		allow.Spec.Ingress[0].Ports = append(allow.Spec.Ingress[0].Ports, networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &tlsPort})
+	}
+	return []*networkingv1.NetworkPolicy{denyAll, allow}
+}
+
+// createIngressNetworkPolicy returns a policy allowing ingress to the authenticator and TLS ports of the nginx pods
+// only from ingressPeers. Unlike the zero trust policies, egress is left alone.
+func createIngressNetworkPolicy(basicAuthenticator *v1alpha1.BasicAuthenticator, ingressPeers []networkingv1.NetworkPolicyPeer) *networkingv1.NetworkPolicy {
+	basicAuthLabels := map[string]string{
+		basicAuthenticatorNameLabel: basicAuthenticator.Name,
+	}
+	tcp := corev1.ProtocolTCP
+	authenticatorPort := intstr.FromInt(basicAuthenticator.Spec.AuthenticatorPort)
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-ingress", basicAuthenticator.Name),
+			Namespace: basicAuthenticator.Namespace,
+			Labels:    basicAuthLabels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: basicAuthLabels},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: []networkingv1.NetworkPolicyPort{
+						{Protocol: &tcp, Port: &authenticatorPort},
 					},
+					From: ingressPeers,
 				},
-			})
-			deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
-				Name: credentialName,
-				VolumeSource: corev1.VolumeSource{
-					Secret: &corev1.SecretVolumeSource{
-						SecretName: credentialName,
+			},
+		},
+	}
+	if basicAuthenticator.Spec.TLS != nil {
+		tlsPort := intstr.FromInt(basicAuthenticator.Spec.TLS.Port)
+		policy.Spec.Ingress[0].Ports = append(policy.Spec.Ingress[0].Ports, networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &tlsPort})
+	}
+	return policy
+}
+
+// createPodDisruptionBudget returns a PodDisruptionBudget keeping MinAvailable of the nginx pods, defaulting to 1
+func createPodDisruptionBudget(basicAuthenticator *v1alpha1.BasicAuthenticator) *policyv1.PodDisruptionBudget {
+	basicAuthLabels := map[string]string{
+		basicAuthenticatorNameLabel: basicAuthenticator.Name,
+	}
+	minAvailable := intstr.FromInt(1)
+	if basicAuthenticator.Spec.PodDisruptionBudget != nil && basicAuthenticator.Spec.PodDisruptionBudget.MinAvailable != nil {
+		minAvailable = *basicAuthenticator.Spec.PodDisruptionBudget.MinAvailable
+	}
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      random_generator.GenerateRandomName(basicAuthenticator.Name, "pdb"),
+			Namespace: basicAuthenticator.Namespace,
+			Labels:    basicAuthLabels,
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector:     &metav1.LabelSelector{MatchLabels: basicAuthLabels},
+		},
+	}
+}
+
+// isPodDisruptionBudgetNeeded reports whether a PodDisruptionBudget is enabled and there is more than one nginx pod to keep
+func isPodDisruptionBudgetNeeded(basicAuthenticator *v1alpha1.BasicAuthenticator) bool {
+	return basicAuthenticator.Spec.PodDisruptionBudget != nil && basicAuthenticator.Spec.PodDisruptionBudget.Enabled &&
+		getMinReplicas(basicAuthenticator) > 1
+}
+
+// createHorizontalPodAutoscaler returns a HorizontalPodAutoscaler scaling the nginx deployment on its CPU utilization
+func createHorizontalPodAutoscaler(basicAuthenticator *v1alpha1.BasicAuthenticator) *autoscalingv2.HorizontalPodAutoscaler {
+	basicAuthLabels := map[string]string{
+		basicAuthenticatorNameLabel: basicAuthenticator.Name,
+	}
+	autoscaling := basicAuthenticator.Spec.Autoscaling
+	if autoscaling == nil {
+		autoscaling = &v1alpha1.AutoscalingSpec{}
+	}
+	minReplicas := int32(getMinReplicas(basicAuthenticator))
+	targetUtilization := int32(defaultTargetCPUUtilization)
+	if autoscaling.TargetCPUUtilizationPercentage > 0 {
+		targetUtilization = int32(autoscaling.TargetCPUUtilizationPercentage)
+	}
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      random_generator.GenerateRandomName(basicAuthenticator.Name, "hpa"),
+			Namespace: basicAuthenticator.Namespace,
+			Labels:    basicAuthLabels,
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: appsv1.SchemeGroupVersion.String(),
+				Kind:       "Deployment",
+				Name:       random_generator.GenerateRandomName(basicAuthenticator.Name, "deployment"),
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: int32(autoscaling.MaxReplicas),
+			Metrics: []autoscalingv2.MetricSpec{
+				{
+					Type: autoscalingv2.ResourceMetricSourceType,
+					Resource: &autoscalingv2.ResourceMetricSource{
+						Name: corev1.ResourceCPU,
+						Target: autoscalingv2.MetricTarget{
+							Type:               autoscalingv2.UtilizationMetricType,
+							AverageUtilization: &targetUtilization,
+						},
 					},
 				},
-			})
-		} //TODO: handling config change later (idx >=0)
+			},
+		},
+	}
+}
 
-		resultDeployments = append(resultDeployments, &deployment)
+// getMinReplicas returns the replicas the nginx deployment is created with, which is the lower bound of the autoscaler if set
+func getMinReplicas(basicAuthenticator *v1alpha1.BasicAuthenticator) int {
+	if basicAuthenticator.Spec.Autoscaling == nil {
+		return basicAuthenticator.Spec.Replicas
+	}
+	if basicAuthenticator.Spec.Autoscaling.MinReplicas > 0 {
+		return basicAuthenticator.Spec.Autoscaling.MinReplicas
 	}
-	return resultDeployments, nil
+	return 1
 }
 
-func fillTemplate(template string, secretPath string, authenticator *v1alpha1.BasicAuthenticator) string {
-	var result string
-	var appservice string
-	if authenticator.Spec.Type == "sidecar" {
-		appservice = "localhost"
-	} else {
-		appservice = authenticator.Spec.AppService
+// getIngressPeers returns the peers allowed to reach nginx when Spec.NetworkPolicy is enabled, falling back to the
+// ingress controller namespace. It returns nil when the network policy is disabled, meaning any peer is allowed.
+func getIngressPeers(basicAuthenticator *v1alpha1.BasicAuthenticator, customConfig *config.CustomConfig) []networkingv1.NetworkPolicyPeer {
+	if !isNetworkPolicyEnabled(basicAuthenticator) {
+		return nil
+	}
+	if len(basicAuthenticator.Spec.NetworkPolicy.From) != 0 {
+		return basicAuthenticator.Spec.NetworkPolicy.From
+	}
+	return []networkingv1.NetworkPolicyPeer{
+		{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{corev1.LabelMetadataName: getIngressControllerNamespace(customConfig)},
+			},
+		},
 	}
-	result = strings.Replace(template, "AUTHENTICATOR_PORT", fmt.Sprintf("%d", authenticator.Spec.AuthenticatorPort), 1)
-	result = strings.Replace(result, "FILE_PATH", secretPath, 1)
-	result = strings.Replace(result, "APP_SERVICE", appservice, 1)
-	result = strings.Replace(result, "APP_PORT", fmt.Sprintf("%d", authenticator.Spec.AppPort), 1)
-	return result
 }
 
-func getServiceType(serviceType string) corev1.ServiceType {
-	switch serviceType {
-	case "NodePort":
-		return corev1.ServiceTypeNodePort
-	case "LoadBalancer":
-		return corev1.ServiceTypeLoadBalancer
-	default:
-		return corev1.ServiceTypeClusterIP
+func isNetworkPolicyEnabled(basicAuthenticator *v1alpha1.BasicAuthenticator) bool {
+	return basicAuthenticator.Spec.NetworkPolicy != nil && basicAuthenticator.Spec.NetworkPolicy.Enabled
+}
+
+// getUpstreamTargetPort resolves AppPort to the port of the upstream pods, as network policies apply after service translation
+func getUpstreamTargetPort(basicAuthenticator *v1alpha1.BasicAuthenticator, upstreamService *corev1.Service) *intstr.IntOrString {
+	appPort := intstr.FromInt(basicAuthenticator.Spec.AppPort)
+	if upstreamService == nil {
+		return &appPort
+	}
+	for _, port := range upstreamService.Spec.Ports {
+		if int(port.Port) == basicAuthenticator.Spec.AppPort && port.TargetPort.String() != "0" {
+			targetPort := port.TargetPort
+			return &targetPort
+		}
 	}
+	return &appPort
 }
 
-func getContainerIndex(containers []corev1.Container, name string) int {
-	for idx, container := range containers {
-		if container.Name == name {
+// mergeDeploymentSpec applies the desired spec to the found deployment while keeping the pod template fields
+// set by others, like annotations added by `kubectl rollout restart` or scheduling constraints added by admission controllers.
+func mergeDeploymentSpec(found *appsv1.Deployment, desired *appsv1.Deployment) {
+	spec := desired.Spec.DeepCopy()
+	template := &spec.Template
+	foundTemplate := found.Spec.Template
+	template.Annotations = mergeStringMaps(foundTemplate.Annotations, template.Annotations)
+	template.Labels = mergeStringMaps(foundTemplate.Labels, template.Labels)
+	if template.Spec.NodeName == "" {
+		template.Spec.NodeName = foundTemplate.Spec.NodeName
+	}
+	if template.Spec.NodeSelector == nil {
+		template.Spec.NodeSelector = foundTemplate.Spec.NodeSelector
+	}
+	if template.Spec.Affinity == nil {
+		template.Spec.Affinity = foundTemplate.Spec.Affinity
+	}
+	if template.Spec.Tolerations == nil {
+		template.Spec.Tolerations = foundTemplate.Spec.Tolerations
+	}
+	if template.Spec.TopologySpreadConstraints == nil {
+		template.Spec.TopologySpreadConstraints = foundTemplate.Spec.TopologySpreadConstraints
+	}
+	if template.Spec.PriorityClassName == "" {
+		template.Spec.PriorityClassName = foundTemplate.Spec.PriorityClassName
+	}
+	if template.Spec.SchedulerName == "" {
+		template.Spec.SchedulerName = foundTemplate.Spec.SchedulerName
+	}
+	found.Spec = *spec
+}
+
+// mergeStringMaps returns the union of both maps, the values of override win
+func mergeStringMaps(base map[string]string, override map[string]string) map[string]string {
+	if base == nil && override == nil {
+		return nil
+	}
+	result := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		result[key] = value
+	}
+	for key, value := range override {
+		result[key] = value
+	}
+	return result
+}
+
+// injectionResult groups the deployments selected by a sidecar mode basicAuthenticator
+type injectionResult struct {
+	// all holds the deployments with the nginx sidecar injected
+	all []*appsv1.Deployment
+	// updated is the subset of all that changed and has to be written back
+	updated []*appsv1.Deployment
+	// injected is the subset of all that did not have the sidecar before
+	injected []*appsv1.Deployment
+	// optedOut holds the deployments opted out by InjectAnnotation which still have the sidecar
+	optedOut []*appsv1.Deployment
+	// conflicting holds the deployments already injected by another basicAuthenticator, only filled when injection is exclusive
+	conflicting []*appsv1.Deployment
+	// drifted holds the deployments injected before whose sidecar was removed or altered since, and is repaired by injecting it again
+	drifted []injectionDrift
+	// collisions describes the workloads which were not injected as one of their own containers has the sidecar's name
+	collisions []string
+	// cronJobs holds the cronJobs whose job template changed by injecting the nginx sidecar, only filled when InjectCronJobs is set
+	cronJobs []*batchv1.CronJob
+	// injectedCronJobs is the subset of cronJobs that did not have the sidecar before
+	injectedCronJobs []*batchv1.CronJob
+	// staleCronJobs holds the cronJobs injected by this basicAuthenticator which are no longer selected or opted out
+	staleCronJobs []*batchv1.CronJob
+}
+
+// injectionDrift describes what was found changed in the sidecar of an injected deployment
+type injectionDrift struct {
+	deployment  *appsv1.Deployment
+	description string
+}
+
+func injector(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, configMapName string, configChecksum string, credentialName string, customConfig *config.CustomConfig, k8Client client.Client) (*injectionResult, error) {
+	if !isNamespaceAllowed(customConfig, basicAuthenticator.Namespace) {
+		return nil, fmt.Errorf("namespace %s is not allowed", basicAuthenticator.Namespace)
+	}
+	nginxContainerName := getNginxContainerName(customConfig)
+
+	var deploymentList appsv1.DeploymentList
+	if err := k8Client.List(
+		ctx,
+		&deploymentList,
+		client.MatchingLabelsSelector{Selector: labels.SelectorFromSet(basicAuthenticator.Spec.Selector.MatchLabels)},
+		client.InNamespace(basicAuthenticator.Namespace)); err != nil {
+		return nil, err
+	}
+	result := &injectionResult{
+		all:              make([]*appsv1.Deployment, 0),
+		updated:          make([]*appsv1.Deployment, 0),
+		injected:         make([]*appsv1.Deployment, 0),
+		optedOut:         make([]*appsv1.Deployment, 0),
+		conflicting:      make([]*appsv1.Deployment, 0),
+		collisions:       make([]string, 0),
+		cronJobs:         make([]*batchv1.CronJob, 0),
+		injectedCronJobs: make([]*batchv1.CronJob, 0),
+		staleCronJobs:    make([]*batchv1.CronJob, 0),
+	}
+
+	for i := range deploymentList.Items {
+		deployment := &deploymentList.Items[i]
+		idx := getContainerIndex(deployment.Spec.Template.Spec.Containers, nginxContainerName)
+		injectedBy, isInjected := getInjectedBy(deployment.ObjectMeta, idx != -1, basicAuthenticator)
+		if deployment.Annotations[InjectAnnotation] == "false" {
+			if idx != -1 && injectedBy == basicAuthenticator.Name {
+				result.optedOut = append(result.optedOut, deployment)
+			}
+			continue
+		}
+		if isInjected && injectedBy != basicAuthenticator.Name && isExclusiveInjection(customConfig) {
+			result.conflicting = append(result.conflicting, deployment)
+			continue
+		}
+		if idx != -1 && !isInjected {
+			result.collisions = append(result.collisions, fmt.Sprintf("deployment %s", deployment.Name))
+			continue
+		}
+		if isInjected && injectedBy == basicAuthenticator.Name {
+			if description := getSidecarDrift(&deployment.Spec.Template.Spec, nginxContainerName, configMapName); description != "" {
+				result.drifted = append(result.drifted, injectionDrift{deployment: deployment, description: description})
+			}
+		}
+		original := deployment.DeepCopy()
+		if deployment.Labels == nil {
+			deployment.Labels = make(map[string]string)
+		}
+		deployment.Labels[basicAuthenticatorNameLabel] = basicAuthenticator.Name
+		for key, value := range getPodTemplateAnnotations(basicAuthenticator, configChecksum) {
+			if deployment.Spec.Template.Annotations == nil {
+				deployment.Spec.Template.Annotations = make(map[string]string)
+			}
+			deployment.Spec.Template.Annotations[key] = value
+		}
+		switch {
+		case idx == -1: // meaning its the first time creating container
+			if deployment.Annotations == nil {
+				deployment.Annotations = make(map[string]string)
+			}
+			deployment.Annotations[InjectedByAnnotation] = basicAuthenticator.Name
+			injectPodTemplate(&deployment.Spec.Template, basicAuthenticator, configMapName, credentialName, customConfig, false)
+			if injectedBy != basicAuthenticator.Name {
+				// a sidecar removed by someone else is reported as drift rather than as a new injection
+				result.injected = append(result.injected, deployment)
+			}
+		case injectedBy == basicAuthenticator.Name:
+			// backfilled for the deployments injected before the annotation was set
+			if deployment.Annotations == nil {
+				deployment.Annotations = make(map[string]string)
+			}
+			deployment.Annotations[InjectedByAnnotation] = basicAuthenticator.Name
+			// the sidecar is updated in place, so config changes are picked up
+			injectPodTemplate(&deployment.Spec.Template, basicAuthenticator, configMapName, credentialName, customConfig, false)
+		}
+
+		result.all = append(result.all, deployment)
+		if !reflect.DeepEqual(original, deployment) {
+			result.updated = append(result.updated, deployment)
+		}
+	}
+	if err := injectCronJobs(ctx, basicAuthenticator, configMapName, configChecksum, credentialName, customConfig, k8Client, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// getInjectedBy returns the BasicAuthenticator which injected the sidecar into a workload, and whether one did. Workloads
+// injected before InjectedByAnnotation was introduced only carry basicAuthenticatorNameLabel, so a sidecar found next
+// to the label of basicAuthenticator is taken as its own.
+func getInjectedBy(objectMeta metav1.ObjectMeta, hasSidecar bool, basicAuthenticator *v1alpha1.BasicAuthenticator) (string, bool) {
+	if injectedBy, isInjected := objectMeta.Annotations[InjectedByAnnotation]; isInjected {
+		return injectedBy, true
+	}
+	if hasSidecar && objectMeta.Labels[basicAuthenticatorNameLabel] == basicAuthenticator.Name {
+		return basicAuthenticator.Name, true
+	}
+	return "", false
+}
+
+// getSidecarDrift describes how the sidecar of a pod injected before no longer protects it, or returns an empty string if
+// it still does. Only what every BasicAuthenticator injects is checked, so a change of the spec is never taken for drift:
+// the sidecar itself, the nginx config it runs and the credentials it reads.
+func getSidecarDrift(podSpec *corev1.PodSpec, containerName string, configMapName string) string {
+	idx := getContainerIndex(podSpec.Containers, containerName)
+	if idx == -1 {
+		return fmt.Sprintf("container %s was removed", containerName)
+	}
+	sidecar := podSpec.Containers[idx]
+	configIdx := getVolumeMountIndex(sidecar.VolumeMounts, configMapName)
+	if configIdx == -1 || sidecar.VolumeMounts[configIdx].MountPath != ConfigMountPath {
+		return fmt.Sprintf("container %s no longer mounts the nginx config at %s", containerName, ConfigMountPath)
+	}
+	volumeIdx := getVolumeIndex(podSpec.Volumes, configMapName)
+	if volumeIdx == -1 || podSpec.Volumes[volumeIdx].ConfigMap == nil || podSpec.Volumes[volumeIdx].ConfigMap.Name != configMapName {
+		return fmt.Sprintf("volume %s no longer holds the nginx config", configMapName)
+	}
+	for _, volumeMount := range sidecar.VolumeMounts {
+		if volumeMount.MountPath != SecretMountDir {
+			continue
+		}
+		if volumeIdx := getVolumeIndex(podSpec.Volumes, volumeMount.Name); volumeIdx == -1 || podSpec.Volumes[volumeIdx].Secret == nil {
+			return fmt.Sprintf("volume %s no longer holds the credentials", volumeMount.Name)
+		}
+		return ""
+	}
+	return fmt.Sprintf("container %s no longer mounts the credentials at %s", containerName, SecretMountDir)
+}
+
+// injectCronJobs injects the sidecar into the job template of the selected cronJobs. The cronJobs injected before
+// which are no longer selected are collected as stale, including all of them once InjectCronJobs is turned off.
+func injectCronJobs(ctx context.Context, basicAuthenticator *v1alpha1.BasicAuthenticator, configMapName string, configChecksum string, credentialName string, customConfig *config.CustomConfig, k8Client client.Client, result *injectionResult) error {
+	nginxContainerName := getNginxContainerName(customConfig)
+	var injectedList batchv1.CronJobList
+	if err := k8Client.List(
+		ctx,
+		&injectedList,
+		client.MatchingLabels{basicAuthenticatorNameLabel: basicAuthenticator.Name},
+		client.InNamespace(basicAuthenticator.Namespace)); err != nil {
+		return err
+	}
+	var selectedList batchv1.CronJobList
+	if basicAuthenticator.Spec.InjectCronJobs {
+		if err := k8Client.List(
+			ctx,
+			&selectedList,
+			client.MatchingLabelsSelector{Selector: labels.SelectorFromSet(basicAuthenticator.Spec.Selector.MatchLabels)},
+			client.InNamespace(basicAuthenticator.Namespace)); err != nil {
+			return err
+		}
+	}
+
+	selected := make([]string, 0)
+	for i := range selectedList.Items {
+		cronJob := &selectedList.Items[i]
+		if cronJob.Annotations[InjectAnnotation] == "false" {
+			continue
+		}
+		podTemplate := &cronJob.Spec.JobTemplate.Spec.Template
+		idx := getContainerIndex(podTemplate.Spec.Containers, nginxContainerName)
+		injectedBy, isInjected := getInjectedBy(cronJob.ObjectMeta, idx != -1, basicAuthenticator)
+		if isInjected && injectedBy != basicAuthenticator.Name {
+			// a job template can only run one authenticator sidecar, as they share the container name and the lifecycle volume
+			continue
+		}
+		if idx != -1 && !isInjected {
+			result.collisions = append(result.collisions, fmt.Sprintf("cronjob %s", cronJob.Name))
+			continue
+		}
+		selected = append(selected, cronJob.Name)
+		original := cronJob.DeepCopy()
+		if cronJob.Labels == nil {
+			cronJob.Labels = make(map[string]string)
+		}
+		cronJob.Labels[basicAuthenticatorNameLabel] = basicAuthenticator.Name
+		for key, value := range getPodTemplateAnnotations(basicAuthenticator, configChecksum) {
+			if podTemplate.Annotations == nil {
+				podTemplate.Annotations = make(map[string]string)
+			}
+			podTemplate.Annotations[key] = value
+		}
+		if cronJob.Annotations == nil {
+			cronJob.Annotations = make(map[string]string)
+		}
+		cronJob.Annotations[InjectedByAnnotation] = basicAuthenticator.Name
+		if idx == -1 {
+			result.injectedCronJobs = append(result.injectedCronJobs, cronJob)
+		}
+		injectPodTemplate(podTemplate, basicAuthenticator, configMapName, credentialName, customConfig, true)
+		if !reflect.DeepEqual(original, cronJob) {
+			result.cronJobs = append(result.cronJobs, cronJob)
+		}
+	}
+	for i := range injectedList.Items {
+		if !existsInList(selected, injectedList.Items[i].Name) {
+			result.staleCronJobs = append(result.staleCronJobs, &injectedList.Items[i])
+		}
+	}
+	return nil
+}
+
+// injectPodTemplate adds the nginx sidecar and its volumes to podTemplate, or updates them in place if they exist, so
+// injecting twice never results in duplicate containers. Pods of batch workloads also get the lifecycle volume in all
+// of their containers, so the sidecar can be told to stop once the job is done.
+func injectPodTemplate(podTemplate *corev1.PodTemplateSpec, basicAuthenticator *v1alpha1.BasicAuthenticator, configMapName string, credentialName string, customConfig *config.CustomConfig, batch bool) {
+	authenticatorPort := int32(basicAuthenticator.Spec.AuthenticatorPort)
+	sidecar := corev1.Container{
+		Name:            getNginxContainerName(customConfig),
+		Image:           getNginxContainerImage(customConfig),
+		ImagePullPolicy: getImagePullPolicy(basicAuthenticator),
+		Args:            getNginxArgs(basicAuthenticator),
+		Resources:       getSidecarContainerResources(customConfig, basicAuthenticator),
+		SecurityContext: getNginxContainerSecurityContext(customConfig),
+		Ports: []corev1.ContainerPort{
+			{
+				ContainerPort: authenticatorPort,
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      configMapName,
+				MountPath: ConfigMountPath,
+			},
+			{
+				Name:      credentialName,
+				MountPath: SecretMountDir,
+			},
+		},
+	}
+	volumes := []corev1.Volume{
+		{
+			Name: configMapName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: configMapName,
+					},
+				},
+			},
+		},
+		{
+			Name: credentialName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: credentialName,
+					Items:      getSidecarCredentialItems(basicAuthenticator),
+				},
+			},
+		},
+	}
+	if basicAuthenticator.Spec.InMemoryTmp {
+		sidecar.VolumeMounts = append(sidecar.VolumeMounts, getTmpVolumeMount())
+		volumes = append(volumes, getTmpVolume())
+	}
+	if basicAuthenticator.Spec.ErrorPages != nil {
+		sidecar.VolumeMounts = append(sidecar.VolumeMounts, getErrorPagesVolumeMount())
+		volumes = append(volumes, getErrorPagesVolume(basicAuthenticator.Spec.ErrorPages))
+	}
+	sidecar.VolumeMounts = append(sidecar.VolumeMounts, getPathCredentialsVolumeMounts(basicAuthenticator)...)
+	volumes = append(volumes, getPathCredentialsVolumes(basicAuthenticator)...)
+	sidecar.VolumeMounts = append(sidecar.VolumeMounts, getExtraVolumeMounts(basicAuthenticator)...)
+	volumes = append(volumes, getExtraVolumes(basicAuthenticator)...)
+	if basicAuthenticator.Spec.TLS != nil {
+		sidecar.Ports = append(sidecar.Ports, getTLSContainerPort(basicAuthenticator))
+		sidecar.VolumeMounts = append(sidecar.VolumeMounts, getTLSVolumeMount(basicAuthenticator))
+		volumes = append(volumes, getTLSVolume(basicAuthenticator))
+	}
+	if batch {
+		for i := range podTemplate.Spec.Containers {
+			container := &podTemplate.Spec.Containers[i]
+			if container.Name != sidecar.Name && getVolumeMountIndex(container.VolumeMounts, lifecycleVolumeName) == -1 {
+				container.VolumeMounts = append(container.VolumeMounts, getLifecycleVolumeMount())
+			}
+		}
+		sidecar.Command = []string{"/bin/sh", "-c", batchSidecarScript, "sh"}
+		sidecar.Args = getNginxBatchArgs(basicAuthenticator)
+		sidecar.VolumeMounts = append(sidecar.VolumeMounts, getLifecycleVolumeMount())
+		volumes = append(volumes, getLifecycleVolume())
+	} else {
+		// batch sidecars stop along with the job, so only long running workloads drain nginx together with the app
+		sidecar.Lifecycle = getNginxLifecycle(basicAuthenticator)
+	}
+	for _, volume := range volumes {
+		setVolume(&podTemplate.Spec, volume)
+	}
+	for _, pullSecret := range getImagePullSecrets(basicAuthenticator) {
+		addImagePullSecret(&podTemplate.Spec, pullSecret)
+	}
+	if idx := getContainerIndex(podTemplate.Spec.Containers, sidecar.Name); idx != -1 {
+		mergeSidecarContainer(&podTemplate.Spec.Containers[idx], sidecar)
+	} else {
+		podTemplate.Spec.Containers = append(podTemplate.Spec.Containers, sidecar)
+	}
+}
+
+// mergeSidecarContainer sets the fields of the injected sidecar managed by the operator on found.
+// The fields defaulted by the API server are kept, so an unchanged sidecar leaves the pod template as is.
+func mergeSidecarContainer(found *corev1.Container, desired corev1.Container) {
+	for i := range desired.Ports {
+		for _, port := range found.Ports {
+			if desired.Ports[i].Protocol == "" && port.ContainerPort == desired.Ports[i].ContainerPort {
+				desired.Ports[i].Protocol = port.Protocol
+			}
+		}
+	}
+	found.Image = desired.Image
+	found.ImagePullPolicy = desired.ImagePullPolicy
+	found.Command = desired.Command
+	found.Args = desired.Args
+	found.Resources = desired.Resources
+	found.SecurityContext = desired.SecurityContext
+	found.Lifecycle = desired.Lifecycle
+	found.Ports = desired.Ports
+	found.VolumeMounts = desired.VolumeMounts
+}
+
+// addImagePullSecret adds pullSecret to the pod unless it is already used. The pull secrets are left in place once the
+// sidecar is removed, as the workload may have used them before it was injected.
+func addImagePullSecret(podSpec *corev1.PodSpec, pullSecret corev1.LocalObjectReference) {
+	for _, found := range podSpec.ImagePullSecrets {
+		if found.Name == pullSecret.Name {
+			return
+		}
+	}
+	podSpec.ImagePullSecrets = append(podSpec.ImagePullSecrets, pullSecret)
+}
+
+// getImagePullPolicy returns the pull policy of the nginx container, IfNotPresent unless configured
+func getImagePullPolicy(basicAuthenticator *v1alpha1.BasicAuthenticator) corev1.PullPolicy {
+	if basicAuthenticator.Spec.ImagePullPolicy == "" {
+		return corev1.PullIfNotPresent
+	}
+	return basicAuthenticator.Spec.ImagePullPolicy
+}
+
+func getImagePullSecrets(basicAuthenticator *v1alpha1.BasicAuthenticator) []corev1.LocalObjectReference {
+	if len(basicAuthenticator.Spec.ImagePullSecrets) == 0 {
+		return nil
+	}
+	return append([]corev1.LocalObjectReference{}, basicAuthenticator.Spec.ImagePullSecrets...)
+}
+
+// setVolume replaces the volume of podSpec with the same name, or adds it if there is none.
+// The default mode set by the API server is kept, so an unchanged volume leaves the pod template as is.
+func setVolume(podSpec *corev1.PodSpec, volume corev1.Volume) {
+	for i := range podSpec.Volumes {
+		found := podSpec.Volumes[i]
+		if found.Name != volume.Name {
+			continue
+		}
+		if volume.Secret != nil && found.Secret != nil && volume.Secret.DefaultMode == nil {
+			volume.Secret.DefaultMode = found.Secret.DefaultMode
+		}
+		if volume.ConfigMap != nil && found.ConfigMap != nil && volume.ConfigMap.DefaultMode == nil {
+			volume.ConfigMap.DefaultMode = found.ConfigMap.DefaultMode
+		}
+		podSpec.Volumes[i] = volume
+		return
+	}
+	podSpec.Volumes = append(podSpec.Volumes, volume)
+}
+
+func fillTemplate(template string, secretPath string, authenticator *v1alpha1.BasicAuthenticator, proxyHeadersEnabled bool) string {
+	var result string
+	result = strings.Replace(template, "AUTHENTICATOR_PORT", fmt.Sprintf("%d", authenticator.Spec.AuthenticatorPort), 1)
+	if authenticator.Spec.TLS != nil {
+		result = strings.Replace(result, "TLS_DIRECTIVES", tlsDirectives, 1)
+		result = strings.Replace(result, "TLS_PORT", fmt.Sprintf("%d", authenticator.Spec.TLS.Port), 1)
+		result = strings.Replace(result, "CERT_PATH", path.Join(TLSMountDir, corev1.TLSCertKey), 1)
+		result = strings.Replace(result, "KEY_PATH", path.Join(TLSMountDir, corev1.TLSPrivateKeyKey), 1)
+	} else {
+		result = strings.Replace(result, "TLS_DIRECTIVES", "", 1)
+	}
+	var headers string
+	if proxyHeadersEnabled {
+		headers += proxyHeaders
+	}
+	if authenticator.Spec.StripAuthHeader {
+		headers += stripAuthHeader
+	}
+	proxyTuning := getProxyTuningDirectives(authenticator)
+	var locations string
+	for _, location := range getNginxLocations(authenticator) {
+		block := locationTemplate
+		switch {
+		case location.Public && isDigestAuth(authenticator):
+			block = strings.Replace(block, "AUTH_DIRECTIVES", publicDigestAuthDirectives, 1)
+		case location.Public:
+			block = strings.Replace(block, "AUTH_DIRECTIVES", publicAuthDirectives, 1)
+		case isDigestAuth(authenticator):
+			block = strings.Replace(block, "AUTH_DIRECTIVES", digestAuthDirectives, 1)
+		default:
+			block = strings.Replace(block, "AUTH_DIRECTIVES", authDirectives, 1)
+		}
+		if location.CredentialsPath != "" {
+			block = strings.Replace(block, "FILE_PATH", location.CredentialsPath, 1)
+		} else {
+			block = strings.Replace(block, "FILE_PATH", secretPath, 1)
+		}
+		block = strings.Replace(block, "PROXY_HEADERS", headers, 1)
+		block = strings.Replace(block, "PROXY_TUNING", proxyTuning, 1)
+		// the upstream address and the path are filled last, so they are never mistaken for a placeholder
+		block = strings.Replace(block, "UPSTREAM_ADDRESS", getUpstreamAddress(authenticator), 1)
+		locations += strings.Replace(block, "LOCATION_PATH", location.Path, 1)
+	}
+	result = strings.Replace(result, "ERROR_PAGES", getErrorPageDirectives(authenticator.Spec.ErrorPages), 1)
+	result = strings.Replace(result, "LOCATIONS", locations, 1)
+	logFormat, logDirectives := getLogDirectives(authenticator.Spec.Logging)
+	result = strings.Replace(result, "LOG_FORMAT", logFormat, 1)
+	result = strings.Replace(result, "UPSTREAM_BLOCK", getUpstreamBlock(authenticator), 1)
+	result = strings.Replace(result, "LOG_DIRECTIVES", logDirectives, 1)
+	result = strings.Replace(result, "COMPRESSION", getCompressionDirectives(authenticator.Spec.Compression), 1)
+	return result
+}
+
+// getLogDirectives returns the log_format to define before the server block and the access_log and error_log
+// directives of the server block. Both are empty if logging is not set, keeping the nginx defaults.
+func getLogDirectives(logging *v1alpha1.LoggingSpec) (string, string) {
+	if logging == nil {
+		return "", ""
+	}
+	var logFormat, logDirectives string
+	switch logging.Format {
+	case "json":
+		logFormat = jsonLogFormat
+		logDirectives += fmt.Sprintf("\n\taccess_log %s %s;", accessLogPath, jsonLogFormatName)
+	case "combined":
+		logDirectives += fmt.Sprintf("\n\taccess_log %s combined;", accessLogPath)
+	}
+	if logging.ErrorLogLevel != "" {
+		logDirectives += fmt.Sprintf("\n\terror_log %s %s;", errorLogPath, logging.ErrorLogLevel)
+	}
+	return logFormat, logDirectives
+}
+
+// getCompressionDirectives returns the gzip directives of the server block. It is empty unless compression is enabled,
+// keeping gzip off as in the nginx defaults.
+func getCompressionDirectives(compression *v1alpha1.CompressionSpec) string {
+	if compression == nil || !compression.Enabled {
+		return ""
+	}
+	directives := "\n\tgzip on;"
+	if len(compression.Types) > 0 {
+		directives += fmt.Sprintf("\n\tgzip_types %s;", strings.Join(compression.Types, " "))
+	}
+	if compression.MinLength != nil {
+		directives += fmt.Sprintf("\n\tgzip_min_length %d;", *compression.MinLength)
+	}
+	return directives
+}
+
+// getProxyTuningDirectives returns the proxy timeout and buffering directives of each location. It is empty if none of
+// them are set, keeping the nginx defaults.
+func getProxyTuningDirectives(authenticator *v1alpha1.BasicAuthenticator) string {
+	var directives string
+	if timeouts := authenticator.Spec.ProxyTimeouts; timeouts != nil {
+		names := []string{"proxy_connect_timeout", "proxy_read_timeout", "proxy_send_timeout"}
+		for i, timeout := range []*metav1.Duration{timeouts.Connect, timeouts.Read, timeouts.Send} {
+			if timeout != nil {
+				directives += fmt.Sprintf("\n\t\t%s %s;", names[i], formatNginxTime(timeout.Duration))
+			}
+		}
+	}
+	if authenticator.Spec.ProxyBuffering != nil {
+		directives += fmt.Sprintf("\n\t\tproxy_buffering %s;", formatNginxSwitch(*authenticator.Spec.ProxyBuffering))
+	}
+	if authenticator.Spec.ProxyRequestBuffering != nil {
+		directives += fmt.Sprintf("\n\t\tproxy_request_buffering %s;", formatNginxSwitch(*authenticator.Spec.ProxyRequestBuffering))
+	}
+	return directives
+}
+
+// formatNginxTime formats d in whole seconds if possible, and in milliseconds otherwise, as nginx does not take
+// fractions of either
+func formatNginxTime(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
+
+func formatNginxSwitch(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+// getErrorPageDirectives returns an error_page directive for each of the pages, followed by the location serving them
+// from the mounted ConfigMap. It is empty if error pages are not set, keeping the nginx defaults.
+func getErrorPageDirectives(errorPages *v1alpha1.ErrorPagesSpec) string {
+	if errorPages == nil {
+		return ""
+	}
+	var directives string
+	for _, page := range errorPages.Pages {
+		directives += fmt.Sprintf("\n\terror_page %d %s%s;", page.Code, errorPagesLocation, getErrorPageFileName(page.Code))
+	}
+	return directives + errorPagesTemplate
+}
+
+func getErrorPageFileName(code int) string {
+	return fmt.Sprintf("%d.html", code)
+}
+
+// nginxLocation is a path prefix nginx proxies, either behind basic auth or public. CredentialsPath is the htpasswd
+// file of a protected path with its own credentials, and empty for the ones using the credentials secret.
+type nginxLocation struct {
+	Path            string
+	Public          bool
+	CredentialsPath string
+}
+
+// getNginxLocations returns the locations of Spec.ProtectedPaths and Spec.PublicPaths after the root location,
+// which is public once ProtectedPaths is set and protected otherwise, unless either of them lists "/" itself
+func getNginxLocations(authenticator *v1alpha1.BasicAuthenticator) []nginxLocation {
+	root := nginxLocation{Path: "/", Public: len(authenticator.Spec.ProtectedPaths) > 0}
+	var locations []nginxLocation
+	for _, protectedPath := range authenticator.Spec.ProtectedPaths {
+		if protectedPath == "/" {
+			root.Public = false
+			root.CredentialsPath = getPathCredentialsPath(authenticator, protectedPath)
+			continue
+		}
+		locations = append(locations, nginxLocation{Path: protectedPath, CredentialsPath: getPathCredentialsPath(authenticator, protectedPath)})
+	}
+	for _, publicPath := range authenticator.Spec.PublicPaths {
+		if publicPath == "/" {
+			root.Public = true
+			continue
+		}
+		locations = append(locations, nginxLocation{Path: publicPath, Public: true})
+	}
+	return append([]nginxLocation{root}, locations...)
+}
+
+// getPathCredentialsPath returns the htpasswd file of the path credential of protectedPath, or an empty string if it
+// uses the credentials secret
+func getPathCredentialsPath(authenticator *v1alpha1.BasicAuthenticator, protectedPath string) string {
+	for _, pathCredential := range authenticator.Spec.PathCredentials {
+		if pathCredential.Path == protectedPath {
+			return path.Join(PathCredentialsMountDir, pathCredential.CredentialsSecretRef, SecretHtpasswdField)
+		}
+	}
+	return ""
+}
+
+// nginxTemplateValues are the values a user supplied config template is rendered with
+type nginxTemplateValues struct {
+	AuthenticatorPort  int
+	AppService         string
+	AppPort            int
+	CredentialsPath    string
+	Realm              string
+	Digest             bool
+	ProxyHeaders       bool
+	StripAuthHeader    bool
+	TLS                bool
+	TLSPort            int
+	CertificatePath    string
+	CertificateKeyPath string
+	Locations          []nginxLocation
+	ErrorPages         string
+	ProxyTuning        string
+	Compression        string
+	UpstreamAddress    string
+	UpstreamBlock      string
+}
+
+func renderConfigTemplate(configTemplate string, authenticator *v1alpha1.BasicAuthenticator, proxyHeadersEnabled bool) (string, error) {
+	tmpl, err := texttemplate.New("nginx.conf").Option("missingkey=error").Parse(configTemplate)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse config template")
+	}
+	values := nginxTemplateValues{
+		AuthenticatorPort: authenticator.Spec.AuthenticatorPort,
+		AppService:        getUpstreamHost(authenticator),
+		AppPort:           authenticator.Spec.AppPort,
+		CredentialsPath:   getCredentialsPath(authenticator),
+		Realm:             authRealm,
+		Digest:            isDigestAuth(authenticator),
+		ProxyHeaders:      proxyHeadersEnabled,
+		StripAuthHeader:   authenticator.Spec.StripAuthHeader,
+		Locations:         getNginxLocations(authenticator),
+		ErrorPages:        getErrorPageDirectives(authenticator.Spec.ErrorPages),
+		ProxyTuning:       getProxyTuningDirectives(authenticator),
+		Compression:       getCompressionDirectives(authenticator.Spec.Compression),
+		UpstreamAddress:   getUpstreamAddress(authenticator),
+		UpstreamBlock:     getUpstreamBlock(authenticator),
+	}
+	if authenticator.Spec.TLS != nil {
+		values.TLS = true
+		values.TLSPort = authenticator.Spec.TLS.Port
+		values.CertificatePath = path.Join(TLSMountDir, corev1.TLSCertKey)
+		values.CertificateKeyPath = path.Join(TLSMountDir, corev1.TLSPrivateKeyKey)
+	}
+	var result strings.Builder
+	if err := tmpl.Execute(&result, values); err != nil {
+		return "", errors.Wrap(err, "failed to render config template")
+	}
+	return result.String(), nil
+}
+
+// getUpstreamAddress returns the address nginx proxies to: the upstream block when Spec.Upstreams lists more than one
+// server, the single one listed, or AppService and AppPort otherwise
+func getUpstreamAddress(authenticator *v1alpha1.BasicAuthenticator) string {
+	switch len(authenticator.Spec.Upstreams) {
+	case 0:
+		return fmt.Sprintf("%s:%d", getUpstreamHost(authenticator), authenticator.Spec.AppPort)
+	case 1:
+		return authenticator.Spec.Upstreams[0]
+	default:
+		return upstreamName
+	}
+}
+
+// getUpstreamBlock returns the upstream block balancing across Spec.Upstreams, which is empty unless more than one is set.
+// round_robin is the nginx default, so it needs no directive.
+func getUpstreamBlock(authenticator *v1alpha1.BasicAuthenticator) string {
+	if len(authenticator.Spec.Upstreams) < 2 {
+		return ""
+	}
+	block := fmt.Sprintf("upstream %s {", upstreamName)
+	if authenticator.Spec.LoadBalancingMethod == "least_conn" {
+		block += "\n\tleast_conn;"
+	}
+	for _, upstream := range authenticator.Spec.Upstreams {
+		block += fmt.Sprintf("\n\tserver %s;", upstream)
+	}
+	return block + "\n}\n"
+}
+
+// getUpstreamHost returns the host nginx proxies to, which is the application container itself in sidecar mode
+func getUpstreamHost(authenticator *v1alpha1.BasicAuthenticator) string {
+	if authenticator.Spec.Type == "sidecar" {
+		return "localhost"
+	}
+	return authenticator.Spec.AppService
+}
+
+func fillMainTemplate(tuning *v1alpha1.TuningSpec) string {
+	workerProcesses := defaultWorkerProcesses
+	if tuning.WorkerProcesses != nil {
+		workerProcesses = tuning.WorkerProcesses.String()
+	}
+	workerConnections := defaultWorkerConnections
+	if tuning.WorkerConnections > 0 {
+		workerConnections = tuning.WorkerConnections
+	}
+	result := strings.Replace(mainTemplate, "WORKER_PROCESSES", workerProcesses, 1)
+	result = strings.Replace(result, "WORKER_CONNECTIONS", fmt.Sprintf("%d", workerConnections), 1)
+	return result
+}
+
+// getNginxArgs points nginx to the main configuration of the configmap when Spec.Tuning is set,
+// otherwise the image's command is left untouched
+func getNginxArgs(basicAuthenticator *v1alpha1.BasicAuthenticator) []string {
+	if basicAuthenticator.Spec.Tuning == nil {
+		return nil
+	}
+	return []string{"nginx", "-c", path.Join(ConfigMountPath, MainConfigKey), "-g", "daemon off;"}
+}
+
+// getStartupProbe returns a probe which holds the nginx container back from becoming ready until the credentials file is
+// mounted and not empty, and nginx accepts its config. Otherwise the pod may serve without auth or with stale credentials
+// for the moment the volumes take to be populated.
+func getStartupProbe(basicAuthenticator *v1alpha1.BasicAuthenticator) *corev1.Probe {
+	configTest := "nginx -t -q"
+	if basicAuthenticator.Spec.Tuning != nil {
+		configTest = fmt.Sprintf("%s -c %s", configTest, path.Join(ConfigMountPath, MainConfigKey))
+	}
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"sh", "-c", fmt.Sprintf("test -s %s && %s", getCredentialsPath(basicAuthenticator), configTest)},
+			},
+		},
+		TimeoutSeconds:   1,
+		PeriodSeconds:    startupProbePeriodSeconds,
+		SuccessThreshold: 1,
+		FailureThreshold: startupProbeFailureThreshold,
+	}
+}
+
+// getTerminationGracePeriodSeconds returns how long the nginx pods get to drain before they are killed
+func getTerminationGracePeriodSeconds(basicAuthenticator *v1alpha1.BasicAuthenticator) int64 {
+	if basicAuthenticator.Spec.TerminationGracePeriodSeconds == nil {
+		return defaultTerminationGracePeriodSeconds
+	}
+	return *basicAuthenticator.Spec.TerminationGracePeriodSeconds
+}
+
+// getNginxLifecycle returns a preStop hook which keeps nginx serving until the pod is removed from the endpoints, then
+// makes it quit gracefully. The hook waits out the grace period afterwards, as the SIGTERM sent once it returns would stop
+// nginx without draining, and is cut short as soon as nginx has finished the in-flight requests and exited.
+func getNginxLifecycle(basicAuthenticator *v1alpha1.BasicAuthenticator) *corev1.Lifecycle {
+	gracePeriod := getTerminationGracePeriodSeconds(basicAuthenticator)
+	delay := int64(preStopDelaySeconds)
+	if gracePeriod < delay {
+		delay = gracePeriod
+	}
+	quit := "nginx -s quit"
+	if basicAuthenticator.Spec.Tuning != nil {
+		// nginx finds the pid of the master through the same config it was started with
+		quit = fmt.Sprintf("nginx -c %s -s quit", path.Join(ConfigMountPath, MainConfigKey))
+	}
+	return &corev1.Lifecycle{
+		PreStop: &corev1.LifecycleHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"sh", "-c", fmt.Sprintf("sleep %d; %s; sleep %d", delay, quit, gracePeriod-delay)},
+			},
+		},
+	}
+}
+
+// getPodTemplateAnnotations returns the annotations which roll the nginx pods whenever they change
+func getPodTemplateAnnotations(basicAuthenticator *v1alpha1.BasicAuthenticator, configChecksum string) map[string]string {
+	annotations := make(map[string]string)
+	if basicAuthenticator.Status.LastRotationTime != nil {
+		annotations[RotatedAtAnnotation] = basicAuthenticator.Status.LastRotationTime.UTC().Format(time.RFC3339)
+	}
+	if configChecksum != "" {
+		annotations[ConfigChecksumAnnotation] = configChecksum
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
+// getConfigChecksum returns the sha256 of the nginx configmap data, which is stable regardless of the map's order
+func getConfigChecksum(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%s\n", key, data[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// setNodePlacement copies the node selector, tolerations and affinity of the spec to the nginx pods
+func setNodePlacement(podSpec *corev1.PodSpec, basicAuthenticator *v1alpha1.BasicAuthenticator) {
+	if len(basicAuthenticator.Spec.NodeSelector) > 0 {
+		podSpec.NodeSelector = make(map[string]string, len(basicAuthenticator.Spec.NodeSelector))
+		for key, value := range basicAuthenticator.Spec.NodeSelector {
+			podSpec.NodeSelector[key] = value
+		}
+	}
+	for i := range basicAuthenticator.Spec.Tolerations {
+		podSpec.Tolerations = append(podSpec.Tolerations, *basicAuthenticator.Spec.Tolerations[i].DeepCopy())
+	}
+	if basicAuthenticator.Spec.Affinity != nil {
+		podSpec.Affinity = basicAuthenticator.Spec.Affinity.DeepCopy()
+	}
+}
+
+// getTopologySpreadConstraints returns a copy of Spec.TopologySpreadConstraints. If they are not set, the pods of a deployment
+// which may run more than one replica are spread across zones. The pods are still scheduled when the zones cannot be
+// balanced, so clusters without zones are not affected.
+func getTopologySpreadConstraints(basicAuthenticator *v1alpha1.BasicAuthenticator, podLabels map[string]string) []corev1.TopologySpreadConstraint {
+	if len(basicAuthenticator.Spec.TopologySpreadConstraints) > 0 {
+		constraints := make([]corev1.TopologySpreadConstraint, 0, len(basicAuthenticator.Spec.TopologySpreadConstraints))
+		for i := range basicAuthenticator.Spec.TopologySpreadConstraints {
+			constraints = append(constraints, *basicAuthenticator.Spec.TopologySpreadConstraints[i].DeepCopy())
+		}
+		return constraints
+	}
+	autoscaling := basicAuthenticator.Spec.Autoscaling
+	scalesOut := basicAuthenticator.Spec.AdaptiveScale || (autoscaling != nil && autoscaling.MaxReplicas > 1)
+	if getMinReplicas(basicAuthenticator) <= 1 && !scalesOut {
+		return nil
+	}
+	return []corev1.TopologySpreadConstraint{
+		{
+			MaxSkew:           1,
+			TopologyKey:       corev1.LabelTopologyZone,
+			WhenUnsatisfiable: corev1.ScheduleAnyway,
+			LabelSelector:     &metav1.LabelSelector{MatchLabels: mergeStringMaps(nil, podLabels)},
+		},
+	}
+}
+
+// getExtraVolumes returns a copy of Spec.ExtraVolumes, so the volumes set on a workload never share fields with the spec
+func getExtraVolumes(basicAuthenticator *v1alpha1.BasicAuthenticator) []corev1.Volume {
+	volumes := make([]corev1.Volume, 0, len(basicAuthenticator.Spec.ExtraVolumes))
+	for i := range basicAuthenticator.Spec.ExtraVolumes {
+		volumes = append(volumes, *basicAuthenticator.Spec.ExtraVolumes[i].DeepCopy())
+	}
+	return volumes
+}
+
+func getExtraVolumeMounts(basicAuthenticator *v1alpha1.BasicAuthenticator) []corev1.VolumeMount {
+	volumeMounts := make([]corev1.VolumeMount, 0, len(basicAuthenticator.Spec.ExtraVolumeMounts))
+	for i := range basicAuthenticator.Spec.ExtraVolumeMounts {
+		volumeMounts = append(volumeMounts, *basicAuthenticator.Spec.ExtraVolumeMounts[i].DeepCopy())
+	}
+	return volumeMounts
+}
+
+func getTLSContainerPort(basicAuthenticator *v1alpha1.BasicAuthenticator) corev1.ContainerPort {
+	return corev1.ContainerPort{
+		Name:          "https",
+		ContainerPort: int32(basicAuthenticator.Spec.TLS.Port),
+	}
+}
+
+func getTLSVolume(basicAuthenticator *v1alpha1.BasicAuthenticator) corev1.Volume {
+	return corev1.Volume{
+		Name: basicAuthenticator.Spec.TLS.SecretName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: basicAuthenticator.Spec.TLS.SecretName,
+				Items: []corev1.KeyToPath{
+					{
+						Key:  corev1.TLSCertKey,
+						Path: corev1.TLSCertKey,
+					},
+					{
+						Key:  corev1.TLSPrivateKeyKey,
+						Path: corev1.TLSPrivateKeyKey,
+					},
+				},
+			},
+		},
+	}
+}
+
+func getTLSVolumeMount(basicAuthenticator *v1alpha1.BasicAuthenticator) corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      basicAuthenticator.Spec.TLS.SecretName,
+		MountPath: TLSMountDir,
+		ReadOnly:  true,
+	}
+}
+
+// getNginxBatchArgs returns the nginx command line run by batchSidecarScript
+func getNginxBatchArgs(basicAuthenticator *v1alpha1.BasicAuthenticator) []string {
+	if args := getNginxArgs(basicAuthenticator); args != nil {
+		return args
+	}
+	return []string{"nginx", "-g", "daemon off;"}
+}
+
+func getLifecycleVolume() corev1.Volume {
+	return corev1.Volume{
+		Name: lifecycleVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+}
+
+func getLifecycleVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      lifecycleVolumeName,
+		MountPath: LifecycleMountDir,
+	}
+}
+
+// getTmpVolume returns an in-memory volume, so the files nginx writes at runtime, like buffered request bodies, never touch the disk
+func getTmpVolume() corev1.Volume {
+	return corev1.Volume{
+		Name: tmpVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{
+				Medium: corev1.StorageMediumMemory,
+			},
+		},
+	}
+}
+
+func getTmpVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      tmpVolumeName,
+		MountPath: TmpMountPath,
+	}
+}
+
+// getErrorPagesVolume projects the page of each code to the file its error_page directive refers to
+func getErrorPagesVolume(errorPages *v1alpha1.ErrorPagesSpec) corev1.Volume {
+	items := make([]corev1.KeyToPath, 0, len(errorPages.Pages))
+	for _, page := range errorPages.Pages {
+		items = append(items, corev1.KeyToPath{Key: page.Key, Path: getErrorPageFileName(page.Code)})
+	}
+	return corev1.Volume{
+		Name: errorPagesVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: errorPages.ConfigMapName,
+				},
+				Items: items,
+			},
+		},
+	}
+}
+
+func getErrorPagesVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      errorPagesVolumeName,
+		MountPath: ErrorPagesMountDir,
+		ReadOnly:  true,
+	}
+}
+
+// getPathCredentialsSecretNames returns the secrets referenced by Spec.PathCredentials, each listed once
+func getPathCredentialsSecretNames(basicAuthenticator *v1alpha1.BasicAuthenticator) []string {
+	var secretNames []string
+	for _, pathCredential := range basicAuthenticator.Spec.PathCredentials {
+		if !existsInList(secretNames, pathCredential.CredentialsSecretRef) {
+			secretNames = append(secretNames, pathCredential.CredentialsSecretRef)
+		}
+	}
+	return secretNames
+}
+
+// getPathCredentialsVolumes returns a volume with the htpasswd file of each path credentials secret. The volumes are
+// numbered rather than named after the secrets, as a secret name may be longer than a volume name can be.
+func getPathCredentialsVolumes(basicAuthenticator *v1alpha1.BasicAuthenticator) []corev1.Volume {
+	var volumes []corev1.Volume
+	for i, secretName := range getPathCredentialsSecretNames(basicAuthenticator) {
+		volumes = append(volumes, corev1.Volume{
+			Name: getPathCredentialsVolumeName(i),
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: secretName,
+					Items:      []corev1.KeyToPath{{Key: SecretHtpasswdField, Path: SecretHtpasswdField}},
+				},
+			},
+		})
+	}
+	return volumes
+}
+
+func getPathCredentialsVolumeMounts(basicAuthenticator *v1alpha1.BasicAuthenticator) []corev1.VolumeMount {
+	var volumeMounts []corev1.VolumeMount
+	for i, secretName := range getPathCredentialsSecretNames(basicAuthenticator) {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      getPathCredentialsVolumeName(i),
+			MountPath: path.Join(PathCredentialsMountDir, secretName),
+			ReadOnly:  true,
+		})
+	}
+	return volumeMounts
+}
+
+func getPathCredentialsVolumeName(index int) string {
+	return fmt.Sprintf("%s%d", pathCredentialsVolumePrefix, index)
+}
+
+func getNginxServiceName(basicAuthenticator *v1alpha1.BasicAuthenticator) string {
+	return fmt.Sprintf("%s-svc", basicAuthenticator.Name)
+}
+
+func getNginxRouteName(basicAuthenticator *v1alpha1.BasicAuthenticator) string {
+	return fmt.Sprintf("%s-route", basicAuthenticator.Name)
+}
+
+func getServiceType(serviceType string) corev1.ServiceType {
+	switch serviceType {
+	case "NodePort":
+		return corev1.ServiceTypeNodePort
+	case "LoadBalancer":
+		return corev1.ServiceTypeLoadBalancer
+	default:
+		return corev1.ServiceTypeClusterIP
+	}
+}
+
+func getContainerIndex(containers []corev1.Container, name string) int {
+	for idx, container := range containers {
+		if container.Name == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+func getVolumeMountIndex(volumeMounts []corev1.VolumeMount, name string) int {
+	for idx, volumeMount := range volumeMounts {
+		if volumeMount.Name == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+func getVolumeIndex(volumes []corev1.Volume, name string) int {
+	for idx, volume := range volumes {
+		if volume.Name == name {
 			return idx
 		}
 	}
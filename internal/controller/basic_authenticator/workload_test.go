@@ -0,0 +1,997 @@
+package basic_authenticator
+
+import (
+	"github.com/snapp-incubator/simple-authenticator/api/v1alpha1"
+	"github.com/snapp-incubator/simple-authenticator/internal/config"
+	"github.com/snapp-incubator/simple-authenticator/pkg/htpasswd"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderConfigTemplate(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "values are rendered",
+			template: "listen {{ .AuthenticatorPort }}; auth_basic \"{{ .Realm }}\"; auth_basic_user_file {{ .CredentialsPath }}; proxy_pass http://{{ .AppService }}:{{ .AppPort }};",
+			expected: "listen 8080; auth_basic \"basic authentication area\"; auth_basic_user_file /etc/secret/htpasswd; proxy_pass http://upstream:3000;",
+		},
+		{
+			name:     "tls is optional",
+			template: "{{ if .TLS }}listen {{ .TLSPort }} ssl;{{ end }}",
+			expected: "",
+		},
+		{
+			name:     "unknown values fail to render",
+			template: "{{ .Upstream }}",
+			wantErr:  true,
+		},
+		{
+			name:     "malformed templates fail to parse",
+			template: "{{ .AppPort ",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := renderConfigTemplate(tt.template, basicAuthenticator, true)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(result) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestMergeDeploymentSpecPreservesExternalFields(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-merge", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	found := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil)
+	found.Spec.Template.Annotations = map[string]string{"kubectl.kubernetes.io/restartedAt": "2023-12-01T00:00:00Z"}
+	found.Spec.Template.Spec.NodeName = "node-1"
+	found.Spec.Template.Spec.NodeSelector = map[string]string{"kubernetes.io/os": "linux"}
+
+	lastRotation := metav1.Now()
+	basicAuthenticator.Status.LastRotationTime = &lastRotation
+	desired := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", &config.CustomConfig{
+		WebserverConf: config.WebserverConfig{Image: "nginxinc/nginx-unprivileged:1.25.4"},
+	})
+
+	mergeDeploymentSpec(found, desired)
+
+	template := found.Spec.Template
+	if template.Annotations["kubectl.kubernetes.io/restartedAt"] != "2023-12-01T00:00:00Z" {
+		t.Errorf("expected externally set annotation to survive, got %v", template.Annotations)
+	}
+	if _, exists := template.Annotations[RotatedAtAnnotation]; !exists {
+		t.Errorf("expected operator annotation to be applied, got %v", template.Annotations)
+	}
+	if template.Spec.NodeName != "node-1" || template.Spec.NodeSelector["kubernetes.io/os"] != "linux" {
+		t.Errorf("expected scheduling fields to survive, got nodeName %q and nodeSelector %v", template.Spec.NodeName, template.Spec.NodeSelector)
+	}
+	if template.Spec.Containers[0].Image != "nginxinc/nginx-unprivileged:1.25.4" {
+		t.Errorf("expected image to be updated, got %q", template.Spec.Containers[0].Image)
+	}
+}
+
+func TestFillTemplateProxyHeaders(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	headers := []string{
+		"proxy_set_header Host $host;",
+		"proxy_set_header X-Real-IP $remote_addr;",
+		"proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;",
+		"proxy_set_header X-Forwarded-Proto $scheme;",
+	}
+
+	enabled := fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	for _, header := range headers {
+		if !strings.Contains(enabled, header) {
+			t.Errorf("expected %q in config:\n%s", header, enabled)
+		}
+	}
+	disabled := fillTemplate(template, SecretMountPath, basicAuthenticator, false)
+	if strings.Contains(disabled, "proxy_set_header") || strings.Contains(disabled, "PROXY_HEADERS") {
+		t.Errorf("expected no proxy headers in config:\n%s", disabled)
+	}
+}
+
+func TestHtpasswdIsMountedFromSecret(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-secret-mount", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	configMap, err := createNginxConfigmap(basicAuthenticator, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(configMap.Data["nginx.conf"], "auth_basic_user_file \""+SecretMountPath+"\";") {
+		t.Errorf("expected the config to reference the mounted htpasswd, got:\n%s", configMap.Data["nginx.conf"])
+	}
+
+	deployment := createNginxDeployment(basicAuthenticator, configMap.Name, "", "secret", nil)
+	idx := getVolumeIndex(deployment.Spec.Template.Spec.Volumes, "secret")
+	if idx == -1 || deployment.Spec.Template.Spec.Volumes[idx].Secret == nil {
+		t.Fatal("expected the credentials to be mounted from a secret volume")
+	}
+	if secretName := deployment.Spec.Template.Spec.Volumes[idx].Secret.SecretName; secretName != "secret" {
+		t.Errorf("expected the secret volume to refer to the credentials secret, got %q", secretName)
+	}
+	mounted := false
+	for _, mount := range deployment.Spec.Template.Spec.Containers[0].VolumeMounts {
+		if mount.Name == "secret" && mount.MountPath == SecretMountDir {
+			mounted = true
+		}
+	}
+	if !mounted {
+		t.Errorf("expected the credentials secret to be mounted on %s", SecretMountDir)
+	}
+}
+
+func TestFillTemplateStripAuthHeader(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	stripDirective := `proxy_set_header Authorization "";`
+
+	if result := fillTemplate(template, SecretMountPath, basicAuthenticator, true); strings.Contains(result, stripDirective) {
+		t.Errorf("expected the Authorization header to be passed by default:\n%s", result)
+	}
+	basicAuthenticator.Spec.StripAuthHeader = true
+	for _, proxyHeadersEnabled := range []bool{true, false} {
+		if result := fillTemplate(template, SecretMountPath, basicAuthenticator, proxyHeadersEnabled); !strings.Contains(result, stripDirective) {
+			t.Errorf("expected the Authorization header to be stripped:\n%s", result)
+		}
+	}
+}
+
+func TestFillTemplateLogging(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	conf := fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	if strings.Contains(conf, "log_format") || strings.Contains(conf, "access_log") || strings.Contains(conf, "error_log") {
+		t.Errorf("expected the nginx log defaults without logging, got:\n%s", conf)
+	}
+
+	basicAuthenticator.Spec.Logging = &v1alpha1.LoggingSpec{Format: "json", ErrorLogLevel: "warn"}
+	conf = fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	if !strings.HasPrefix(conf, "log_format "+jsonLogFormatName+" escape=json") || !strings.Contains(conf, `"remote_user":"$remote_user"`) {
+		t.Errorf("expected a json log format with the basic auth user ahead of the server block, got:\n%s", conf)
+	}
+	for _, directive := range []string{"access_log /var/log/nginx/access.log " + jsonLogFormatName + ";", "error_log /var/log/nginx/error.log warn;"} {
+		if !strings.Contains(conf, directive) {
+			t.Errorf("expected %q in config:\n%s", directive, conf)
+		}
+	}
+
+	basicAuthenticator.Spec.Logging = &v1alpha1.LoggingSpec{Format: "combined"}
+	conf = fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	if strings.Contains(conf, "log_format") || !strings.Contains(conf, "access_log /var/log/nginx/access.log combined;") {
+		t.Errorf("expected the predefined combined format, got:\n%s", conf)
+	}
+}
+
+func TestFillTemplateProxyTuning(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			PublicPaths:       []string{"/health"},
+		},
+	}
+	conf := fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	if strings.Contains(conf, "_timeout") || strings.Contains(conf, "buffering") || strings.Contains(conf, "PROXY_TUNING") {
+		t.Errorf("expected the nginx proxy defaults without tuning, got:\n%s", conf)
+	}
+
+	buffering := false
+	basicAuthenticator.Spec.ProxyTimeouts = &v1alpha1.ProxyTimeoutsSpec{
+		Connect: &metav1.Duration{Duration: 1500 * time.Millisecond},
+		Read:    &metav1.Duration{Duration: 2 * time.Minute},
+	}
+	basicAuthenticator.Spec.ProxyBuffering = &buffering
+	conf = fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	for _, directive := range []string{"proxy_connect_timeout 1500ms;", "proxy_read_timeout 120s;", "proxy_buffering off;"} {
+		if strings.Count(conf, directive) != 2 {
+			t.Errorf("expected %q in both locations:\n%s", directive, conf)
+		}
+	}
+	if strings.Contains(conf, "proxy_send_timeout") || strings.Contains(conf, "proxy_request_buffering") {
+		t.Errorf("expected only the set directives, got:\n%s", conf)
+	}
+}
+
+func TestFillTemplateCompression(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	conf := fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	if strings.Contains(conf, "gzip") || strings.Contains(conf, "COMPRESSION") {
+		t.Errorf("expected gzip to be left off without compression, got:\n%s", conf)
+	}
+
+	basicAuthenticator.Spec.Compression = &v1alpha1.CompressionSpec{Types: []string{"text/css"}}
+	if conf = fillTemplate(template, SecretMountPath, basicAuthenticator, true); strings.Contains(conf, "gzip") {
+		t.Errorf("expected gzip to be left off until compression is enabled, got:\n%s", conf)
+	}
+
+	basicAuthenticator.Spec.Compression = &v1alpha1.CompressionSpec{
+		Enabled:   true,
+		Types:     []string{"text/css", "application/javascript"},
+		MinLength: pointer.Int(1024),
+	}
+	conf = fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	server := conf[strings.Index(conf, "server {"):strings.Index(conf, "location ")]
+	for _, directive := range []string{"gzip on;", "gzip_types text/css application/javascript;", "gzip_min_length 1024;"} {
+		if !strings.Contains(server, directive) {
+			t.Errorf("expected %q in the server block:\n%s", directive, conf)
+		}
+	}
+
+	basicAuthenticator.Spec.Compression = &v1alpha1.CompressionSpec{Enabled: true}
+	conf = fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	if !strings.Contains(conf, "gzip on;") || strings.Contains(conf, "gzip_types") || strings.Contains(conf, "gzip_min_length") {
+		t.Errorf("expected the nginx gzip defaults besides gzip on, got:\n%s", conf)
+	}
+}
+
+func TestFillTemplateUpstreams(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	conf := fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	if strings.Contains(conf, "upstream "+upstreamName) || !strings.Contains(conf, "proxy_pass http://upstream:3000;") {
+		t.Errorf("expected to proxy to appService without upstreams, got:\n%s", conf)
+	}
+
+	basicAuthenticator.Spec.Upstreams = []string{"backend-a:8000"}
+	conf = fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	if strings.Contains(conf, "upstream "+upstreamName) || !strings.Contains(conf, "proxy_pass http://backend-a:8000;") {
+		t.Errorf("expected a simple proxy_pass to a single upstream, got:\n%s", conf)
+	}
+
+	basicAuthenticator.Spec.Upstreams = []string{"backend-a:8000", "10.0.0.2:8000"}
+	basicAuthenticator.Spec.LoadBalancingMethod = "least_conn"
+	conf = fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	expectedBlock := "upstream " + upstreamName + " {\n\tleast_conn;\n\tserver backend-a:8000;\n\tserver 10.0.0.2:8000;\n}\nserver {"
+	if !strings.HasPrefix(conf, expectedBlock) || !strings.Contains(conf, "proxy_pass http://"+upstreamName+";") {
+		t.Errorf("expected to balance across the upstreams, got:\n%s", conf)
+	}
+
+	basicAuthenticator.Spec.LoadBalancingMethod = "round_robin"
+	if conf = fillTemplate(template, SecretMountPath, basicAuthenticator, true); strings.Contains(conf, "least_conn") {
+		t.Errorf("expected the default round robin balancing, got:\n%s", conf)
+	}
+}
+
+func TestFillTemplatePaths(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	protected := "auth_basic_user_file \"" + SecretMountPath + "\";"
+	getLocation := func(conf string, path string) string {
+		start := strings.Index(conf, "location "+path+" {")
+		if start == -1 {
+			t.Fatalf("expected a location for %s in config:\n%s", path, conf)
+		}
+		return conf[start : start+strings.Index(conf[start:], "}")]
+	}
+
+	conf := fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	if strings.Count(conf, "location ") != 1 || !strings.Contains(getLocation(conf, "/"), protected) {
+		t.Errorf("expected only the root location to be protected by default, got:\n%s", conf)
+	}
+
+	basicAuthenticator.Spec.PublicPaths = []string{"/health", "/public"}
+	conf = fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	if !strings.Contains(getLocation(conf, "/"), protected) {
+		t.Errorf("expected the root location to stay protected, got:\n%s", conf)
+	}
+	for _, path := range basicAuthenticator.Spec.PublicPaths {
+		if location := getLocation(conf, path); !strings.Contains(location, "auth_basic off;") || !strings.Contains(location, "proxy_pass http://upstream:3000;") {
+			t.Errorf("expected %s to be proxied without basic auth, got:\n%s", path, location)
+		}
+	}
+
+	basicAuthenticator.Spec.ProtectedPaths = []string{"/admin"}
+	conf = fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	if !strings.Contains(getLocation(conf, "/"), "auth_basic off;") {
+		t.Errorf("expected the root location to be public once protectedPaths is set, got:\n%s", conf)
+	}
+	if !strings.Contains(getLocation(conf, "/admin"), protected) {
+		t.Errorf("expected /admin to be protected, got:\n%s", conf)
+	}
+}
+
+func TestInMemoryTmpVolume(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-tmp", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	deployment := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil)
+	if getVolumeIndex(deployment.Spec.Template.Spec.Volumes, tmpVolumeName) != -1 {
+		t.Fatal("expected no tmp volume by default")
+	}
+
+	basicAuthenticator.Spec.InMemoryTmp = true
+	deployment = createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil)
+	idx := getVolumeIndex(deployment.Spec.Template.Spec.Volumes, tmpVolumeName)
+	if idx == -1 {
+		t.Fatal("expected a tmp volume")
+	}
+	emptyDir := deployment.Spec.Template.Spec.Volumes[idx].EmptyDir
+	if emptyDir == nil || emptyDir.Medium != corev1.StorageMediumMemory {
+		t.Errorf("expected a memory backed emptyDir, got %+v", deployment.Spec.Template.Spec.Volumes[idx].VolumeSource)
+	}
+	mounted := false
+	for _, mount := range deployment.Spec.Template.Spec.Containers[0].VolumeMounts {
+		if mount.Name == tmpVolumeName && mount.MountPath == TmpMountPath {
+			mounted = true
+		}
+	}
+	if !mounted {
+		t.Errorf("expected the tmp volume to be mounted on %s", TmpMountPath)
+	}
+}
+
+func TestInjectPodTemplateOfCronJobJobTemplate(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		Spec: v1alpha1.BasicAuthenticatorSpec{Type: "sidecar", AppPort: 8080, AuthenticatorPort: 8081},
+	}
+	cronJob := &batchv1.CronJob{
+		Spec: batchv1.CronJobSpec{
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							RestartPolicy: corev1.RestartPolicyOnFailure,
+							Containers:    []corev1.Container{{Name: "app"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	injectPodTemplate(&cronJob.Spec.JobTemplate.Spec.Template, basicAuthenticator, "configmap", "secret", nil, true)
+
+	podSpec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+	if podSpec.RestartPolicy != corev1.RestartPolicyOnFailure {
+		t.Errorf("expected the restart policy to be kept, got %q", podSpec.RestartPolicy)
+	}
+	idx := getContainerIndex(podSpec.Containers, nginxDefaultContainerName)
+	if idx == -1 {
+		t.Fatal("expected the sidecar to be injected")
+	}
+	if podSpec.Containers[idx].Command[2] != batchSidecarScript {
+		t.Errorf("expected the sidecar to run the batch script, got %v", podSpec.Containers[idx].Command)
+	}
+	for _, container := range podSpec.Containers {
+		if getVolumeMountIndex(container.VolumeMounts, lifecycleVolumeName) == -1 {
+			t.Errorf("expected container %s to mount the lifecycle volume", container.Name)
+		}
+	}
+	if getVolumeIndex(podSpec.Volumes, lifecycleVolumeName) == -1 {
+		t.Error("expected the lifecycle volume to be added")
+	}
+}
+
+func TestBatchSidecarScriptExitsWhenJobIsDone(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	doneFile := filepath.Join(t.TempDir(), "done")
+	script := strings.ReplaceAll(batchSidecarScript, LifecycleDoneFile, doneFile)
+	// stands in for nginx, which exits successfully on SIGTERM
+	fakeNginx := "trap 'exit 0' TERM; while true; do sleep 0.1; done"
+	cmd := exec.Command("sh", "-c", script, "sh", "sh", "-c", fakeNginx)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		t.Fatalf("expected the sidecar to keep running until the job is done, exited with %v", err)
+	case <-time.After(1500 * time.Millisecond):
+	}
+	if err := os.WriteFile(doneFile, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Errorf("expected the sidecar to exit successfully, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatal("expected the sidecar to exit once the job is done")
+	}
+}
+
+func TestSidecarResourcesFallBack(t *testing.T) {
+	sidecarResources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("5m")},
+	}
+	overrideResources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+	}
+	configResources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")},
+	}
+	tests := []struct {
+		name      string
+		overrides *v1alpha1.ConfigOverrides
+		expected  corev1.ResourceRequirements
+	}{
+		{
+			name:      "sidecar resources are used",
+			overrides: &v1alpha1.ConfigOverrides{Resources: &overrideResources, SidecarResources: &sidecarResources},
+			expected:  sidecarResources,
+		},
+		{
+			name:      "falls back to the overridden resources",
+			overrides: &v1alpha1.ConfigOverrides{Resources: &overrideResources},
+			expected:  overrideResources,
+		},
+		{
+			name:     "falls back to the config",
+			expected: configResources,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			basicAuthenticator := &v1alpha1.BasicAuthenticator{
+				Spec: v1alpha1.BasicAuthenticatorSpec{Type: "sidecar", AppPort: 8080, AuthenticatorPort: 8081, ConfigOverrides: tt.overrides},
+			}
+			customConfig := getEffectiveConfig(&config.CustomConfig{WebserverConf: config.WebserverConfig{Resources: configResources}}, basicAuthenticator)
+			podTemplate := &corev1.PodTemplateSpec{}
+
+			injectPodTemplate(podTemplate, basicAuthenticator, "configmap", "secret", customConfig, false)
+
+			resources := podTemplate.Spec.Containers[0].Resources
+			if !resources.Requests.Cpu().Equal(*tt.expected.Requests.Cpu()) {
+				t.Errorf("expected cpu request %s, got %s", tt.expected.Requests.Cpu(), resources.Requests.Cpu())
+			}
+		})
+	}
+}
+
+func TestNamespaceConfigOverridesImage(t *testing.T) {
+	customConfig := &config.CustomConfig{
+		WebserverConf: config.WebserverConfig{Image: "registry.example.com/nginx:1.25"},
+		NamespaceConfs: map[string]config.NamespaceConfig{
+			"tenant-a": {Image: "tenant-a.example.com/nginx:1.25"},
+		},
+	}
+	tests := []struct {
+		name      string
+		namespace string
+		overrides *v1alpha1.ConfigOverrides
+		expected  string
+	}{
+		{
+			name:      "namespace override is used",
+			namespace: "tenant-a",
+			expected:  "tenant-a.example.com/nginx:1.25",
+		},
+		{
+			name:      "other namespaces use the global config",
+			namespace: "tenant-b",
+			expected:  "registry.example.com/nginx:1.25",
+		},
+		{
+			name:      "configOverrides take precedence over the namespace override",
+			namespace: "tenant-a",
+			overrides: &v1alpha1.ConfigOverrides{Image: "custom/nginx:1.25"},
+			expected:  "custom/nginx:1.25",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			basicAuthenticator := &v1alpha1.BasicAuthenticator{
+				ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator", Namespace: tt.namespace},
+				Spec:       v1alpha1.BasicAuthenticatorSpec{Type: "deployment", AppPort: 8080, AuthenticatorPort: 8081, ConfigOverrides: tt.overrides},
+			}
+			deployment := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", getEffectiveConfig(customConfig, basicAuthenticator))
+			if image := deployment.Spec.Template.Spec.Containers[0].Image; image != tt.expected {
+				t.Errorf("expected image %q, got %q", tt.expected, image)
+			}
+		})
+	}
+}
+
+func TestDigestAuth(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-digest", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			AuthType:          v1alpha1.AuthTypeDigest,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			PublicPaths:       []string{"/healthz"},
+		},
+	}
+	configMap, err := createNginxConfigmap(basicAuthenticator, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := configMap.Data["nginx.conf"]
+	for _, directive := range []string{`auth_digest	"` + authRealm + `";`, `auth_digest_user_file "` + DigestSecretMountPath + `";`, "auth_digest off;"} {
+		if !strings.Contains(conf, directive) {
+			t.Errorf("expected %q in config:\n%s", directive, conf)
+		}
+	}
+	if strings.Contains(conf, "auth_basic") {
+		t.Errorf("expected no basic auth directives with digest auth, got:\n%s", conf)
+	}
+
+	secret := &corev1.Secret{Data: map[string][]byte{"username": []byte("Mufasa"), "password": []byte("Circle Of Life")}}
+	if err := updateCredentialFields(secret, basicAuthenticator); err != nil {
+		t.Fatal(err)
+	}
+	// the realm is part of the hash, so it has to be the one nginx is configured with
+	expected := "Mufasa:" + authRealm + ":" + htpasswd.DigestHash("Mufasa", authRealm, "Circle Of Life")
+	if string(secret.Data[SecretHtdigestField]) != expected {
+		t.Errorf("expected htdigest %q, got %q", expected, secret.Data[SecretHtdigestField])
+	}
+	if htpasswd.DigestHash("Mufasa", "testrealm@host.com", "Circle Of Life") != "939e7578ed9e3c518a452acee763bce9" {
+		t.Error("expected the HA1 of RFC 2617's example")
+	}
+
+	deployment := createNginxDeployment(basicAuthenticator, configMap.Name, "", "credentials", nil)
+	volume := deployment.Spec.Template.Spec.Volumes[getVolumeIndex(deployment.Spec.Template.Spec.Volumes, "credentials")]
+	if len(volume.Secret.Items) != 2 || volume.Secret.Items[1].Key != SecretHtdigestField {
+		t.Errorf("expected the htdigest file to be mounted, got %+v", volume.Secret.Items)
+	}
+}
+
+func TestNodePlacement(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-placement", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	podSpec := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil).Spec.Template.Spec
+	if podSpec.NodeSelector != nil || podSpec.Tolerations != nil || podSpec.Affinity != nil {
+		t.Errorf("expected no placement constraints by default, got %v, %v and %v", podSpec.NodeSelector, podSpec.Tolerations, podSpec.Affinity)
+	}
+
+	basicAuthenticator.Spec.NodeSelector = map[string]string{"pool": "edge"}
+	basicAuthenticator.Spec.Tolerations = []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "edge", Effect: corev1.TaintEffectNoSchedule}}
+	basicAuthenticator.Spec.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}},
+				}},
+			},
+		},
+	}
+	podSpec = createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil).Spec.Template.Spec
+	if !reflect.DeepEqual(podSpec.NodeSelector, basicAuthenticator.Spec.NodeSelector) {
+		t.Errorf("expected node selector %v, got %v", basicAuthenticator.Spec.NodeSelector, podSpec.NodeSelector)
+	}
+	if !reflect.DeepEqual(podSpec.Tolerations, basicAuthenticator.Spec.Tolerations) {
+		t.Errorf("expected tolerations %v, got %v", basicAuthenticator.Spec.Tolerations, podSpec.Tolerations)
+	}
+	if !reflect.DeepEqual(podSpec.Affinity, basicAuthenticator.Spec.Affinity) || podSpec.Affinity == basicAuthenticator.Spec.Affinity {
+		t.Errorf("expected a copy of the affinity %v, got %v", basicAuthenticator.Spec.Affinity, podSpec.Affinity)
+	}
+
+	basicAuthenticator.Spec.Type = "sidecar"
+	podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+	injectPodTemplate(podTemplate, basicAuthenticator, "configmap", "secret", nil, false)
+	if podTemplate.Spec.NodeSelector != nil || podTemplate.Spec.Tolerations != nil || podTemplate.Spec.Affinity != nil {
+		t.Error("expected the placement of injected workloads to be left to them")
+	}
+}
+
+func TestTopologySpreadConstraints(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-spread", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	if constraints := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil).Spec.Template.Spec.TopologySpreadConstraints; constraints != nil {
+		t.Errorf("expected no spread constraints for a single replica, got %v", constraints)
+	}
+
+	basicAuthenticator.Spec.Replicas = 3
+	deployment := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil)
+	constraints := deployment.Spec.Template.Spec.TopologySpreadConstraints
+	if len(constraints) != 1 || constraints[0].TopologyKey != corev1.LabelTopologyZone || constraints[0].MaxSkew != 1 {
+		t.Fatalf("expected the replicas to be spread across zones by default, got %v", constraints)
+	}
+	if !reflect.DeepEqual(constraints[0].LabelSelector.MatchLabels, deployment.Spec.Template.Labels) {
+		t.Errorf("expected the constraint to select the nginx pods, got %v", constraints[0].LabelSelector)
+	}
+
+	basicAuthenticator.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{{
+		MaxSkew:           2,
+		TopologyKey:       corev1.LabelHostname,
+		WhenUnsatisfiable: corev1.DoNotSchedule,
+	}}
+	constraints = createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil).Spec.Template.Spec.TopologySpreadConstraints
+	if !reflect.DeepEqual(constraints, basicAuthenticator.Spec.TopologySpreadConstraints) {
+		t.Errorf("expected the given constraints %v, got %v", basicAuthenticator.Spec.TopologySpreadConstraints, constraints)
+	}
+}
+
+func TestExtraVolumes(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-extra", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			ExtraVolumes: []corev1.Volume{{
+				Name:         "error-pages",
+				VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "error-pages"}}},
+			}},
+			ExtraVolumeMounts: []corev1.VolumeMount{{Name: "error-pages", MountPath: "/usr/share/nginx/errors", ReadOnly: true}},
+		},
+	}
+	deployment := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil)
+	if getVolumeIndex(deployment.Spec.Template.Spec.Volumes, "error-pages") == -1 {
+		t.Error("expected the extra volume in the nginx pod")
+	}
+	if getVolumeMountIndex(deployment.Spec.Template.Spec.Containers[0].VolumeMounts, "error-pages") == -1 {
+		t.Error("expected the extra volume to be mounted into nginx")
+	}
+
+	basicAuthenticator.Spec.Type = "sidecar"
+	podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+	injectPodTemplate(podTemplate, basicAuthenticator, "configmap", "secret", nil, false)
+	sidecar := podTemplate.Spec.Containers[getContainerIndex(podTemplate.Spec.Containers, nginxDefaultContainerName)]
+	if getVolumeIndex(podTemplate.Spec.Volumes, "error-pages") == -1 || getVolumeMountIndex(sidecar.VolumeMounts, "error-pages") == -1 {
+		t.Error("expected the extra volume to be mounted into the sidecar")
+	}
+	if getVolumeMountIndex(podTemplate.Spec.Containers[0].VolumeMounts, "error-pages") != -1 {
+		t.Error("expected the extra volume not to be mounted into the application container")
+	}
+
+	removeInjectedPodTemplate(podTemplate, nginxDefaultContainerName, getInjectedVolumeNames(basicAuthenticator, "secret"), []string{"configmap"})
+	if len(podTemplate.Spec.Volumes) != 0 {
+		t.Errorf("expected the extra volume to be removed with the sidecar, got %+v", podTemplate.Spec.Volumes)
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-errors", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	if nginxConf := fillTemplate(template, SecretMountPath, basicAuthenticator, true); strings.Contains(nginxConf, "error_page") || strings.Contains(nginxConf, "ERROR_PAGES") {
+		t.Errorf("expected the nginx default error pages without errorPages, got:\n%s", nginxConf)
+	}
+
+	basicAuthenticator.Spec.ErrorPages = &v1alpha1.ErrorPagesSpec{
+		ConfigMapName: "error-pages",
+		Pages:         []v1alpha1.ErrorPage{{Code: 401, Key: "unauthorized.html"}, {Code: 403, Key: "forbidden.html"}},
+	}
+	nginxConf := fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	for _, directive := range []string{
+		"error_page 401 " + errorPagesLocation + "401.html;",
+		"error_page 403 " + errorPagesLocation + "403.html;",
+		"location ^~ " + errorPagesLocation + " {",
+		"alias " + ErrorPagesMountDir + "/;",
+	} {
+		if !strings.Contains(nginxConf, directive) {
+			t.Errorf("expected %q in the nginx config, got:\n%s", directive, nginxConf)
+		}
+	}
+
+	deployment := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil)
+	idx := getVolumeIndex(deployment.Spec.Template.Spec.Volumes, errorPagesVolumeName)
+	if idx == -1 {
+		t.Fatal("expected the error pages volume in the nginx pod")
+	}
+	items := deployment.Spec.Template.Spec.Volumes[idx].ConfigMap.Items
+	if len(items) != 2 || items[0].Key != "unauthorized.html" || items[0].Path != "401.html" || items[1].Path != "403.html" {
+		t.Errorf("expected each page to be projected as <code>.html, got %+v", items)
+	}
+	if getVolumeMountIndex(deployment.Spec.Template.Spec.Containers[0].VolumeMounts, errorPagesVolumeName) == -1 {
+		t.Error("expected the error pages to be mounted into nginx")
+	}
+
+	basicAuthenticator.Spec.Type = "sidecar"
+	podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+	injectPodTemplate(podTemplate, basicAuthenticator, "configmap", "secret", nil, false)
+	sidecar := podTemplate.Spec.Containers[getContainerIndex(podTemplate.Spec.Containers, nginxDefaultContainerName)]
+	if getVolumeMountIndex(sidecar.VolumeMounts, errorPagesVolumeName) == -1 {
+		t.Error("expected the error pages to be mounted into the sidecar")
+	}
+	removeInjectedPodTemplate(podTemplate, nginxDefaultContainerName, getInjectedVolumeNames(basicAuthenticator, "secret"), []string{"configmap"})
+	if len(podTemplate.Spec.Volumes) != 0 {
+		t.Errorf("expected the error pages volume to be removed with the sidecar, got %+v", podTemplate.Spec.Volumes)
+	}
+}
+
+func TestPathCredentials(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-paths", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+			ProtectedPaths:    []string{"/", "/admin", "/billing", "/reports"},
+			PathCredentials: []v1alpha1.PathCredential{
+				{Path: "/admin", CredentialsSecretRef: "admin-credentials"},
+				{Path: "/billing", CredentialsSecretRef: "billing-credentials"},
+				{Path: "/reports", CredentialsSecretRef: "admin-credentials"},
+			},
+		},
+	}
+	getLocation := func(conf string, path string) string {
+		start := strings.Index(conf, "location "+path+" {")
+		if start == -1 {
+			t.Fatalf("expected a location for %s in config:\n%s", path, conf)
+		}
+		return conf[start : start+strings.Index(conf[start:], "}")]
+	}
+	conf := fillTemplate(template, SecretMountPath, basicAuthenticator, true)
+	for location, credentialsPath := range map[string]string{
+		"/":        SecretMountPath,
+		"/admin":   path.Join(PathCredentialsMountDir, "admin-credentials", SecretHtpasswdField),
+		"/billing": path.Join(PathCredentialsMountDir, "billing-credentials", SecretHtpasswdField),
+		"/reports": path.Join(PathCredentialsMountDir, "admin-credentials", SecretHtpasswdField),
+	} {
+		if !strings.Contains(getLocation(conf, location), "auth_basic_user_file \""+credentialsPath+"\";") {
+			t.Errorf("expected %s to read %s, got:\n%s", location, credentialsPath, conf)
+		}
+	}
+
+	podSpec := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil).Spec.Template.Spec
+	for i, secretName := range []string{"admin-credentials", "billing-credentials"} {
+		idx := getVolumeIndex(podSpec.Volumes, getPathCredentialsVolumeName(i))
+		if idx == -1 || podSpec.Volumes[idx].Secret.SecretName != secretName {
+			t.Fatalf("expected a single volume of secret %s, got %+v", secretName, podSpec.Volumes)
+		}
+		mountIdx := getVolumeMountIndex(podSpec.Containers[0].VolumeMounts, getPathCredentialsVolumeName(i))
+		if mountIdx == -1 || podSpec.Containers[0].VolumeMounts[mountIdx].MountPath != path.Join(PathCredentialsMountDir, secretName) {
+			t.Errorf("expected secret %s to be mounted in its own directory, got %+v", secretName, podSpec.Containers[0].VolumeMounts)
+		}
+	}
+	if getVolumeIndex(podSpec.Volumes, getPathCredentialsVolumeName(2)) != -1 {
+		t.Error("expected a secret referenced by more than one path to be mounted once")
+	}
+
+	basicAuthenticator.Spec.Type = "sidecar"
+	podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+	injectPodTemplate(podTemplate, basicAuthenticator, "configmap", "secret", nil, false)
+	removeInjectedPodTemplate(podTemplate, nginxDefaultContainerName, getInjectedVolumeNames(basicAuthenticator, "secret"), []string{"configmap"})
+	if len(podTemplate.Spec.Volumes) != 0 {
+		t.Errorf("expected the path credentials volumes to be removed with the sidecar, got %+v", podTemplate.Spec.Volumes)
+	}
+}
+
+func TestImagePullSettings(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-pull", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	podSpec := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil).Spec.Template.Spec
+	if podSpec.ImagePullSecrets != nil {
+		t.Errorf("expected no image pull secrets by default, got %v", podSpec.ImagePullSecrets)
+	}
+	if policy := podSpec.Containers[0].ImagePullPolicy; policy != corev1.PullIfNotPresent {
+		t.Errorf("expected pull policy %s by default, got %q", corev1.PullIfNotPresent, policy)
+	}
+
+	basicAuthenticator.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}}
+	basicAuthenticator.Spec.ImagePullPolicy = corev1.PullAlways
+	podSpec = createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil).Spec.Template.Spec
+	if !reflect.DeepEqual(podSpec.ImagePullSecrets, basicAuthenticator.Spec.ImagePullSecrets) {
+		t.Errorf("expected image pull secrets %v, got %v", basicAuthenticator.Spec.ImagePullSecrets, podSpec.ImagePullSecrets)
+	}
+	if policy := podSpec.Containers[0].ImagePullPolicy; policy != corev1.PullAlways {
+		t.Errorf("expected pull policy %s, got %q", corev1.PullAlways, policy)
+	}
+
+	basicAuthenticator.Spec.Type = "sidecar"
+	podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "app-registry"}, {Name: "registry"}},
+		Containers:       []corev1.Container{{Name: "app"}},
+	}}
+	injectPodTemplate(podTemplate, basicAuthenticator, "configmap", "secret", nil, false)
+	if len(podTemplate.Spec.ImagePullSecrets) != 2 {
+		t.Errorf("expected the pull secrets of the workload to be kept without duplicates, got %v", podTemplate.Spec.ImagePullSecrets)
+	}
+	idx := getContainerIndex(podTemplate.Spec.Containers, nginxDefaultContainerName)
+	if idx == -1 || podTemplate.Spec.Containers[idx].ImagePullPolicy != corev1.PullAlways {
+		t.Errorf("expected the sidecar to use pull policy %s", corev1.PullAlways)
+	}
+}
+
+func TestStartupProbe(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-startup", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	probe := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil).Spec.Template.Spec.Containers[0].StartupProbe
+	if probe == nil || probe.Exec == nil {
+		t.Fatal("expected the nginx container to have an exec startup probe")
+	}
+	command := strings.Join(probe.Exec.Command, " ")
+	if !strings.Contains(command, "test -s "+SecretMountPath) || !strings.Contains(command, "nginx -t") {
+		t.Errorf("expected the probe to check the credentials file and test the config, got %q", command)
+	}
+
+	basicAuthenticator.Spec.AuthType = "digest"
+	basicAuthenticator.Spec.Tuning = &v1alpha1.TuningSpec{}
+	probe = createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil).Spec.Template.Spec.Containers[0].StartupProbe
+	command = strings.Join(probe.Exec.Command, " ")
+	if !strings.Contains(command, "test -s "+DigestSecretMountPath) {
+		t.Errorf("expected the probe to check the htdigest file, got %q", command)
+	}
+	if !strings.Contains(command, "-c "+path.Join(ConfigMountPath, MainConfigKey)) {
+		t.Errorf("expected the probe to test the main config, got %q", command)
+	}
+}
+
+func TestGracefulTermination(t *testing.T) {
+	basicAuthenticator := &v1alpha1.BasicAuthenticator{
+		ObjectMeta: metav1.ObjectMeta{Name: "basicauthenticator-drain", Namespace: "default"},
+		Spec: v1alpha1.BasicAuthenticatorSpec{
+			Type:              "deployment",
+			Replicas:          1,
+			AppService:        "upstream",
+			AppPort:           3000,
+			AuthenticatorPort: 8080,
+		},
+	}
+	podSpec := createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil).Spec.Template.Spec
+	if podSpec.TerminationGracePeriodSeconds == nil || *podSpec.TerminationGracePeriodSeconds != defaultTerminationGracePeriodSeconds {
+		t.Errorf("expected the default grace period of %d seconds, got %v", defaultTerminationGracePeriodSeconds, podSpec.TerminationGracePeriodSeconds)
+	}
+	lifecycle := podSpec.Containers[0].Lifecycle
+	if lifecycle == nil || lifecycle.PreStop == nil || lifecycle.PreStop.Exec == nil {
+		t.Fatal("expected nginx to have a preStop hook")
+	}
+	if command := strings.Join(lifecycle.PreStop.Exec.Command, " "); !strings.Contains(command, "sleep 5; nginx -s quit; sleep 25") {
+		t.Errorf("expected the hook to delay and quit nginx gracefully, got %q", command)
+	}
+
+	gracePeriod := int64(3)
+	basicAuthenticator.Spec.TerminationGracePeriodSeconds = &gracePeriod
+	podSpec = createNginxDeployment(basicAuthenticator, "configmap", "", "secret", nil).Spec.Template.Spec
+	if *podSpec.TerminationGracePeriodSeconds != gracePeriod {
+		t.Errorf("expected a grace period of %d seconds, got %d", gracePeriod, *podSpec.TerminationGracePeriodSeconds)
+	}
+	if command := strings.Join(podSpec.Containers[0].Lifecycle.PreStop.Exec.Command, " "); !strings.Contains(command, "sleep 3; nginx -s quit; sleep 0") {
+		t.Errorf("expected the delay to fit into the grace period, got %q", command)
+	}
+
+	basicAuthenticator.Spec.Type = "sidecar"
+	podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+	injectPodTemplate(podTemplate, basicAuthenticator, "configmap", "secret", nil, false)
+	if podTemplate.Spec.TerminationGracePeriodSeconds != nil {
+		t.Error("expected the grace period of injected workloads to be left to them")
+	}
+	idx := getContainerIndex(podTemplate.Spec.Containers, nginxDefaultContainerName)
+	if idx == -1 || !reflect.DeepEqual(podTemplate.Spec.Containers[idx].Lifecycle, getNginxLifecycle(basicAuthenticator)) {
+		t.Error("expected the sidecar to have the preStop hook")
+	}
+}
@@ -1,6 +1,10 @@
 package htpasswd
 
-import "github.com/johnaoss/htpasswd/apr1"
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/johnaoss/htpasswd/apr1"
+)
 
 func ApacheHash(pass, salt string) (string, error) {
 	hashedPassword, err := apr1.Hash(pass, salt)
@@ -9,3 +13,9 @@ func ApacheHash(pass, salt string) (string, error) {
 	}
 	return hashedPassword, nil
 }
+
+// DigestHash returns the HA1 hash of an htdigest entry, which is the MD5 of "user:realm:pass"
+func DigestHash(user, realm, pass string) string {
+	hash := md5.Sum([]byte(user + ":" + realm + ":" + pass))
+	return hex.EncodeToString(hash[:])
+}
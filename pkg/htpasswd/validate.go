@@ -1,6 +1,16 @@
 package htpasswd
 
-import "strings"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	bcryptHashPattern = regexp.MustCompile(`^\$2[aby]\$\d{2}\$[./A-Za-z0-9]{53}$`)
+	apr1HashPattern   = regexp.MustCompile(`^\$apr1\$[./A-Za-z0-9]{1,8}\$[./A-Za-z0-9]{22}$`)
+	shaHashPattern    = regexp.MustCompile(`^\{SHA\}[A-Za-z0-9+/]{27}=$`)
+)
 
 func ValidateHtpasswdFormat(pass string) bool {
 	passParts := strings.Split(pass, ":")
@@ -9,3 +19,32 @@ func ValidateHtpasswdFormat(pass string) bool {
 	}
 	return true
 }
+
+// ValidateHtpasswd checks every entry of an htpasswd file is a "user:hash" pair using a bcrypt, apr1 or sha hash.
+// Empty lines and comments are ignored. The returned error references the first malformed line.
+func ValidateHtpasswd(content string) error {
+	entries := 0
+	for idx, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lineNumber := idx + 1
+		user, hash, found := strings.Cut(line, ":")
+		if !found || user == "" {
+			return fmt.Errorf("line %d: entry should be like \"username:hash\"", lineNumber)
+		}
+		if !isSupportedHash(hash) {
+			return fmt.Errorf("line %d: password of user %q is not a valid bcrypt, apr1 or sha hash", lineNumber, user)
+		}
+		entries++
+	}
+	if entries == 0 {
+		return fmt.Errorf("htpasswd has no entries")
+	}
+	return nil
+}
+
+func isSupportedHash(hash string) bool {
+	return bcryptHashPattern.MatchString(hash) || apr1HashPattern.MatchString(hash) || shaHashPattern.MatchString(hash)
+}
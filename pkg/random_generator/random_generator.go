@@ -5,23 +5,68 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"math/big"
 )
 
-func GenerateRandomString(length int) (string, error) {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+const (
+	alphanumericCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// symbolCharset leaves out ':' and quotes so credentials stay safe to use in htpasswd files and shells
+	symbolCharset = "!#$%&()*+,-./;<=>?@[]^_{|}~"
+)
 
+func GenerateRandomString(length int) (string, error) {
 	randomBytes := make([]byte, length)
 	_, err := rand.Read(randomBytes)
 	if err != nil {
 		return "", err
 	}
 	for i := range randomBytes {
-		randomBytes[i] = charset[int(randomBytes[i])%len(charset)]
+		randomBytes[i] = alphanumericCharset[int(randomBytes[i])%len(alphanumericCharset)]
 	}
 
 	return string(randomBytes), nil
 }
 
+// GeneratePassword returns a uniformly distributed random password of the given length.
+// If includeSymbols is set, the password is guaranteed to contain at least one symbol.
+func GeneratePassword(length int, includeSymbols bool) (string, error) {
+	if length <= 0 {
+		return "", fmt.Errorf("invalid password length %d", length)
+	}
+	charset := alphanumericCharset
+	if includeSymbols {
+		charset += symbolCharset
+	}
+	password := make([]byte, length)
+	for i := range password {
+		c, err := randomChar(charset)
+		if err != nil {
+			return "", err
+		}
+		password[i] = c
+	}
+	if includeSymbols {
+		idx, err := rand.Int(rand.Reader, big.NewInt(int64(length)))
+		if err != nil {
+			return "", err
+		}
+		c, err := randomChar(symbolCharset)
+		if err != nil {
+			return "", err
+		}
+		password[idx.Int64()] = c
+	}
+	return string(password), nil
+}
+
+func randomChar(charset string) (byte, error) {
+	idx, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+	if err != nil {
+		return 0, err
+	}
+	return charset[idx.Int64()], nil
+}
+
 func GenerateRandomName(baseName string, salt string) string {
 	tuple := fmt.Sprintf("%s-%s", baseName, salt)
 	sum := sha256.Sum256([]byte(tuple))